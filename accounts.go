@@ -0,0 +1,333 @@
+package main
+
+import (
+	"bufio"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+const (
+	// passwordIterations is the PBKDF2-SHA256 work factor for new
+	// passwords. Each account records its own, so this can be raised
+	// without invalidating existing ones.
+	passwordIterations = 600000
+	
+	minNameLength     = 2
+	maxNameLength     = 16
+	minPasswordLength = 6
+	
+	// maxLoginAttempts is how many tries one connection gets at each
+	// prompt before it is dropped.
+	maxLoginAttempts = 3
+)
+
+var (
+	errAccountExists = errors.New("account already exists")
+	errWrongPassword = errors.New("wrong password")
+	errNoAccount     = errors.New("no such account")
+)
+
+// errAccountLocked is returned while an account is locked out after too
+// many failed logins.
+type errAccountLocked struct {
+	remaining time.Duration
+}
+
+func (e errAccountLocked) Error() string {
+	return fmt.Sprintf("account locked for another %v", e.remaining.Round(time.Second))
+}
+
+// Account is a registered character name and its password hash, stored as
+// one JSON file per account.
+type Account struct {
+	Name       string    `json:"name"`
+	Salt       []byte    `json:"salt"`
+	Hash       []byte    `json:"hash"`
+	Iterations int       `json:"iterations"`
+	Created    time.Time `json:"created"`
+}
+
+// AccountStore keeps accounts on disk and tracks failed logins in memory.
+// It is safe for use by many connections at once.
+type AccountStore struct {
+	dir         string
+	maxFailures int
+	lockout     time.Duration
+	iterations  int
+	
+	mu       sync.Mutex
+	failures map[string]*loginFailures
+}
+
+type loginFailures struct {
+	count       int
+	lockedUntil time.Time
+}
+
+func NewAccountStore(dir string, maxFailures int, lockout time.Duration) *AccountStore {
+	return &AccountStore{
+		dir:         dir,
+		maxFailures: maxFailures,
+		lockout:     lockout,
+		iterations:  passwordIterations,
+		failures:    make(map[string]*loginFailures),
+	}
+}
+
+// validateName checks a new character name: letters only, so that it is
+// safe as a file name and readable in game.
+func validateName(name string) error {
+	if len(name) < minNameLength || len(name) > maxNameLength {
+		return fmt.Errorf("names must be %d to %d letters long", minNameLength, maxNameLength)
+	}
+	for _, r := range name {
+		if r > unicode.MaxASCII || !unicode.IsLetter(r) {
+			return errors.New("names may only contain letters")
+		}
+	}
+	return nil
+}
+
+func (s *AccountStore) path(name string) string {
+	return filepath.Join(s.dir, strings.ToLower(name)+".json")
+}
+
+// Load returns the account for a name, matched without regard to case.
+func (s *AccountStore) Load(name string) (*Account, error) {
+	data, err := os.ReadFile(s.path(name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, errNoAccount
+	}
+	if err != nil {
+		return nil, err
+	}
+	var account Account
+	if err := json.Unmarshal(data, &account); err != nil {
+		return nil, fmt.Errorf("%s: %w", s.path(name), err)
+	}
+	return &account, nil
+}
+
+// Create registers a new account. It fails with errAccountExists if the
+// name was taken, even by a registration that finished a moment earlier.
+func (s *AccountStore) Create(name, password string) (*Account, error) {
+	account := &Account{
+		Name:       name,
+		Salt:       make([]byte, 16),
+		Iterations: s.iterations,
+		Created:    time.Now(),
+	}
+	if _, err := rand.Read(account.Salt); err != nil {
+		return nil, err
+	}
+	hash, err := hashPassword(password, account.Salt, account.Iterations)
+	if err != nil {
+		return nil, err
+	}
+	account.Hash = hash
+	
+	data, err := json.MarshalIndent(account, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(s.path(name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if errors.Is(err, os.ErrExist) {
+		return nil, errAccountExists
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, err
+	}
+	return account, file.Close()
+}
+
+// Authenticate checks a password, counting failures towards a lockout.
+func (s *AccountStore) Authenticate(name, password string) (*Account, error) {
+	key := strings.ToLower(name)
+	if remaining := s.lockedFor(key); remaining > 0 {
+		return nil, errAccountLocked{remaining}
+	}
+	
+	account, err := s.Load(name)
+	if err != nil {
+		return nil, err
+	}
+	hash, err := hashPassword(password, account.Salt, account.Iterations)
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare(hash, account.Hash) != 1 {
+		s.recordFailure(key)
+		return nil, errWrongPassword
+	}
+	
+	s.mu.Lock()
+	delete(s.failures, key)
+	s.mu.Unlock()
+	return account, nil
+}
+
+func (s *AccountStore) lockedFor(key string) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if failures, ok := s.failures[key]; ok {
+		return time.Until(failures.lockedUntil)
+	}
+	return 0
+}
+
+func (s *AccountStore) recordFailure(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	
+	failures, ok := s.failures[key]
+	if !ok || (!failures.lockedUntil.IsZero() && time.Now().After(failures.lockedUntil)) {
+		failures = &loginFailures{}
+		s.failures[key] = failures
+	}
+	failures.count++
+	if s.maxFailures > 0 && failures.count >= s.maxFailures {
+		failures.lockedUntil = time.Now().Add(s.lockout)
+	}
+}
+
+func hashPassword(password string, salt []byte, iterations int) ([]byte, error) {
+	return pbkdf2.Key(sha256.New, password, salt, iterations, 32)
+}
+
+// echoer is implemented by connections that can stop the client showing
+// what is typed, for password prompts.
+type echoer interface {
+	EchoOff()
+	EchoOn()
+}
+
+func readPassword(conn net.Conn, scanner *bufio.Scanner, prompt string) (string, bool) {
+	fmt.Fprintf(conn, "%s%s%s ", ColorBrightCyan, prompt, ColorReset)
+	if e, ok := conn.(echoer); ok {
+		e.EchoOff()
+		defer e.EchoOn()
+	}
+	if !scanner.Scan() {
+		return "", false
+	}
+	// The client did not echo the Enter key either.
+	fmt.Fprint(conn, "\r\n")
+	return scanner.Text(), true
+}
+
+// login asks for a name and either checks the password of an existing
+// account or registers a new one. It returns the account's name as
+// registered.
+func login(conn net.Conn, scanner *bufio.Scanner, accounts *AccountStore) (string, bool) {
+	for attempt := 0; attempt < maxLoginAttempts; attempt++ {
+		fmt.Fprintf(conn, "%sWhat is your name?%s ", ColorBrightCyan, ColorReset)
+		if !scanner.Scan() {
+			return "", false
+		}
+		name := strings.TrimSpace(scanner.Text())
+		if err := validateName(name); err != nil {
+			fmt.Fprintf(conn, "%s\r\n", ColorError(fmt.Sprintf("Invalid name: %v.", err)))
+			continue
+		}
+		
+		account, err := accounts.Load(name)
+		switch {
+		case err == nil:
+			return authenticate(conn, scanner, accounts, account.Name)
+		case errors.Is(err, errNoAccount):
+			return register(conn, scanner, accounts, name)
+		default:
+			log.Printf("Loading account %s: %v", name, err)
+			fmt.Fprintf(conn, "%s\r\n", ColorError("Sorry, accounts are unavailable right now."))
+			return "", false
+		}
+	}
+	fmt.Fprintf(conn, "%s\r\n", ColorError("Too many invalid names. Goodbye!"))
+	return "", false
+}
+
+func authenticate(conn net.Conn, scanner *bufio.Scanner, accounts *AccountStore, name string) (string, bool) {
+	for attempt := 0; attempt < maxLoginAttempts; attempt++ {
+		password, ok := readPassword(conn, scanner, "Password:")
+		if !ok {
+			return "", false
+		}
+		_, err := accounts.Authenticate(name, password)
+		var locked errAccountLocked
+		switch {
+		case err == nil:
+			return name, true
+		case errors.As(err, &locked):
+			log.Printf("Refused login to locked account %s from %s", name, conn.RemoteAddr())
+			fmt.Fprintf(conn, "%s\r\n", ColorError(fmt.Sprintf("Too many failed logins. Try again in %v.", locked.remaining.Round(time.Second))))
+			return "", false
+		case errors.Is(err, errWrongPassword):
+			log.Printf("Failed login for %s from %s", name, conn.RemoteAddr())
+			fmt.Fprintf(conn, "%s\r\n", ColorError("Wrong password."))
+		default:
+			log.Printf("Authenticating %s: %v", name, err)
+			fmt.Fprintf(conn, "%s\r\n", ColorError("Sorry, accounts are unavailable right now."))
+			return "", false
+		}
+	}
+	fmt.Fprintf(conn, "%s\r\n", ColorError("Goodbye!"))
+	return "", false
+}
+
+func register(conn net.Conn, scanner *bufio.Scanner, accounts *AccountStore, name string) (string, bool) {
+	fmt.Fprintf(conn, "%s\r\n", ColorInfo(fmt.Sprintf("Creating a new character named %s.", name)))
+	for attempt := 0; attempt < maxLoginAttempts; attempt++ {
+		password, ok := readPassword(conn, scanner, "Choose a password:")
+		if !ok {
+			return "", false
+		}
+		if len(password) < minPasswordLength {
+			fmt.Fprintf(conn, "%s\r\n", ColorError(fmt.Sprintf("Passwords must be at least %d characters.", minPasswordLength)))
+			continue
+		}
+		confirm, ok := readPassword(conn, scanner, "Confirm password:")
+		if !ok {
+			return "", false
+		}
+		if confirm != password {
+			fmt.Fprintf(conn, "%s\r\n", ColorError("Passwords do not match."))
+			continue
+		}
+		
+		_, err := accounts.Create(name, password)
+		if errors.Is(err, errAccountExists) {
+			fmt.Fprintf(conn, "%s\r\n", ColorError("Someone just took that name. Goodbye!"))
+			return "", false
+		}
+		if err != nil {
+			log.Printf("Creating account %s: %v", name, err)
+			fmt.Fprintf(conn, "%s\r\n", ColorError("Sorry, accounts are unavailable right now."))
+			return "", false
+		}
+		log.Printf("New account: %s", name)
+		return name, true
+	}
+	fmt.Fprintf(conn, "%s\r\n", ColorError("Goodbye!"))
+	return "", false
+}
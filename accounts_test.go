@@ -0,0 +1,280 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testConfig returns the default configuration with accounts, saves and
+// world state kept in temporary directories.
+func testConfig(t *testing.T) Config {
+	config := DefaultConfig()
+	config.Accounts.Dir = t.TempDir()
+	config.Saves.Dir = t.TempDir()
+	config.World.StateFile = filepath.Join(t.TempDir(), "world.json")
+	return config
+}
+
+// newTestGame creates a game whose accounts hash quickly.
+func newTestGame(t *testing.T, config Config) *Game {
+	t.Helper()
+	game, err := NewGameWithConfig(config)
+	if err != nil {
+		t.Fatalf("Failed to create game: %v", err)
+	}
+	game.accounts.iterations = 1000
+	t.Cleanup(func() {
+		// Saves still being written would race the removal of the test's
+		// directories.
+		game.saves.Flush()
+		game.worldWriter.flush()
+	})
+	return game
+}
+
+// testClient drives a session over an in-memory connection.
+type testClient struct {
+	t    *testing.T
+	conn net.Conn
+	data chan string
+	seen string
+}
+
+func dialSession(t *testing.T, game *Game) *testClient {
+	server, client := net.Pipe()
+	t.Cleanup(func() { client.Close() })
+	go runSession(server, game, nil)
+	
+	c := &testClient{t: t, conn: client, data: make(chan string, 64)}
+	go func() {
+		defer close(c.data)
+		buf := make([]byte, 4096)
+		for {
+			n, err := client.Read(buf)
+			if n > 0 {
+				c.data <- string(buf[:n])
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return c
+}
+
+func (c *testClient) send(line string) {
+	c.t.Helper()
+	if _, err := c.conn.Write([]byte(line + "\r\n")); err != nil {
+		c.t.Fatalf("Failed to send %q: %v", line, err)
+	}
+}
+
+// expect waits for text to arrive and discards everything up to it.
+func (c *testClient) expect(want string) {
+	c.t.Helper()
+	timeout := time.After(5 * time.Second)
+	for !strings.Contains(c.seen, want) {
+		select {
+		case data, ok := <-c.data:
+			if !ok {
+				c.t.Fatalf("Connection closed waiting for %q; got %q", want, c.seen)
+			}
+			c.seen += data
+		case <-timeout:
+			c.t.Fatalf("Timed out waiting for %q; got %q", want, c.seen)
+		}
+	}
+	c.seen = c.seen[strings.Index(c.seen, want)+len(want):]
+}
+
+// expectClosed waits for the server to close the connection.
+func (c *testClient) expectClosed() {
+	c.t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case _, ok := <-c.data:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			c.t.Fatal("Timed out waiting for the connection to close")
+		}
+	}
+}
+
+func (c *testClient) register(name, password string) {
+	c.t.Helper()
+	c.expect("What is your name?")
+	c.send(name)
+	c.expect("Choose a password:")
+	c.send(password)
+	c.expect("Confirm password:")
+	c.send(password)
+	c.expect("Hello, ")
+}
+
+func TestAccountStore(t *testing.T) {
+	store := NewAccountStore(t.TempDir(), 5, time.Minute)
+	store.iterations = 1000
+	
+	if _, err := store.Create("Aragorn", "strider"); err != nil {
+		t.Fatalf("Failed to create account: %v", err)
+	}
+	if _, err := store.Create("aragorn", "other"); !errors.Is(err, errAccountExists) {
+		t.Errorf("Expected errAccountExists, got %v", err)
+	}
+	
+	data, err := os.ReadFile(store.path("Aragorn"))
+	if err != nil {
+		t.Fatalf("Expected account file: %v", err)
+	}
+	if strings.Contains(string(data), "strider") {
+		t.Error("Account file must not contain the password")
+	}
+	
+	if _, err := store.Authenticate("Aragorn", "wrong"); !errors.Is(err, errWrongPassword) {
+		t.Errorf("Expected errWrongPassword, got %v", err)
+	}
+	account, err := store.Authenticate("ARAGORN", "strider")
+	if err != nil {
+		t.Fatalf("Expected login to succeed: %v", err)
+	}
+	if account.Name != "Aragorn" {
+		t.Errorf("Expected registered name Aragorn, got %q", account.Name)
+	}
+	if _, err := store.Authenticate("Boromir", "x"); !errors.Is(err, errNoAccount) {
+		t.Errorf("Expected errNoAccount, got %v", err)
+	}
+}
+
+func TestAccountLockout(t *testing.T) {
+	store := NewAccountStore(t.TempDir(), 2, time.Hour)
+	store.iterations = 1000
+	store.Create("Gollum", "precious")
+	
+	store.Authenticate("Gollum", "ring")
+	store.Authenticate("Gollum", "fish")
+	
+	var locked errAccountLocked
+	if _, err := store.Authenticate("Gollum", "precious"); !errors.As(err, &locked) {
+		t.Errorf("Expected account to be locked, got %v", err)
+	}
+}
+
+func TestValidateName(t *testing.T) {
+	for _, name := range []string{"Bo", "Gandalf", "abcdefghijklmnop"} {
+		if err := validateName(name); err != nil {
+			t.Errorf("Expected %q to be valid: %v", name, err)
+		}
+	}
+	for _, name := range []string{"", "X", "abcdefghijklmnopq", "../etc", "Bob Smith", "R2D2", "Zoë"} {
+		if err := validateName(name); err == nil {
+			t.Errorf("Expected %q to be rejected", name)
+		}
+	}
+}
+
+func TestLoginFlow(t *testing.T) {
+	game := newTestGame(t, testConfig(t))
+	game.Start()
+	defer game.Stop()
+	
+	first := dialSession(t, game)
+	first.expect("What is your name?")
+	first.send("../evil")
+	first.expect("Invalid name")
+	first.send("Samwise")
+	first.expect("Choose a password:")
+	first.send("abc")
+	first.expect("at least 6 characters")
+	first.send("potatoes")
+	first.expect("Confirm password:")
+	first.send("potatos")
+	first.expect("do not match")
+	first.send("potatoes")
+	first.expect("Confirm password:")
+	first.send("potatoes")
+	first.expect("Hello, ")
+	first.send("quit")
+	first.expectClosed()
+	
+	second := dialSession(t, game)
+	second.expect("What is your name?")
+	second.send("samwise")
+	second.expect("Password:")
+	second.send("turnips")
+	second.expect("Wrong password.")
+	second.send("potatoes")
+	second.expect("Welcome back, ")
+	second.expect("Samwise")
+}
+
+func TestLoginLockout(t *testing.T) {
+	config := testConfig(t)
+	config.Accounts.MaxFailures = 2
+	game := newTestGame(t, config)
+	game.Start()
+	defer game.Stop()
+	game.accounts.Create("Merry", "mushrooms")
+	
+	client := dialSession(t, game)
+	client.expect("What is your name?")
+	client.send("Merry")
+	for i := 0; i < 2; i++ {
+		client.expect("Password:")
+		client.send("wrong")
+		client.expect("Wrong password.")
+	}
+	client.expect("Password:")
+	client.send("mushrooms")
+	client.expect("Too many failed logins")
+	client.expectClosed()
+}
+
+func TestDuplicateLogin(t *testing.T) {
+	game := newTestGame(t, testConfig(t))
+	game.Start()
+	defer game.Stop()
+	
+	first := dialSession(t, game)
+	first.register("Pippin", "secondbreakfast")
+	first.send("go north")
+	first.expect("Prancing Pony")
+	
+	refused := dialSession(t, game)
+	refused.expect("What is your name?")
+	refused.send("Pippin")
+	refused.expect("Password:")
+	refused.send("secondbreakfast")
+	refused.expect("already playing")
+	refused.send("n")
+	refused.expect("Goodbye!")
+	refused.expectClosed()
+	
+	second := dialSession(t, game)
+	second.expect("What is your name?")
+	second.send("Pippin")
+	second.expect("Password:")
+	second.send("secondbreakfast")
+	second.expect("already playing")
+	second.send("y")
+	second.expect("You take over your session.")
+	second.expect("Prancing Pony")
+	
+	first.expect("taken over by another connection")
+	first.expectClosed()
+	
+	second.send("who")
+	second.expect("Pippin")
+	var count int
+	game.Do(func() { count = len(game.players) })
+	if count != 1 {
+		t.Errorf("Expected one player after takeover, got %d", count)
+	}
+}
@@ -0,0 +1,975 @@
+package main
+
+import (
+	"bufio"
+	"embed"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The world is built from area files: plain text files named *.area, read
+// in name order. Each file defines items, monsters, rooms and shops as
+// blocks. A block starts with its kind and id and runs until the next
+// block; the lines inside it are a keyword followed by a value:
+//
+//	# Comments and blank lines are ignored.
+//	reset 15m                  (how often the area restocks; before any block)
+//
+//	item wooden_mug
+//	  name wooden mug
+//	  desc A sturdy wooden drinking mug
+//	  type misc                (weapon, armor or misc)
+//	  damage 0                 (weapons)
+//	  defense 0                (armor)
+//	  value 2                  (its price in gold; 0 means shops won't buy it)
+//
+//	monster giant_rat
+//	  name giant rat
+//	  desc A large, mangy rat with red eyes and yellowed teeth
+//	  health 15
+//	  damage 3
+//	  aggressive               (attacks players on sight)
+//	  respawn 10m              (how long it stays dead)
+//	  loot rat_tail 60         (an item it drops, with its weight)
+//	  loot bone 30 1-3         (and how many)
+//	  loot nothing 10          (the chance of nothing)
+//	  rolls 2                  (how many times to pick from the loot)
+//	  rare ruby 50             (dropped one time in 50, besides the loot)
+//	  gold 2-8                 (coins it carries, a number or a range)
+//
+//	room tavern
+//	  name The Prancing Pony Tavern
+//	  desc A cozy tavern filled with the smell of ale and roasted meat.
+//	  exit south town_square   (north, south, east, west, up or down)
+//	  place wooden_mug         (an item lying in the room)
+//	  spawn giant_rat          (a monster living in the room)
+//	  door south closed rusty_key   (open, closed or locked, and the key)
+//
+//	shop tavern_bar
+//	  keeper Barliman the innkeeper
+//	  at tavern                (the room where the keeper trades)
+//	  stock wooden_mug 3       (an item for sale and how many to keep in stock)
+//	  markup 150               (buyers pay this percent of an item's value)
+//	  offer 50                 (sellers get this percent of it)
+//	  restock 10m              (how often one more of each item comes back)
+//
+// A door stands in one of the room's exits and is shared with the way back,
+// so only one side defines it. A desc may be split over several desc lines,
+// which are joined with spaces. Ids are lower case letters, digits and
+// underscores, and are shared by all files, so an exit can lead to a room in
+// another area.
+
+//go:embed world/*.area
+var defaultWorld embed.FS
+
+// directions are the exits a room may have.
+var directions = []string{"north", "south", "east", "west", "up", "down"}
+
+// filePos is where a definition was read, for error messages.
+type filePos struct {
+	file string
+	line int
+}
+
+func (p filePos) String() string {
+	return fmt.Sprintf("%s:%d", p.file, p.line)
+}
+
+func (p filePos) errorf(format string, args ...any) error {
+	return fmt.Errorf("%s: %s", p, fmt.Sprintf(format, args...))
+}
+
+type itemProto struct {
+	id          string
+	pos         filePos
+	name        string
+	description string
+	itemType    string
+	damage      int
+	defense     int
+	value       int
+}
+
+type monsterProto struct {
+	id          string
+	pos         filePos
+	name        string
+	description string
+	health      int
+	damage      int
+	aggressive  bool
+	respawn     time.Duration // 0 means the configured default
+	loot        []lootEntry
+	rolls       int // times to pick from the loot; 0 means once
+	rare        []rareDrop
+	goldMin     int
+	goldMax     int
+}
+
+// lootEntry is one line of a monster's loot table: an item, how likely it
+// is to be picked compared to the others, and how many drop.
+type lootEntry struct {
+	item     string // item id, or "" for nothing
+	weight   int
+	min, max int
+	pos      filePos
+}
+
+// rareDrop is an item a monster drops one time in oneIn, on top of its
+// loot.
+type rareDrop struct {
+	item  string
+	oneIn int
+	pos   filePos
+}
+
+type exitDef struct {
+	direction string
+	target    string
+	pos       filePos
+}
+
+// doorDef is a door in a room's exit and the state it starts in.
+type doorDef struct {
+	direction string
+	state     string // "open", "closed" or "locked"
+	key       string // item id, or "" for a door without a lock
+	pos       filePos
+}
+
+// ref names an item or monster placed in a room.
+type ref struct {
+	id  string
+	pos filePos
+}
+
+// shopDef is a shopkeeper, the room they trade in and what they sell.
+type shopDef struct {
+	id      string
+	pos     filePos
+	keeper  string
+	room    string
+	roomPos filePos
+	stock   []stockDef
+	markup  int           // percent of an item's value buyers pay
+	offer   int           // percent of an item's value sellers get
+	restock time.Duration // 0 means the configured default
+}
+
+// stockDef is an item a shop sells and how many it keeps.
+type stockDef struct {
+	item  string
+	count int
+	pos   filePos
+}
+
+type roomDef struct {
+	id          string
+	pos         filePos
+	name        string
+	description string
+	exits       []exitDef
+	doors       []doorDef
+	items       []ref
+	spawns      []ref
+}
+
+// areaFile is one parsed area file, in the order it was written.
+type areaFile struct {
+	name     string
+	header   []string      // comment lines at the top of the file
+	reset    time.Duration // 0 means the configured default
+	items    []*itemProto
+	monsters []*monsterProto
+	rooms    []*roomDef
+	shops    []*shopDef
+}
+
+// id is the area's file name without its directory or extension.
+func (a *areaFile) id() string {
+	return strings.TrimSuffix(path.Base(a.name), ".area")
+}
+
+// worldData is a complete, checked set of area files.
+type worldData struct {
+	areas    []*areaFile
+	rooms    map[string]*roomDef
+	items    map[string]*itemProto
+	monsters map[string]*monsterProto
+	shops    map[string]*shopDef
+}
+
+// loadWorldFiles reads the area files in dir, or the built-in world if dir
+// is empty.
+func loadWorldFiles(dir string) (*worldData, error) {
+	fsys, dir := worldFS(dir)
+	return loadWorldData(fsys, dir)
+}
+
+// worldFS returns the file system holding the area files in dir, or the
+// built-in ones if dir is empty, and the name to show for it.
+func worldFS(dir string) (fs.FS, string) {
+	if dir == "" {
+		builtin, _ := fs.Sub(defaultWorld, "world")
+		return builtin, "world"
+	}
+	return os.DirFS(dir), dir
+}
+
+// loadWorldData reads every area file at the top of fsys. Errors are
+// reported together, each with the file and line it refers to; dir is the
+// directory shown in front of file names.
+func loadWorldData(fsys fs.FS, dir string) (*worldData, error) {
+	world, errs := readWorldData(fsys, dir)
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return world, nil
+}
+
+// readWorldData is loadWorldData for tools that want to look at a broken
+// world: it returns as much of the world as it could read, along with every
+// problem found. The world is nil only if the files couldn't be read.
+func readWorldData(fsys fs.FS, dir string) (*worldData, []error) {
+	names, err := fs.Glob(fsys, "*.area")
+	if err != nil {
+		return nil, []error{err}
+	}
+	if len(names) == 0 {
+		return nil, []error{fmt.Errorf("%s: no .area files", dir)}
+	}
+	sort.Strings(names)
+	
+	var areas []*areaFile
+	var errs []error
+	for _, name := range names {
+		file, err := fsys.Open(name)
+		if err != nil {
+			return nil, []error{err}
+		}
+		area, parseErrs := parseArea(path.Join(dir, name), file)
+		file.Close()
+		areas = append(areas, area)
+		errs = append(errs, parseErrs...)
+	}
+	
+	world, linkErrs := linkWorld(areas)
+	return world, append(errs, linkErrs...)
+}
+
+// parseArea reads one area file. It returns what it could make of the file
+// along with every problem found.
+func parseArea(name string, r io.Reader) (*areaFile, []error) {
+	area := &areaFile{name: name}
+	var errs []error
+	var room *roomDef
+	var item *itemProto
+	var monster *monsterProto
+	var shop *shopDef
+	
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(text, "#") && room == nil && item == nil && monster == nil && shop == nil {
+			area.header = append(area.header, text)
+		}
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		pos := filePos{name, line}
+		keyword, value := splitKeyword(text)
+		
+		switch keyword {
+		case "room", "item", "monster", "shop":
+			if !validID(value) {
+				errs = append(errs, pos.errorf("%s id %q must be lower case letters, digits and underscores", keyword, value))
+			}
+			room, item, monster, shop = nil, nil, nil, nil
+			switch keyword {
+			case "room":
+				room = &roomDef{id: value, pos: pos}
+				area.rooms = append(area.rooms, room)
+			case "item":
+				item = &itemProto{id: value, pos: pos, itemType: "misc"}
+				area.items = append(area.items, item)
+			case "monster":
+				monster = &monsterProto{id: value, pos: pos}
+				area.monsters = append(area.monsters, monster)
+			case "shop":
+				shop = &shopDef{id: value, pos: pos, markup: 100, offer: 50}
+				area.shops = append(area.shops, shop)
+			}
+			continue
+		}
+		
+		var err error
+		switch {
+		case room != nil:
+			err = room.set(keyword, value, pos)
+		case item != nil:
+			err = item.set(keyword, value)
+		case monster != nil:
+			err = monster.set(keyword, value, pos)
+		case shop != nil:
+			err = shop.set(keyword, value, pos)
+		case keyword == "reset":
+			area.reset, err = parseInterval(keyword, value)
+		default:
+			err = fmt.Errorf("%q outside of a room, item, monster or shop", keyword)
+		}
+		if err != nil {
+			errs = append(errs, pos.errorf("%v", err))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		errs = append(errs, fmt.Errorf("%s: %w", name, err))
+	}
+	
+	for _, room := range area.rooms {
+		if room.name == "" {
+			errs = append(errs, room.pos.errorf("room %s has no name", room.id))
+		}
+	}
+	for _, item := range area.items {
+		if item.name == "" {
+			errs = append(errs, item.pos.errorf("item %s has no name", item.id))
+		}
+	}
+	for _, monster := range area.monsters {
+		if monster.name == "" {
+			errs = append(errs, monster.pos.errorf("monster %s has no name", monster.id))
+		}
+		if monster.health <= 0 {
+			errs = append(errs, monster.pos.errorf("monster %s needs a positive health", monster.id))
+		}
+	}
+	for _, shop := range area.shops {
+		if shop.keeper == "" {
+			errs = append(errs, shop.pos.errorf("shop %s has no keeper", shop.id))
+		}
+		if shop.room == "" {
+			errs = append(errs, shop.pos.errorf("shop %s is not at any room", shop.id))
+		}
+		if shop.offer > shop.markup {
+			errs = append(errs, shop.pos.errorf("shop %s offers more than it charges (offer %d, markup %d)", shop.id, shop.offer, shop.markup))
+		}
+	}
+	return area, errs
+}
+
+// format writes the area back out as an area file. Of the comments, only
+// the ones at the top of the file are kept.
+func (a *areaFile) format() []byte {
+	var b strings.Builder
+	for _, line := range a.header {
+		b.WriteString(line + "\n")
+	}
+	if a.reset != 0 {
+		fmt.Fprintf(&b, "reset %s\n", formatInterval(a.reset))
+	}
+	blocks := len(a.header)
+	block := func(format string, args ...any) {
+		if blocks > 0 {
+			b.WriteString("\n")
+		}
+		blocks++
+		fmt.Fprintf(&b, format+"\n", args...)
+	}
+	field := func(keyword string, value any) {
+		fmt.Fprintf(&b, "  %s %v\n", keyword, value)
+	}
+	
+	for _, item := range a.items {
+		block("item %s", item.id)
+		field("name", item.name)
+		if item.description != "" {
+			field("desc", item.description)
+		}
+		field("type", item.itemType)
+		if item.damage != 0 {
+			field("damage", item.damage)
+		}
+		if item.defense != 0 {
+			field("defense", item.defense)
+		}
+		if item.value != 0 {
+			field("value", item.value)
+		}
+	}
+	for _, monster := range a.monsters {
+		block("monster %s", monster.id)
+		field("name", monster.name)
+		if monster.description != "" {
+			field("desc", monster.description)
+		}
+		field("health", monster.health)
+		field("damage", monster.damage)
+		if monster.aggressive {
+			b.WriteString("  aggressive\n")
+		}
+		if monster.respawn != 0 {
+			field("respawn", formatInterval(monster.respawn))
+		}
+		for _, entry := range monster.loot {
+			field("loot", entry.String())
+		}
+		if monster.rolls != 0 {
+			field("rolls", monster.rolls)
+		}
+		for _, drop := range monster.rare {
+			field("rare", fmt.Sprintf("%s %d", drop.item, drop.oneIn))
+		}
+		if monster.goldMax != 0 {
+			field("gold", formatRange(monster.goldMin, monster.goldMax))
+		}
+	}
+	for _, room := range a.rooms {
+		block("room %s", room.id)
+		field("name", room.name)
+		if room.description != "" {
+			field("desc", room.description)
+		}
+		for _, exit := range room.exits {
+			field("exit", exit.direction+" "+exit.target)
+		}
+		for _, door := range room.doors {
+			field("door", strings.TrimSpace(door.direction+" "+door.state+" "+door.key))
+		}
+		for _, item := range room.items {
+			field("place", item.id)
+		}
+		for _, spawn := range room.spawns {
+			field("spawn", spawn.id)
+		}
+	}
+	for _, shop := range a.shops {
+		block("shop %s", shop.id)
+		field("keeper", shop.keeper)
+		field("at", shop.room)
+		for _, stock := range shop.stock {
+			field("stock", fmt.Sprintf("%s %d", stock.item, stock.count))
+		}
+		field("markup", shop.markup)
+		field("offer", shop.offer)
+		if shop.restock != 0 {
+			field("restock", formatInterval(shop.restock))
+		}
+	}
+	return []byte(b.String())
+}
+
+// splitKeyword splits a line into its first word and the rest.
+func splitKeyword(text string) (string, string) {
+	i := strings.IndexAny(text, " \t")
+	if i < 0 {
+		return text, ""
+	}
+	return text[:i], strings.TrimSpace(text[i:])
+}
+
+func validID(id string) bool {
+	if id == "" {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+func isDirection(s string) bool {
+	for _, direction := range directions {
+		if s == direction {
+			return true
+		}
+	}
+	return false
+}
+
+// appendDescription adds a desc line to a description.
+func appendDescription(description, value string) string {
+	if description == "" {
+		return value
+	}
+	return description + " " + value
+}
+
+func parseCount(keyword, value string) (int, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%s must be a whole number, got %q", keyword, value)
+	}
+	return n, nil
+}
+
+// parseRange reads a number, or a range like 1-3, of at least one.
+func parseRange(keyword, value string) (low, high int, err error) {
+	lowText, highText, isRange := strings.Cut(value, "-")
+	if !isRange {
+		highText = lowText
+	}
+	low, err = parseCount(keyword, lowText)
+	if err == nil {
+		high, err = parseCount(keyword, highText)
+	}
+	if err != nil || low == 0 || high < low {
+		return 0, 0, fmt.Errorf("%s must be a number or a range like 1-3, got %q", keyword, value)
+	}
+	return low, high, nil
+}
+
+// formatRange writes a range the way parseRange reads it.
+func formatRange(low, high int) string {
+	if low == high {
+		return strconv.Itoa(low)
+	}
+	return fmt.Sprintf("%d-%d", low, high)
+}
+
+func parseInterval(keyword, value string) (time.Duration, error) {
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("%s must be a positive duration like 90s or 10m, got %q", keyword, value)
+	}
+	return d, nil
+}
+
+// formatInterval writes a duration the way it would be typed, 10m rather
+// than 10m0s.
+func formatInterval(d time.Duration) string {
+	text := d.String()
+	if strings.HasSuffix(text, "m0s") {
+		text = strings.TrimSuffix(text, "0s")
+	}
+	if strings.HasSuffix(text, "h0m") {
+		text = strings.TrimSuffix(text, "0m")
+	}
+	return text
+}
+
+func (r *roomDef) set(keyword, value string, pos filePos) error {
+	switch keyword {
+	case "name":
+		r.name = value
+	case "desc":
+		r.description = appendDescription(r.description, value)
+	case "exit":
+		direction, target := splitKeyword(value)
+		if !isDirection(direction) {
+			return fmt.Errorf("unknown direction %q (use %s)", direction, strings.Join(directions, ", "))
+		}
+		if target == "" {
+			return fmt.Errorf("exit %s needs a room id", direction)
+		}
+		for _, exit := range r.exits {
+			if exit.direction == direction {
+				return fmt.Errorf("room %s already has an exit %s (line %d)", r.id, direction, exit.pos.line)
+			}
+		}
+		r.exits = append(r.exits, exitDef{direction, target, pos})
+	case "door":
+		fields := strings.Fields(value)
+		if len(fields) < 2 || len(fields) > 3 {
+			return fmt.Errorf("door needs a direction, a state and optionally a key")
+		}
+		door := doorDef{direction: fields[0], state: fields[1], pos: pos}
+		if len(fields) == 3 {
+			door.key = fields[2]
+		}
+		if !isDirection(door.direction) {
+			return fmt.Errorf("unknown direction %q (use %s)", door.direction, strings.Join(directions, ", "))
+		}
+		if door.state != "open" && door.state != "closed" && door.state != "locked" {
+			return fmt.Errorf("door state must be open, closed or locked, got %q", door.state)
+		}
+		if door.state == "locked" && door.key == "" {
+			return fmt.Errorf("a locked door needs a key")
+		}
+		if r.door(door.direction) != nil {
+			return fmt.Errorf("room %s already has a door %s", r.id, door.direction)
+		}
+		r.doors = append(r.doors, door)
+	case "place":
+		r.items = append(r.items, ref{value, pos})
+	case "spawn":
+		r.spawns = append(r.spawns, ref{value, pos})
+	default:
+		return fmt.Errorf("unknown room keyword %q", keyword)
+	}
+	return nil
+}
+
+func (i *itemProto) set(keyword, value string) error {
+	var err error
+	switch keyword {
+	case "name":
+		i.name = value
+	case "desc":
+		i.description = appendDescription(i.description, value)
+	case "type":
+		if value != "weapon" && value != "armor" && value != "misc" {
+			return fmt.Errorf("item type must be weapon, armor or misc, got %q", value)
+		}
+		i.itemType = value
+	case "damage":
+		i.damage, err = parseCount(keyword, value)
+	case "defense":
+		i.defense, err = parseCount(keyword, value)
+	case "value":
+		i.value, err = parseCount(keyword, value)
+	default:
+		return fmt.Errorf("unknown item keyword %q", keyword)
+	}
+	return err
+}
+
+func (m *monsterProto) set(keyword, value string, pos filePos) error {
+	var err error
+	switch keyword {
+	case "name":
+		m.name = value
+	case "desc":
+		m.description = appendDescription(m.description, value)
+	case "health":
+		m.health, err = parseCount(keyword, value)
+	case "damage":
+		m.damage, err = parseCount(keyword, value)
+	case "aggressive":
+		if value != "" {
+			return fmt.Errorf("aggressive takes no value")
+		}
+		m.aggressive = true
+	case "respawn":
+		m.respawn, err = parseInterval(keyword, value)
+	case "loot":
+		var entry lootEntry
+		entry, err = parseLoot(value, pos)
+		m.loot = append(m.loot, entry)
+	case "rolls":
+		m.rolls, err = parseCount(keyword, value)
+		if err == nil && m.rolls == 0 {
+			err = fmt.Errorf("rolls must be at least 1")
+		}
+	case "rare":
+		item, chance := splitKeyword(value)
+		drop := rareDrop{item: item, pos: pos}
+		drop.oneIn, err = parseCount(keyword, chance)
+		if err == nil && drop.oneIn == 0 {
+			err = fmt.Errorf("rare needs an item and how rare it is, like \"rare ruby 50\" for one in 50")
+		}
+		m.rare = append(m.rare, drop)
+	case "gold":
+		m.goldMin, m.goldMax, err = parseRange(keyword, value)
+	default:
+		return fmt.Errorf("unknown monster keyword %q", keyword)
+	}
+	return err
+}
+
+// parseLoot reads a loot line: an item (or "nothing"), its weight and
+// optionally how many drop, as a number or a range like 1-3.
+func parseLoot(value string, pos filePos) (lootEntry, error) {
+	fields := strings.Fields(value)
+	entry := lootEntry{min: 1, max: 1, pos: pos}
+	if len(fields) < 2 || len(fields) > 3 {
+		return entry, fmt.Errorf("loot needs an item, a weight and optionally how many, like \"loot bone 30 1-3\"")
+	}
+	if fields[0] != "nothing" {
+		entry.item = fields[0]
+	}
+	weight, err := parseCount("loot weight", fields[1])
+	if err != nil || weight == 0 {
+		return entry, fmt.Errorf("loot weight must be a positive number, got %q", fields[1])
+	}
+	entry.weight = weight
+	if len(fields) == 3 {
+		entry.min, entry.max, err = parseRange("loot quantity", fields[2])
+	}
+	return entry, err
+}
+
+// String writes the entry the way it appears in an area file.
+func (e lootEntry) String() string {
+	item := e.item
+	if item == "" {
+		item = "nothing"
+	}
+	if e.min == 1 && e.max == 1 {
+		return fmt.Sprintf("%s %d", item, e.weight)
+	}
+	return fmt.Sprintf("%s %d %s", item, e.weight, formatRange(e.min, e.max))
+}
+
+func (s *shopDef) set(keyword, value string, pos filePos) error {
+	var err error
+	switch keyword {
+	case "keeper":
+		s.keeper = value
+	case "at":
+		s.room, s.roomPos = value, pos
+	case "stock":
+		item, count := splitKeyword(value)
+		stock := stockDef{item: item, pos: pos}
+		stock.count, err = parseCount(keyword, count)
+		if err == nil && stock.count == 0 {
+			err = fmt.Errorf("stock needs an item and how many to keep, like \"stock wooden_mug 3\"")
+		}
+		s.stock = append(s.stock, stock)
+	case "markup":
+		s.markup, err = parseCount(keyword, value)
+	case "offer":
+		s.offer, err = parseCount(keyword, value)
+	case "restock":
+		s.restock, err = parseInterval(keyword, value)
+	default:
+		return fmt.Errorf("unknown shop keyword %q", keyword)
+	}
+	return err
+}
+
+// linkWorld indexes the areas by id and checks that every reference
+// between them resolves.
+func linkWorld(areas []*areaFile) (*worldData, []error) {
+	world := &worldData{
+		areas:    areas,
+		rooms:    make(map[string]*roomDef),
+		items:    make(map[string]*itemProto),
+		monsters: make(map[string]*monsterProto),
+		shops:    make(map[string]*shopDef),
+	}
+	var errs []error
+	for _, area := range areas {
+		for _, room := range area.rooms {
+			if first := world.rooms[room.id]; first != nil {
+				errs = append(errs, room.pos.errorf("room %s is already defined at %s", room.id, first.pos))
+				continue
+			}
+			world.rooms[room.id] = room
+		}
+		for _, item := range area.items {
+			if first := world.items[item.id]; first != nil {
+				errs = append(errs, item.pos.errorf("item %s is already defined at %s", item.id, first.pos))
+				continue
+			}
+			world.items[item.id] = item
+		}
+		for _, monster := range area.monsters {
+			if first := world.monsters[monster.id]; first != nil {
+				errs = append(errs, monster.pos.errorf("monster %s is already defined at %s", monster.id, first.pos))
+				continue
+			}
+			world.monsters[monster.id] = monster
+		}
+		for _, shop := range area.shops {
+			if first := world.shops[shop.id]; first != nil {
+				errs = append(errs, shop.pos.errorf("shop %s is already defined at %s", shop.id, first.pos))
+				continue
+			}
+			world.shops[shop.id] = shop
+		}
+	}
+	
+	shopRooms := make(map[string]*shopDef)
+	for _, area := range areas {
+		for _, room := range area.rooms {
+			for _, exit := range room.exits {
+				if world.rooms[exit.target] == nil {
+					errs = append(errs, exit.pos.errorf("exit %s leads to unknown room %q", exit.direction, exit.target))
+				}
+			}
+			for _, door := range room.doors {
+				errs = append(errs, world.checkDoor(room, door)...)
+			}
+			for _, item := range room.items {
+				if world.items[item.id] == nil {
+					errs = append(errs, item.pos.errorf("unknown item %q", item.id))
+				}
+			}
+			for _, spawn := range room.spawns {
+				if world.monsters[spawn.id] == nil {
+					errs = append(errs, spawn.pos.errorf("unknown monster %q", spawn.id))
+				}
+			}
+		}
+		for _, monster := range area.monsters {
+			for _, entry := range monster.loot {
+				if entry.item != "" && world.items[entry.item] == nil {
+					errs = append(errs, entry.pos.errorf("monster %s drops unknown item %q", monster.id, entry.item))
+				}
+			}
+			for _, drop := range monster.rare {
+				if world.items[drop.item] == nil {
+					errs = append(errs, drop.pos.errorf("monster %s drops unknown item %q", monster.id, drop.item))
+				}
+			}
+		}
+		for _, shop := range area.shops {
+			errs = append(errs, world.checkShop(shop)...)
+			if first := shopRooms[shop.room]; first != nil && shop.room != "" {
+				errs = append(errs, shop.roomPos.errorf("room %s already has shop %s", shop.room, first.id))
+				continue
+			}
+			shopRooms[shop.room] = shop
+		}
+	}
+	return world, errs
+}
+
+// checkDoor checks that a door stands in an exit, that its key exists and
+// that the room on the other side doesn't define the same door.
+func (w *worldData) checkDoor(room *roomDef, door doorDef) []error {
+	var errs []error
+	if door.key != "" && w.items[door.key] == nil {
+		errs = append(errs, door.pos.errorf("door %s needs unknown item %q", door.direction, door.key))
+	}
+	exit := room.exit(door.direction)
+	if exit == nil {
+		return append(errs, door.pos.errorf("door %s but room %s has no exit %s", door.direction, room.id, door.direction))
+	}
+	target := w.rooms[exit.target]
+	if target == nil {
+		return errs
+	}
+	back := reverseDirections[door.direction]
+	if other := target.door(back); other != nil && target.exit(back) != nil && target.exit(back).target == room.id {
+		if other.pos.file < door.pos.file || other.pos.file == door.pos.file && other.pos.line < door.pos.line {
+			errs = append(errs, door.pos.errorf("the door between %s and %s is already defined at %s", room.id, target.id, other.pos))
+		}
+	}
+	return errs
+}
+
+// checkShop checks that a shop's room exists and that it only stocks items
+// that are worth something.
+func (w *worldData) checkShop(shop *shopDef) []error {
+	var errs []error
+	if shop.room != "" && w.rooms[shop.room] == nil {
+		errs = append(errs, shop.roomPos.errorf("shop %s is in unknown room %q", shop.id, shop.room))
+	}
+	for _, stock := range shop.stock {
+		item := w.items[stock.item]
+		switch {
+		case item == nil:
+			errs = append(errs, stock.pos.errorf("shop %s stocks unknown item %q", shop.id, stock.item))
+		case item.value == 0:
+			errs = append(errs, stock.pos.errorf("shop %s stocks item %s, which has no value", shop.id, stock.item))
+		}
+	}
+	return errs
+}
+
+// door returns the room's door in a direction, or nil.
+func (r *roomDef) door(direction string) *doorDef {
+	for i := range r.doors {
+		if r.doors[i].direction == direction {
+			return &r.doors[i]
+		}
+	}
+	return nil
+}
+
+// newDoor creates a door in the state the definition starts it in.
+func (w *worldData) newDoor(def doorDef) *Door {
+	door := &Door{
+		closed: def.state != "open",
+		locked: def.state == "locked",
+	}
+	if w.items[def.key] != nil {
+		door.key = def.key
+	}
+	return door
+}
+
+func (m *monsterProto) newMonster() *Monster {
+	monster := NewMonster(m.name, m.description, m.health, m.damage, m.aggressive)
+	monster.proto = m.id
+	monster.respawn = m.respawn
+	return monster
+}
+
+// buildWorld creates the rooms, items and monsters of a loaded world.
+func (g *Game) buildWorld(world *worldData) {
+	g.world = world
+	g.rooms = world.build()
+	g.layout = layoutRooms(g.rooms, g.config.Player.StartRoom)
+}
+
+// build creates the rooms of a world, with their items and monsters.
+func (w *worldData) build() map[string]*Room {
+	rooms := make(map[string]*Room)
+	for _, area := range w.areas {
+		for _, def := range area.rooms {
+			if w.rooms[def.id] != def {
+				continue
+			}
+			rooms[def.id] = &Room{
+				id:          def.id,
+				area:        area.id(),
+				name:        def.name,
+				description: def.description,
+				players:     make([]*Player, 0),
+				items:       make([]*Item, 0),
+				monsters:    make([]*Monster, 0),
+				exits:       make(map[string]*Room),
+				doors:       make(map[string]*Door),
+			}
+		}
+	}
+	for id, def := range w.rooms {
+		room := rooms[id]
+		for _, exit := range def.exits {
+			if target := rooms[exit.target]; target != nil {
+				room.exits[exit.direction] = target
+			}
+		}
+		for _, item := range def.items {
+			if proto := w.items[item.id]; proto != nil {
+				room.items = append(room.items, proto.newItem())
+			}
+		}
+		for _, spawn := range def.spawns {
+			if proto := w.monsters[spawn.id]; proto != nil {
+				monster := proto.newMonster()
+				monster.location = room
+				room.monsters = append(room.monsters, monster)
+			}
+		}
+	}
+	for _, area := range w.areas {
+		for _, def := range area.shops {
+			if room := rooms[def.room]; room != nil && room.shop == nil && w.shops[def.id] == def {
+				room.shop = w.newShop(def)
+			}
+		}
+	}
+	
+	// Doors go in once every exit is there, so each can be shared with the
+	// way back.
+	for id, def := range w.rooms {
+		room := rooms[id]
+		for _, doorDef := range def.doors {
+			target := room.exits[doorDef.direction]
+			if target == nil || room.doors[doorDef.direction] != nil {
+				continue
+			}
+			door := w.newDoor(doorDef)
+			room.doors[doorDef.direction] = door
+			if back := reverseDirections[doorDef.direction]; target.exits[back] == room {
+				target.doors[back] = door
+			}
+		}
+	}
+	return rooms
+}
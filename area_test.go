@@ -0,0 +1,133 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestDefaultWorldFiles(t *testing.T) {
+	world, err := loadWorldFiles("")
+	if err != nil {
+		t.Fatalf("Built-in world failed to load: %v", err)
+	}
+	if len(world.rooms) != 20 {
+		t.Errorf("Expected 20 rooms, got %d", len(world.rooms))
+	}
+	
+	game := NewGame()
+	forest := game.rooms["forest"]
+	if len(forest.monsters) != 2 || forest.monsters[0].name != "giant rat" || forest.monsters[1].name != "dire wolf" {
+		t.Errorf("Expected the rat and the wolf in the forest, got %v", forest.monsters)
+	}
+	if forest.monsters[0].proto != "giant_rat" || forest.monsters[0].location != forest {
+		t.Error("Expected spawned monsters to know their definition and room")
+	}
+	if forest.exits["down"] != game.rooms["dungeon"] {
+		t.Error("Expected exits to cross area files")
+	}
+	sword := game.rooms["deep_forest"].items[0]
+	if sword.name != "iron sword" || sword.itemType != "weapon" || sword.damage != 8 {
+		t.Errorf("Unexpected item %+v", sword)
+	}
+}
+
+func TestWorldFileErrors(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a.area": {Data: []byte(`# first area
+room hall
+  name Hall
+  desc A long hall.
+  desc It echoes.
+  exit north yard
+  exit sideways hall
+  place lamp
+  spawn ghost
+
+item lamp
+  name lamp
+  damage lots
+`)},
+		"b.area": {Data: []byte(`room hall
+  name Another Hall
+colour red
+`)},
+	}
+	_, err := loadWorldData(fstest.MapFS(fsys), "areas")
+	if err == nil {
+		t.Fatal("Expected errors")
+	}
+	for _, want := range []string{
+		`areas/a.area:7: unknown direction "sideways"`,
+		`areas/a.area:13: damage must be a whole number`,
+		`areas/a.area:6: exit north leads to unknown room "yard"`,
+		`areas/a.area:9: unknown monster "ghost"`,
+		`areas/b.area:1: room hall is already defined at areas/a.area:2`,
+		`areas/b.area:3: unknown room keyword "colour"`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected error %q in:\n%v", want, err)
+		}
+	}
+	if strings.Contains(err.Error(), `unknown item "lamp"`) {
+		t.Error("Items defined later in a file should still resolve")
+	}
+}
+
+func TestWorldDirConfig(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "tiny.area"), []byte(`room cell
+  name A Cell
+  desc Four walls
+  desc and a door.
+  exit north yard
+  place spoon
+
+room yard
+  name The Yard
+  desc Open sky at last.
+  exit south cell
+
+item spoon
+  name bent spoon
+  desc Good for digging.
+`), 0644)
+
+	config := testConfig(t)
+	config.World.Dir = dir
+	config.Player.StartRoom = "cell"
+	config.Player.RespawnRoom = "cell"
+	game := newTestGame(t, config)
+	if len(game.rooms) != 2 || game.rooms["cell"].exits["north"] != game.rooms["yard"] {
+		t.Errorf("Expected the two-room world from %s", dir)
+	}
+	if game.rooms["cell"].description != "Four walls and a door." {
+		t.Errorf("Unexpected description %q", game.rooms["cell"].description)
+	}
+	
+	config.Player.StartRoom = "town_square"
+	if _, err := NewGameWithConfig(config); err == nil {
+		t.Error("Expected an error for a start room missing from the world files")
+	}
+	
+	config.World.Dir = t.TempDir()
+	if _, err := NewGameWithConfig(config); err == nil {
+		t.Error("Expected an error for a directory without area files")
+	}
+}
+
+func TestAreaFormatRoundTrip(t *testing.T) {
+	names, _ := defaultWorld.ReadDir("world")
+	for _, entry := range names {
+		data, _ := defaultWorld.ReadFile("world/" + entry.Name())
+		area, errs := parseArea(entry.Name(), strings.NewReader(string(data)))
+		if len(errs) > 0 {
+			t.Fatalf("%s: %v", entry.Name(), errs)
+		}
+		if got := string(area.format()); got != string(data) {
+			t.Errorf("%s does not survive being parsed and written back:\n%s", entry.Name(), got)
+		}
+	}
+}
@@ -0,0 +1,463 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// newRoomName is what a freshly dug room is called until a builder names
+// it.
+const newRoomName = "An Unfinished Room"
+
+const buildHelp = `Building commands:
+  build dig <direction> <room id>      create a room and link it both ways
+  build name <text>                    rename this room
+  build desc <text>                    describe this room
+  build link <direction> <room id> [oneway]
+  build unlink <direction>             remove an exit (and the way back)
+  build place <item id>                add an item that lies here
+  build spawn <monster id>             add a monster that lives here
+  build list items|monsters            show the ids you can place or spawn
+  build undo                           take back your last change
+  build save                           write changed areas to the world files`
+
+// buildChange is one change a builder made to the world, with what it
+// takes to reverse it.
+type buildChange struct {
+	builder string
+	what    string
+	area    *areaFile
+	
+	// undo reverses the change, or explains why it can't.
+	undo func() error
+}
+
+// handleBuild runs the build command. Every change is made to both the
+// world data, so it can be saved, and the live rooms, so players see it at
+// once.
+func (g *Game) handleBuild(p *Player, args []string) {
+	if !g.isBuilder(p) {
+		p.SendMessage(ColorError("Only builders can do that."))
+		return
+	}
+	if len(args) == 0 || args[0] == "help" {
+		p.SendMessage(buildHelp)
+		return
+	}
+	
+	room := p.location
+	def := g.world.rooms[room.id]
+	area := g.world.area(room.area)
+	if def == nil || area == nil {
+		p.SendMessage(ColorError("This room isn't part of the world files."))
+		return
+	}
+	
+	var change *buildChange
+	var err error
+	rest := strings.Join(args[1:], " ")
+	switch strings.ToLower(args[0]) {
+	case "dig":
+		change, err = g.buildDig(room, def, area, args[1:])
+	case "name":
+		change, err = g.buildName(room, def, rest)
+	case "desc":
+		change, err = g.buildDescription(room, def, rest)
+	case "link":
+		change, err = g.buildLink(room, def, args[1:])
+	case "unlink":
+		change, err = g.buildUnlink(room, def, rest)
+	case "place":
+		change, err = g.buildPlace(room, def, rest)
+	case "spawn":
+		change, err = g.buildSpawn(room, def, rest)
+	case "list":
+		g.buildList(p, rest)
+		return
+	case "undo":
+		g.buildUndo(p)
+		return
+	case "save":
+		g.buildSave(p)
+		return
+	default:
+		p.SendMessage(ColorError(fmt.Sprintf("Unknown build command %q. Type 'build' for a list.", args[0])))
+		return
+	}
+	if err != nil {
+		p.SendMessage(ColorError(buildMessage(err)))
+		return
+	}
+	
+	change.builder = p.name
+	if change.area == nil {
+		change.area = area
+	}
+	g.buildLog = append(g.buildLog, *change)
+	g.unsaved[change.area] = true
+	g.layout = layoutRooms(g.rooms, g.config.Player.StartRoom)
+	p.SendMessage(ColorSuccess(change.what + "."))
+	room.Broadcast(ColorInfo(fmt.Sprintf("%s reshapes the world around you.", ColorName(p.name))), p)
+}
+
+// buildMessage is how a failed build command is reported to the builder:
+// as a sentence, or as the usage line it is.
+func buildMessage(err error) string {
+	message := err.Error()
+	if rest, ok := strings.CutPrefix(message, "usage: "); ok {
+		return "Usage: " + rest
+	}
+	return strings.ToUpper(message[:1]) + message[1:] + "."
+}
+
+func (g *Game) buildDig(room *Room, def *roomDef, area *areaFile, args []string) (*buildChange, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("usage: build dig <direction> <room id>")
+	}
+	direction, id := args[0], args[1]
+	back := reverseDirections[direction]
+	switch {
+	case !isDirection(direction):
+		return nil, fmt.Errorf("%q is not a direction", direction)
+	case room.exits[direction] != nil:
+		return nil, fmt.Errorf("there is already an exit %s", direction)
+	case !validID(id):
+		return nil, fmt.Errorf("room ids are lower case letters, digits and underscores")
+	case g.world.rooms[id] != nil:
+		return nil, fmt.Errorf("there is already a room %s", id)
+	}
+	
+	pos := filePos{area.name, 0}
+	newDef := &roomDef{id: id, pos: pos, name: newRoomName}
+	newDef.setExit(back, room.id, pos)
+	area.rooms = append(area.rooms, newDef)
+	g.world.rooms[id] = newDef
+	def.setExit(direction, id, pos)
+	
+	newRoom := &Room{
+		id:       id,
+		area:     area.id(),
+		name:     newRoomName,
+		players:  make([]*Player, 0),
+		items:    make([]*Item, 0),
+		monsters: make([]*Monster, 0),
+		exits:    map[string]*Room{back: room},
+		doors:    make(map[string]*Door),
+	}
+	g.rooms[id] = newRoom
+	room.exits[direction] = newRoom
+	
+	return &buildChange{
+		what: fmt.Sprintf("You dig %s to a new room, %s", direction, id),
+		undo: func() error {
+			if len(newRoom.players) > 0 {
+				return fmt.Errorf("someone is still in %s", id)
+			}
+			for _, other := range g.rooms {
+				if other != room && other != newRoom && other.hasExitTo(newRoom) {
+					return fmt.Errorf("other rooms now lead to %s; unlink them first", id)
+				}
+			}
+			def.removeExit(direction)
+			delete(room.exits, direction)
+			area.rooms = removeRoomDef(area.rooms, newDef)
+			delete(g.world.rooms, id)
+			delete(g.rooms, id)
+			return nil
+		},
+	}, nil
+}
+
+func (g *Game) buildName(room *Room, def *roomDef, name string) (*buildChange, error) {
+	if name == "" {
+		return nil, fmt.Errorf("usage: build name <text>")
+	}
+	old := def.name
+	def.name, room.name = name, name
+	return &buildChange{
+		what: fmt.Sprintf("The room is now called %s", name),
+		undo: func() error {
+			def.name, room.name = old, old
+			return nil
+		},
+	}, nil
+}
+
+func (g *Game) buildDescription(room *Room, def *roomDef, description string) (*buildChange, error) {
+	if description == "" {
+		return nil, fmt.Errorf("usage: build desc <text>")
+	}
+	old := def.description
+	def.description, room.description = description, description
+	return &buildChange{
+		what: "The room's description is updated",
+		undo: func() error {
+			def.description, room.description = old, old
+			return nil
+		},
+	}, nil
+}
+
+func (g *Game) buildLink(room *Room, def *roomDef, args []string) (*buildChange, error) {
+	if len(args) < 2 || len(args) > 3 || len(args) == 3 && args[2] != "oneway" {
+		return nil, fmt.Errorf("usage: build link <direction> <room id> [oneway]")
+	}
+	direction, id := args[0], args[1]
+	target, targetDef := g.rooms[id], g.world.rooms[id]
+	switch {
+	case !isDirection(direction):
+		return nil, fmt.Errorf("%q is not a direction", direction)
+	case room.exits[direction] != nil:
+		return nil, fmt.Errorf("there is already an exit %s", direction)
+	case target == nil || targetDef == nil:
+		return nil, fmt.Errorf("there is no room %s", id)
+	}
+	
+	pos := filePos{g.world.area(room.area).name, 0}
+	def.setExit(direction, id, pos)
+	room.exits[direction] = target
+	back := reverseDirections[direction]
+	twoWay := len(args) == 2 && target.exits[back] == nil
+	if twoWay {
+		targetDef.setExit(back, room.id, pos)
+		target.exits[back] = room
+		g.unsaved[g.world.area(target.area)] = true
+	}
+	
+	what := fmt.Sprintf("An exit %s now leads to %s", direction, id)
+	if twoWay {
+		what += fmt.Sprintf(", and %s back", back)
+	}
+	return &buildChange{
+		what: what,
+		undo: func() error {
+			def.removeExit(direction)
+			delete(room.exits, direction)
+			if twoWay {
+				targetDef.removeExit(back)
+				delete(target.exits, back)
+				g.unsaved[g.world.area(target.area)] = true
+			}
+			return nil
+		},
+	}, nil
+}
+
+func (g *Game) buildUnlink(room *Room, def *roomDef, direction string) (*buildChange, error) {
+	target := room.exits[direction]
+	if target == nil {
+		return nil, fmt.Errorf("there is no exit %s", direction)
+	}
+	if room.doors[direction] != nil {
+		return nil, fmt.Errorf("there is a door %s; doors can only be removed in the area files", direction)
+	}
+	targetDef := g.world.rooms[target.id]
+	pos := filePos{g.world.area(room.area).name, 0}
+	back := reverseDirections[direction]
+	twoWay := target.exits[back] == room
+	
+	def.removeExit(direction)
+	delete(room.exits, direction)
+	if twoWay {
+		targetDef.removeExit(back)
+		delete(target.exits, back)
+		g.unsaved[g.world.area(target.area)] = true
+	}
+	
+	what := fmt.Sprintf("The exit %s to %s is gone", direction, target.id)
+	if twoWay {
+		what += ", and the way back"
+	}
+	return &buildChange{
+		what: what,
+		undo: func() error {
+			if room.exits[direction] != nil || twoWay && target.exits[back] != nil {
+				return fmt.Errorf("those exits have been used for something else since")
+			}
+			def.setExit(direction, target.id, pos)
+			room.exits[direction] = target
+			if twoWay {
+				targetDef.setExit(back, room.id, pos)
+				target.exits[back] = room
+				g.unsaved[g.world.area(target.area)] = true
+			}
+			return nil
+		},
+	}, nil
+}
+
+func (g *Game) buildPlace(room *Room, def *roomDef, id string) (*buildChange, error) {
+	proto := g.world.items[id]
+	if proto == nil {
+		return nil, fmt.Errorf("there is no item %q; try 'build list items'", id)
+	}
+	def.items = append(def.items, ref{id, filePos{}})
+	item := proto.newItem()
+	room.items = append(room.items, item)
+	return &buildChange{
+		what: fmt.Sprintf("%s will lie here from now on", capitalize(proto.name)),
+		undo: func() error {
+			def.items = removeRef(def.items, id)
+			for i, other := range room.items {
+				if other == item {
+					room.items = append(room.items[:i], room.items[i+1:]...)
+					break
+				}
+			}
+			return nil
+		},
+	}, nil
+}
+
+func (g *Game) buildSpawn(room *Room, def *roomDef, id string) (*buildChange, error) {
+	proto := g.world.monsters[id]
+	if proto == nil {
+		return nil, fmt.Errorf("there is no monster %q; try 'build list monsters'", id)
+	}
+	def.spawns = append(def.spawns, ref{id, filePos{}})
+	monster := proto.newMonster()
+	monster.location = room
+	room.monsters = append(room.monsters, monster)
+	return &buildChange{
+		what: fmt.Sprintf("%s will live here from now on", capitalize(proto.name)),
+		undo: func() error {
+			def.spawns = removeRef(def.spawns, id)
+			for i, other := range room.monsters {
+				if other == monster {
+					room.monsters = append(room.monsters[:i], room.monsters[i+1:]...)
+					break
+				}
+			}
+			return nil
+		},
+	}, nil
+}
+
+func (g *Game) buildList(p *Player, what string) {
+	var ids []string
+	switch what {
+	case "items":
+		for id, item := range g.world.items {
+			ids = append(ids, fmt.Sprintf("  %-20s %s", id, item.name))
+		}
+	case "monsters":
+		for id, monster := range g.world.monsters {
+			ids = append(ids, fmt.Sprintf("  %-20s %s", id, monster.name))
+		}
+	default:
+		p.SendMessage(ColorError("Usage: build list items|monsters"))
+		return
+	}
+	sort.Strings(ids)
+	p.SendMessage(strings.Join(ids, "\n"))
+}
+
+// buildUndo reverses the player's most recent change that hasn't been
+// undone.
+func (g *Game) buildUndo(p *Player) {
+	for i := len(g.buildLog) - 1; i >= 0; i-- {
+		change := g.buildLog[i]
+		if change.builder != p.name {
+			continue
+		}
+		if err := change.undo(); err != nil {
+			p.SendMessage(ColorError(fmt.Sprintf("Can't undo: %v.", err)))
+			return
+		}
+		g.buildLog = append(g.buildLog[:i], g.buildLog[i+1:]...)
+		g.unsaved[change.area] = true
+		g.layout = layoutRooms(g.rooms, g.config.Player.StartRoom)
+		p.SendMessage(ColorSuccess(fmt.Sprintf("Undone: %s.", change.what)))
+		return
+	}
+	p.SendMessage(ColorWarning("You have nothing to undo."))
+}
+
+// buildSave writes every changed area back to its file in the world
+// directory.
+func (g *Game) buildSave(p *Player) {
+	if g.config.World.Dir == "" {
+		p.SendMessage(ColorError("This server runs the built-in world. Start it with -world-dir to save changes."))
+		return
+	}
+	if len(g.unsaved) == 0 {
+		p.SendMessage(ColorInfo("There are no changes to save."))
+		return
+	}
+	var saved []string
+	for _, area := range g.world.areas {
+		if !g.unsaved[area] {
+			continue
+		}
+		file := filepath.Join(g.config.World.Dir, area.id()+".area")
+		if err := writeFileAtomic(file, area.format()); err != nil {
+			p.SendMessage(ColorError(fmt.Sprintf("Failed to save %s: %v", file, err)))
+			return
+		}
+		delete(g.unsaved, area)
+		saved = append(saved, file)
+	}
+	p.SendMessage(ColorSuccess(fmt.Sprintf("Saved %s.", strings.Join(saved, ", "))))
+}
+
+// area returns the area file with an id.
+func (w *worldData) area(id string) *areaFile {
+	for _, area := range w.areas {
+		if area.id() == id {
+			return area
+		}
+	}
+	return nil
+}
+
+// setExit adds an exit, replacing any other in the same direction.
+func (r *roomDef) setExit(direction, target string, pos filePos) {
+	r.removeExit(direction)
+	r.exits = append(r.exits, exitDef{direction, target, pos})
+}
+
+func (r *roomDef) removeExit(direction string) {
+	for i, exit := range r.exits {
+		if exit.direction == direction {
+			r.exits = append(r.exits[:i], r.exits[i+1:]...)
+			return
+		}
+	}
+}
+
+// removeRef removes the last reference to an id.
+func removeRef(refs []ref, id string) []ref {
+	for i := len(refs) - 1; i >= 0; i-- {
+		if refs[i].id == id {
+			return append(refs[:i], refs[i+1:]...)
+		}
+	}
+	return refs
+}
+
+func removeRoomDef(rooms []*roomDef, room *roomDef) []*roomDef {
+	for i, other := range rooms {
+		if other == room {
+			return append(rooms[:i], rooms[i+1:]...)
+		}
+	}
+	return rooms
+}
+
+func (r *Room) hasExitTo(target *Room) bool {
+	for _, next := range r.exits {
+		if next == target {
+			return true
+		}
+	}
+	return false
+}
+
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newBuildGame creates a game on a small world in a temporary directory
+// that the player Mason may build in.
+func newBuildGame(t *testing.T) (*Game, string) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "tiny.area"), []byte(`# A place to practise building.
+
+item spoon
+  name bent spoon
+  desc Good for digging.
+
+monster rat
+  name rat
+  desc A rat.
+  health 5
+  damage 1
+
+room cell
+  name A Cell
+  desc Four walls and a door.
+  exit north yard
+
+room yard
+  name The Yard
+  desc Open sky at last.
+  exit south cell
+`), 0644)
+
+	config := testConfig(t)
+	config.World.Dir = dir
+	config.Player.StartRoom = "cell"
+	config.Player.RespawnRoom = "cell"
+	config.Builders = []string{"mason"}
+	return newTestGame(t, config), dir
+}
+
+func lastMessage(player *Player) string {
+	messages := getPlayerMessages(player)
+	if len(messages) == 0 {
+		return ""
+	}
+	return messages[len(messages)-1]
+}
+
+func TestBuildRequiresBuilder(t *testing.T) {
+	game, _ := newBuildGame(t)
+	visitor := createMockPlayer("Visitor")
+	game.AddPlayer(visitor)
+	visitor.HandleCommand(game, "build name My Cell")
+	if !strings.Contains(lastMessage(visitor), "Only builders") {
+		t.Errorf("Expected a non-builder to be refused, got %q", lastMessage(visitor))
+	}
+	if game.rooms["cell"].name != "A Cell" {
+		t.Error("A non-builder should not be able to rename rooms")
+	}
+	
+	mason := createMockPlayer("Mason")
+	game.AddPlayer(mason)
+	mason.HandleCommand(game, "build name My Cell")
+	if game.rooms["cell"].name != "My Cell" {
+		t.Errorf("Expected the builder to rename the room, got %q", lastMessage(mason))
+	}
+	
+	mason.HandleCommand(game, "build link up nowhere")
+	if !strings.Contains(lastMessage(mason), "There is no room nowhere.") {
+		t.Errorf("Expected the error as a sentence, got %q", lastMessage(mason))
+	}
+	mason.HandleCommand(game, "build name")
+	if !strings.Contains(lastMessage(mason), "Usage: build name <text>") {
+		t.Errorf("Expected a usage line, got %q", lastMessage(mason))
+	}
+}
+
+func TestBuildDigAndSave(t *testing.T) {
+	game, dir := newBuildGame(t)
+	mason := createMockPlayer("Mason")
+	game.AddPlayer(mason)
+	
+	mason.HandleCommand(game, "build dig east shed")
+	shed := game.rooms["shed"]
+	if shed == nil || game.rooms["cell"].exits["east"] != shed || shed.exits["west"] != game.rooms["cell"] {
+		t.Fatalf("Expected a shed linked both ways, got %q", lastMessage(mason))
+	}
+	if _, ok := game.layout["shed"]; !ok {
+		t.Error("The new room should be placed on the map")
+	}
+	
+	mason.HandleCommand(game, "east")
+	mason.HandleCommand(game, "build name Garden Shed")
+	mason.HandleCommand(game, "build desc Tools hang on the walls.")
+	mason.HandleCommand(game, "build place spoon")
+	mason.HandleCommand(game, "build spawn rat")
+	mason.HandleCommand(game, "build link north yard oneway")
+	if len(shed.items) != 1 || len(shed.monsters) != 1 || shed.exits["north"] != game.rooms["yard"] {
+		t.Fatalf("Expected the shed to be furnished, got %q", lastMessage(mason))
+	}
+	if game.rooms["yard"].exits["south"] != game.rooms["cell"] {
+		t.Error("A one-way link should not change the yard")
+	}
+	
+	mason.HandleCommand(game, "build dig east cell")
+	if !strings.Contains(lastMessage(mason), "already a room") {
+		t.Errorf("Expected digging to an existing room to fail, got %q", lastMessage(mason))
+	}
+	
+	mason.HandleCommand(game, "build save")
+	if !strings.Contains(lastMessage(mason), "tiny.area") {
+		t.Fatalf("Expected the area to be saved, got %q", lastMessage(mason))
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "tiny.area"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), "# A place to practise building.\n") {
+		t.Errorf("Saving should keep the comments at the top of the file:\n%s", data)
+	}
+	
+	world, err := loadWorldFiles(dir)
+	if err != nil {
+		t.Fatalf("Saved world does not load: %v", err)
+	}
+	rooms := world.build()
+	saved := rooms["shed"]
+	if saved == nil || saved.name != "Garden Shed" || saved.description != "Tools hang on the walls." {
+		t.Fatalf("Expected the shed in the saved world, got %+v", saved)
+	}
+	if saved.exits["west"] != rooms["cell"] || saved.exits["north"] != rooms["yard"] || rooms["cell"].exits["east"] != saved {
+		t.Error("Expected the shed's exits to be saved")
+	}
+	if len(saved.items) != 1 || len(saved.monsters) != 1 {
+		t.Error("Expected the shed's spoon and rat to be saved")
+	}
+	
+	mason.HandleCommand(game, "build save")
+	if !strings.Contains(lastMessage(mason), "no changes") {
+		t.Errorf("Expected nothing to save, got %q", lastMessage(mason))
+	}
+}
+
+func TestBuildUndo(t *testing.T) {
+	game, _ := newBuildGame(t)
+	mason := createMockPlayer("Mason")
+	other := createMockPlayer("Tiler")
+	game.config.Builders = append(game.config.Builders, "tiler")
+	game.AddPlayer(mason)
+	game.AddPlayer(other)
+	
+	mason.HandleCommand(game, "build dig east shed")
+	mason.HandleCommand(game, "build name Cell Block")
+	other.HandleCommand(game, "build desc Damp.")
+	
+	// Undo takes back the builder's own changes, newest first.
+	mason.HandleCommand(game, "build undo")
+	cell := game.rooms["cell"]
+	if cell.name != "A Cell" || cell.description != "Damp." {
+		t.Errorf("Expected only the rename to be undone, got %q / %q", cell.name, cell.description)
+	}
+	
+	mason.HandleCommand(game, "east")
+	mason.HandleCommand(game, "build undo")
+	if !strings.Contains(lastMessage(mason), "Can't undo") || game.rooms["shed"] == nil {
+		t.Errorf("Expected the dig not to be undone with someone in the shed, got %q", lastMessage(mason))
+	}
+	
+	mason.HandleCommand(game, "west")
+	mason.HandleCommand(game, "build undo")
+	if game.rooms["shed"] != nil || cell.exits["east"] != nil || game.world.rooms["shed"] != nil {
+		t.Errorf("Expected the shed to be gone, got %q", lastMessage(mason))
+	}
+	
+	mason.HandleCommand(game, "build undo")
+	if !strings.Contains(lastMessage(mason), "nothing to undo") {
+		t.Errorf("Expected nothing left to undo, got %q", lastMessage(mason))
+	}
+}
+
+func TestBuildSaveNeedsWorldDir(t *testing.T) {
+	config := testConfig(t)
+	config.Builders = []string{"mason"}
+	game := newTestGame(t, config)
+	mason := createMockPlayer("Mason")
+	game.AddPlayer(mason)
+	
+	mason.HandleCommand(game, "build name Plaza")
+	mason.HandleCommand(game, "build save")
+	if !strings.Contains(lastMessage(mason), "-world-dir") {
+		t.Errorf("Expected saving the built-in world to be refused, got %q", lastMessage(mason))
+	}
+}
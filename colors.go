@@ -100,6 +100,10 @@ func ColorEquipment(text string) string {
 	return ColorBrightYellow + text + ColorReset
 }
 
+func ColorGold(text string) string {
+	return ColorYellow + text + ColorReset
+}
+
 // Helper function to colorize text with any color
 func Colorize(text, color string) string {
 	return color + text + ColorReset
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// Config holds the server settings. It is read from an optional JSON file
+// and then overridden by command-line flags; see DefaultConfig for the
+// values used when neither sets a field.
+type Config struct {
+	Telnet    string          `json:"telnet"`
+	Web       string          `json:"web"`
+	TLS       TLSSettings     `json:"tls"`
+	Tick      Duration        `json:"tick"`
+	Player    PlayerSettings  `json:"player"`
+	Accounts  AccountSettings `json:"accounts"`
+	Saves     SaveSettings    `json:"saves"`
+	World     WorldSettings   `json:"world"`
+	Log       LogSettings     `json:"log"`
+	Telemetry TelemetryConfig `json:"telemetry"`
+	
+	// ShutdownCountdown is how long players are warned before the server
+	// stops on SIGINT or SIGTERM.
+	ShutdownCountdown Duration `json:"shutdown_countdown"`
+	
+	// Admins are the player names allowed to use commands such as
+	// copyover.
+	Admins []string `json:"admins"`
+	
+	// Builders are the player names allowed to change the world with the
+	// build command. Admins are builders too.
+	Builders []string `json:"builders"`
+}
+
+type TLSSettings struct {
+	Address    string `json:"address"`
+	Cert       string `json:"cert"`
+	Key        string `json:"key"`
+	SelfSigned bool   `json:"self_signed"`
+}
+
+type PlayerSettings struct {
+	Health      int    `json:"health"`
+	Damage      int    `json:"damage"`
+	Gold        int    `json:"gold"`
+	StartRoom   string `json:"start_room"`
+	RespawnRoom string `json:"respawn_room"`
+}
+
+type AccountSettings struct {
+	Dir string `json:"dir"`
+	
+	// MaxFailures wrong passwords in a row lock an account for Lockout.
+	MaxFailures int      `json:"max_failures"`
+	Lockout     Duration `json:"lockout"`
+}
+
+type SaveSettings struct {
+	Dir string `json:"dir"`
+	
+	// Autosave is how often connected players are saved, on top of
+	// saving when they quit.
+	Autosave Duration `json:"autosave"`
+}
+
+type WorldSettings struct {
+	// Dir holds the area files the world is built from; empty means the
+	// built-in world.
+	Dir string `json:"dir"`
+	
+	// StateFile holds room contents and monster state between runs.
+	StateFile string   `json:"state_file"`
+	Save      Duration `json:"save"`
+	
+	// Fresh ignores the saved state and starts from the world as built.
+	Fresh bool `json:"fresh"`
+	
+	// Respawn is how long a killed monster stays dead, and Reset how often
+	// an area puts back its items and doors, unless the area files say
+	// otherwise.
+	Respawn Duration `json:"respawn"`
+	Reset   Duration `json:"reset"`
+	
+	// CorpseDecay is how long a killed monster's corpse, and whatever is
+	// left in it, lies before rotting away.
+	CorpseDecay Duration `json:"corpse_decay"`
+	
+	// Restock is how often a shop puts one more of each item it stocks
+	// back on sale, unless its area file says otherwise.
+	Restock Duration `json:"restock"`
+}
+
+type LogSettings struct {
+	// File receives the server log; empty means standard error.
+	File string `json:"file"`
+}
+
+type TelemetryConfig struct {
+	Enabled  bool     `json:"enabled"`
+	Interval Duration `json:"interval"`
+	
+	// DumpFile receives the statistics as JSON every interval and at
+	// shutdown.
+	DumpFile string `json:"dump_file"`
+}
+
+// Duration is a time.Duration written as a string such as "3s" in config
+// files.
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return fmt.Errorf("duration must be a string such as \"3s\"")
+	}
+	parsed, err := time.ParseDuration(text)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Telnet: ":4000",
+		Web:    ":8080",
+		Tick:   Duration(3 * time.Second),
+		Player: PlayerSettings{
+			Health:      30,
+			Damage:      5,
+			Gold:        10,
+			StartRoom:   "town_square",
+			RespawnRoom: "town_square",
+		},
+		Accounts: AccountSettings{
+			Dir:         "accounts",
+			MaxFailures: 5,
+			Lockout:     Duration(5 * time.Minute),
+		},
+		Saves: SaveSettings{
+			Dir:      "players",
+			Autosave: Duration(5 * time.Minute),
+		},
+		World: WorldSettings{
+			StateFile:   "world.json",
+			Save:        Duration(5 * time.Minute),
+			Respawn:     Duration(5 * time.Minute),
+			Reset:       Duration(15 * time.Minute),
+			CorpseDecay: Duration(5 * time.Minute),
+			Restock:     Duration(10 * time.Minute),
+		},
+		Telemetry: TelemetryConfig{
+			Enabled:  true,
+			Interval: Duration(5 * time.Minute),
+		},
+		ShutdownCountdown: Duration(10 * time.Second),
+	}
+}
+
+// LoadConfig builds the configuration from the defaults, the file named by
+// -config (if any) and the remaining flags, in that order of precedence.
+func LoadConfig(args []string) (Config, error) {
+	// The first pass only finds -config and rejects bad flags; the second
+	// applies the flags on top of the file.
+	probe := DefaultConfig()
+	fs := newConfigFlagSet(&probe)
+	configPath := fs.Lookup("config").Value.(flag.Getter)
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+	
+	config := DefaultConfig()
+	if path := configPath.Get().(string); path != "" {
+		if err := loadConfigFile(path, &config); err != nil {
+			return Config{}, err
+		}
+	}
+	
+	fs = newConfigFlagSet(&config)
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+	if fs.NArg() > 0 {
+		return Config{}, fmt.Errorf("unexpected arguments: %s", strings.Join(fs.Args(), " "))
+	}
+	
+	if err := config.Validate(); err != nil {
+		return Config{}, err
+	}
+	return config, nil
+}
+
+// PrintConfigUsage describes the command-line flags.
+func PrintConfigUsage(w io.Writer) {
+	config := DefaultConfig()
+	fs := newConfigFlagSet(&config)
+	fs.SetOutput(w)
+	fmt.Fprintln(w, "Usage: mud [flags]")
+	fs.PrintDefaults()
+}
+
+// nameList parses a comma-separated list of player names into names.
+func nameList(names *[]string) func(string) error {
+	return func(value string) error {
+		*names = nil
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				*names = append(*names, name)
+			}
+		}
+		return nil
+	}
+}
+
+// newConfigFlagSet binds the flags to config's fields. Errors are returned
+// rather than printed so that LoadConfig can parse twice.
+func newConfigFlagSet(config *Config) *flag.FlagSet {
+	fs := flag.NewFlagSet("mud", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.String("config", "", "path to a JSON configuration file")
+	fs.StringVar(&config.Telnet, "telnet", config.Telnet, "address for the telnet listener")
+	fs.StringVar(&config.Web, "web", config.Web, "address for the browser client (disabled if empty)")
+	fs.StringVar(&config.TLS.Address, "tls", config.TLS.Address, "address for the TLS telnet listener, e.g. :4443 (disabled if empty)")
+	fs.StringVar(&config.TLS.Cert, "tls-cert", config.TLS.Cert, "TLS certificate file (PEM)")
+	fs.StringVar(&config.TLS.Key, "tls-key", config.TLS.Key, "TLS private key file (PEM)")
+	fs.BoolVar(&config.TLS.SelfSigned, "tls-self-signed", config.TLS.SelfSigned, "generate a self-signed certificate for development if none exists")
+	fs.DurationVar((*time.Duration)(&config.Tick), "tick", time.Duration(config.Tick), "interval between monster AI ticks")
+	fs.IntVar(&config.Player.Health, "start-health", config.Player.Health, "health of a new character")
+	fs.IntVar(&config.Player.Damage, "start-damage", config.Player.Damage, "base damage of a new character")
+	fs.IntVar(&config.Player.Gold, "start-gold", config.Player.Gold, "gold a new character starts with")
+	fs.StringVar(&config.Player.StartRoom, "start-room", config.Player.StartRoom, "room id where players enter the game")
+	fs.StringVar(&config.Player.RespawnRoom, "respawn-room", config.Player.RespawnRoom, "room id where players respawn after death")
+	fs.StringVar(&config.Accounts.Dir, "accounts-dir", config.Accounts.Dir, "directory where accounts are stored")
+	fs.IntVar(&config.Accounts.MaxFailures, "max-login-failures", config.Accounts.MaxFailures, "failed logins before an account is locked (0 never locks)")
+	fs.DurationVar((*time.Duration)(&config.Accounts.Lockout), "lockout", time.Duration(config.Accounts.Lockout), "how long a locked account stays locked")
+	fs.StringVar(&config.Saves.Dir, "players-dir", config.Saves.Dir, "directory where player saves are stored")
+	fs.DurationVar((*time.Duration)(&config.Saves.Autosave), "autosave", time.Duration(config.Saves.Autosave), "interval between saves of connected players")
+	fs.StringVar(&config.World.Dir, "world-dir", config.World.Dir, "directory of area files to build the world from (default built-in)")
+	fs.StringVar(&config.World.StateFile, "world-state", config.World.StateFile, "file where room contents and monster state are saved")
+	fs.DurationVar((*time.Duration)(&config.World.Save), "world-save", time.Duration(config.World.Save), "interval between world state saves")
+	fs.BoolVar(&config.World.Fresh, "fresh", config.World.Fresh, "ignore the saved world state and start fresh")
+	fs.DurationVar((*time.Duration)(&config.World.Respawn), "respawn", time.Duration(config.World.Respawn), "how long killed monsters stay dead")
+	fs.DurationVar((*time.Duration)(&config.World.Reset), "reset", time.Duration(config.World.Reset), "interval between area resets")
+	fs.DurationVar((*time.Duration)(&config.World.CorpseDecay), "corpse-decay", time.Duration(config.World.CorpseDecay), "how long corpses last")
+	fs.DurationVar((*time.Duration)(&config.World.Restock), "restock", time.Duration(config.World.Restock), "interval between shop restocks")
+	fs.StringVar(&config.Log.File, "log-file", config.Log.File, "write the server log to this file instead of standard error")
+	fs.BoolVar(&config.Telemetry.Enabled, "telemetry", config.Telemetry.Enabled, "log telemetry statistics periodically")
+	fs.DurationVar((*time.Duration)(&config.Telemetry.Interval), "telemetry-interval", time.Duration(config.Telemetry.Interval), "interval between telemetry reports")
+	fs.Func("admins", "comma-separated player names with admin commands", nameList(&config.Admins))
+	fs.Func("builders", "comma-separated player names allowed to build", nameList(&config.Builders))
+	fs.StringVar(&config.Telemetry.DumpFile, "telemetry-dump", config.Telemetry.DumpFile, "write telemetry as JSON to this file every interval and at shutdown")
+	fs.DurationVar((*time.Duration)(&config.ShutdownCountdown), "shutdown-countdown", time.Duration(config.ShutdownCountdown), "warning period before shutting down on SIGINT/SIGTERM")
+	return fs
+}
+
+func loadConfigFile(path string, config *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(strings.NewReader(string(data)))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(config); err != nil {
+		var syntaxErr *json.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			line := 1 + strings.Count(string(data[:syntaxErr.Offset]), "\n")
+			return fmt.Errorf("%s:%d: %v", path, line, err)
+		}
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	return nil
+}
+
+// Validate reports every problem with the configuration at once, so they
+// can all be fixed before the next start.
+func (c Config) Validate() error {
+	var problems []string
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			problems = append(problems, fmt.Sprintf(format, args...))
+		}
+	}
+	validAddress := func(address string) bool {
+		_, port, err := net.SplitHostPort(address)
+		return err == nil && port != ""
+	}
+	
+	check(validAddress(c.Telnet), "telnet: invalid listen address %q", c.Telnet)
+	check(c.Web == "" || validAddress(c.Web), "web: invalid listen address %q", c.Web)
+	if c.TLS.Address != "" {
+		check(validAddress(c.TLS.Address), "tls.address: invalid listen address %q", c.TLS.Address)
+		check((c.TLS.Cert == "") == (c.TLS.Key == ""), "tls: cert and key must be given together")
+		check(c.TLS.Cert != "" || c.TLS.SelfSigned, "tls: needs cert and key, or self_signed")
+	}
+	check(c.Tick > 0, "tick: must be positive, got %v", time.Duration(c.Tick))
+	check(c.Player.Health > 0, "player.health: must be positive, got %d", c.Player.Health)
+	check(c.Player.Damage >= 0, "player.damage: must not be negative, got %d", c.Player.Damage)
+	check(c.Player.Gold >= 0, "player.gold: must not be negative, got %d", c.Player.Gold)
+	check(c.Player.StartRoom != "", "player.start_room: must not be empty")
+	check(c.Player.RespawnRoom != "", "player.respawn_room: must not be empty")
+	check(c.Accounts.Dir != "", "accounts.dir: must not be empty")
+	check(c.Accounts.MaxFailures >= 0, "accounts.max_failures: must not be negative, got %d", c.Accounts.MaxFailures)
+	check(c.Accounts.MaxFailures == 0 || c.Accounts.Lockout > 0, "accounts.lockout: must be positive, got %v", time.Duration(c.Accounts.Lockout))
+	check(c.Saves.Dir != "", "saves.dir: must not be empty")
+	check(c.Saves.Autosave > 0, "saves.autosave: must be positive, got %v", time.Duration(c.Saves.Autosave))
+	check(c.World.StateFile != "", "world.state_file: must not be empty")
+	check(c.World.Save > 0, "world.save: must be positive, got %v", time.Duration(c.World.Save))
+	check(c.World.Respawn > 0, "world.respawn: must be positive, got %v", time.Duration(c.World.Respawn))
+	check(c.World.Reset > 0, "world.reset: must be positive, got %v", time.Duration(c.World.Reset))
+	check(c.World.CorpseDecay > 0, "world.corpse_decay: must be positive, got %v", time.Duration(c.World.CorpseDecay))
+	check(c.World.Restock > 0, "world.restock: must be positive, got %v", time.Duration(c.World.Restock))
+	check(!c.Telemetry.Enabled || c.Telemetry.Interval > 0, "telemetry.interval: must be positive, got %v", time.Duration(c.Telemetry.Interval))
+	check(c.ShutdownCountdown >= 0, "shutdown_countdown: must not be negative, got %v", time.Duration(c.ShutdownCountdown))
+	
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid configuration:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
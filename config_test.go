@@ -0,0 +1,104 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfigFile(t *testing.T, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "mud.json")
+	if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	return path
+}
+
+func TestDefaultConfigValid(t *testing.T) {
+	config, err := LoadConfig(nil)
+	if err != nil {
+		t.Fatalf("Default configuration should be valid: %v", err)
+	}
+	if config.Telnet != ":4000" || time.Duration(config.Tick) != 3*time.Second {
+		t.Errorf("Unexpected defaults: %+v", config)
+	}
+}
+
+func TestConfigFileAndFlags(t *testing.T) {
+	path := writeConfigFile(t, `{
+  "telnet": ":5000",
+  "tick": "500ms",
+  "player": {"health": 50, "start_room": "tavern"}
+}`)
+
+	config, err := LoadConfig([]string{"-config", path, "-tick", "2s", "-start-damage", "7"})
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if config.Telnet != ":5000" {
+		t.Errorf("Expected telnet from file, got %q", config.Telnet)
+	}
+	if time.Duration(config.Tick) != 2*time.Second {
+		t.Errorf("Expected flag to override tick, got %v", time.Duration(config.Tick))
+	}
+	if config.Player.Health != 50 || config.Player.Damage != 7 {
+		t.Errorf("Expected health 50 and damage 7, got %d and %d", config.Player.Health, config.Player.Damage)
+	}
+	if config.Player.RespawnRoom != "town_square" {
+		t.Errorf("Expected default respawn room to be kept, got %q", config.Player.RespawnRoom)
+	}
+}
+
+func TestConfigValidation(t *testing.T) {
+	path := writeConfigFile(t, `{"telnet": "nowhere", "tick": "0s", "player": {"health": 0}, "tls": {"address": ":4443"}}`)
+	
+	_, err := LoadConfig([]string{"-config", path})
+	if err == nil {
+		t.Fatal("Expected validation errors")
+	}
+	for _, expected := range []string{"telnet:", "tick:", "player.health:", "tls: needs cert"} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected error to mention %q, got:\n%v", expected, err)
+		}
+	}
+}
+
+func TestConfigFileErrors(t *testing.T) {
+	path := writeConfigFile(t, "{\n  \"telnet\": \":4000\",\n  oops\n}")
+	if _, err := LoadConfig([]string{"-config", path}); err == nil || !strings.Contains(err.Error(), "mud.json:3") {
+		t.Errorf("Expected error with file and line, got %v", err)
+	}
+	
+	path = writeConfigFile(t, `{"tick_rate": "1s"}`)
+	if _, err := LoadConfig([]string{"-config", path}); err == nil || !strings.Contains(err.Error(), "tick_rate") {
+		t.Errorf("Expected unknown field error, got %v", err)
+	}
+}
+
+func TestConfigUnknownRoom(t *testing.T) {
+	config := DefaultConfig()
+	config.Player.RespawnRoom = "nowhere"
+	if _, err := NewGameWithConfig(config); err == nil || !strings.Contains(err.Error(), "respawn_room") {
+		t.Errorf("Expected unknown respawn room error, got %v", err)
+	}
+}
+
+func TestConfigRespawnRoom(t *testing.T) {
+	config := DefaultConfig()
+	config.Player.RespawnRoom = "temple"
+	game, err := NewGameWithConfig(config)
+	if err != nil {
+		t.Fatalf("Failed to create game: %v", err)
+	}
+	
+	player := createTestPlayer("Fallen")
+	game.AddPlayer(player)
+	game.respawnPlayer(player)
+	
+	if player.location != game.rooms["temple"] {
+		t.Errorf("Expected respawn in temple, got %s", player.location.name)
+	}
+}
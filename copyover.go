@@ -0,0 +1,257 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"time"
+)
+
+const (
+	// copyoverEnv names the environment variable that tells a freshly
+	// exec'd server where to find the state left by the process it
+	// replaced.
+	copyoverEnv = "MUD_COPYOVER"
+	
+	// copyoverFlushTimeout bounds how long a copyover waits, for all
+	// players together, for their queued output to be written.
+	copyoverFlushTimeout = 2 * time.Second
+)
+
+// copyoverState is everything a copyover hands to the new process. File
+// descriptors are inherited across exec, so they are passed by number.
+type copyoverState struct {
+	Listeners map[string]int    `json:"listeners"`
+	World     worldSnapshot     `json:"world"`
+	Sessions  []copyoverSession `json:"sessions"`
+}
+
+type copyoverSession struct {
+	FD     int            `json:"fd"`
+	Player playerSnapshot `json:"player"`
+	Telnet telnetState    `json:"telnet"`
+	GMCP   gmcpState      `json:"gmcp"`
+}
+
+// handover is a player whose connection survives the copyover.
+type handover struct {
+	player *Player
+	tcp    *net.TCPConn
+	telnet telnetState
+}
+
+// copyover replaces the running binary with the one on disk without
+// dropping players. It runs on the game loop, so nothing changes while the
+// state is collected, and it only returns if the exec failed, in which
+// case everything is put back as it was.
+//
+// Only plain telnet connections can be handed over; TLS and WebSocket
+// sessions carry state in this process that cannot be passed on, so those
+// players are asked to reconnect.
+func (s *Server) copyover() error {
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("finding executable: %w", err)
+	}
+	
+	var files []*os.File
+	closeFiles := func() {
+		for _, file := range files {
+			file.Close()
+		}
+	}
+	
+	state := copyoverState{
+		Listeners: make(map[string]int),
+		World:     s.game.snapshotWorld(),
+	}
+	for role, listener := range s.raw {
+		tcp, ok := listener.(*net.TCPListener)
+		if !ok {
+			closeFiles()
+			return fmt.Errorf("%s listener cannot be handed over", role)
+		}
+		file, err := tcp.File()
+		if err != nil {
+			closeFiles()
+			return fmt.Errorf("%s listener: %w", role, err)
+		}
+		files = append(files, file)
+		state.Listeners[role] = int(file.Fd())
+	}
+	
+	var handovers []handover
+	for _, player := range s.game.players {
+		player.SendMessage(ColorWarning("Copyover in progress: the server is restarting, please wait..."))
+		if player.telnet == nil {
+			player.SendMessage(ColorWarning("This connection cannot be kept across the restart. Please reconnect in a moment."))
+			continue
+		}
+		tcp, ok := player.telnet.Conn.(*net.TCPConn)
+		if !ok {
+			player.SendMessage(ColorWarning("This connection cannot be kept across the restart. Please reconnect in a moment."))
+			continue
+		}
+		handovers = append(handovers, handover{player: player, tcp: tcp})
+	}
+	
+	s.game.saveAllPlayers()
+	s.game.saves.Flush()
+	
+	// Everything queued has to reach the clients before the exec, and
+	// compression has to end so the new process starts on a plain stream.
+	// Input the old process has already read into a player's scanner but
+	// not yet run is lost across the exec, so a command typed during the
+	// restart may have to be typed again.
+	flushed := flushOutput(s.game.players)
+	for i := range handovers {
+		h := &handovers[i]
+		if !flushed[h.player] {
+			continue
+		}
+		h.telnet = h.player.telnet.suspend()
+		file, err := h.tcp.File()
+		if err != nil {
+			log.Printf("Copyover: cannot hand over %s: %v", h.player.name, err)
+			continue
+		}
+		files = append(files, file)
+		
+		session := copyoverSession{
+			FD:     int(file.Fd()),
+			Player: h.player.snapshot(),
+			Telnet: h.telnet,
+		}
+		if h.player.gmcp != nil {
+			session.GMCP = h.player.gmcp.state()
+		}
+		state.Sessions = append(state.Sessions, session)
+	}
+	
+	path, err := writeCopyoverState(state)
+	if err == nil {
+		log.Printf("Copyover: handing %d sessions to %s", len(state.Sessions), executable)
+		err = execCopyover(executable, files, path)
+		os.Remove(path)
+	}
+	
+	closeFiles()
+	for _, h := range handovers {
+		if flushed[h.player] {
+			h.player.telnet.resume(h.telnet)
+		}
+	}
+	for _, player := range s.game.players {
+		player.startOutput()
+	}
+	return err
+}
+
+// flushOutput stops the players' writers and lets them write what is
+// queued, all at once. The connections of players still not done after
+// copyoverFlushTimeout are closed, so a few stalled clients can't hold up
+// the game. It returns the players whose output all got through.
+func flushOutput(players []*Player) map[*Player]bool {
+	for _, player := range players {
+		if player.output != nil {
+			close(player.output)
+		}
+	}
+	
+	deadline := time.NewTimer(copyoverFlushTimeout)
+	defer deadline.Stop()
+	expired := false
+	flushed := make(map[*Player]bool)
+	for _, player := range players {
+		if player.output == nil {
+			flushed[player] = true
+			continue
+		}
+		if !expired {
+			select {
+			case <-player.writerDone:
+				flushed[player] = true
+				continue
+			case <-deadline.C:
+				expired = true
+			}
+		}
+		select {
+		case <-player.writerDone:
+			flushed[player] = true
+		default:
+			log.Printf("Copyover: %s is not reading, dropping the connection", player.name)
+			player.conn.Close()
+			<-player.writerDone
+		}
+	}
+	return flushed
+}
+
+func writeCopyoverState(state copyoverState) (string, error) {
+	file, err := os.CreateTemp("", "mud-copyover-*.json")
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	
+	if err := json.NewEncoder(file).Encode(state); err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+	return file.Name(), nil
+}
+
+// loadCopyoverState returns the state left by a copyover, or nil if this
+// process was started normally.
+func loadCopyoverState() (*copyoverState, error) {
+	path := os.Getenv(copyoverEnv)
+	if path == "" {
+		return nil, nil
+	}
+	os.Unsetenv(copyoverEnv)
+	defer os.Remove(path)
+	
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var state copyoverState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &state, nil
+}
+
+// inherit makes Listen take over the listeners passed by a copyover rather
+// than opening new ones.
+func (s *Server) inherit(listeners map[string]int) {
+	s.inherited = make(map[string]*os.File)
+	for role, fd := range listeners {
+		s.inherited[role] = os.NewFile(uintptr(fd), role+"-listener")
+	}
+}
+
+// resume reconnects the players handed over by a copyover.
+func (s *Server) resume(state *copyoverState) {
+	for _, session := range state.Sessions {
+		file := os.NewFile(uintptr(session.FD), "copyover-"+session.Player.Name)
+		if file == nil {
+			continue
+		}
+		conn, err := net.FileConn(file)
+		file.Close()
+		if err != nil {
+			log.Printf("Copyover: cannot resume %s: %v", session.Player.Name, err)
+			continue
+		}
+		
+		telnet, gmcp := newTelnetSession(conn)
+		telnet.resume(session.Telnet)
+		gmcp.resume(session.GMCP)
+		go resumeSession(telnet, s.game, gmcp, session.Player)
+	}
+	log.Printf("Copyover: resumed %d sessions", len(state.Sessions))
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// execCopyover replaces this process with executable, keeping files open
+// across the exec. It only returns on failure.
+func execCopyover(executable string, files []*os.File, statePath string) error {
+	for _, file := range files {
+		// Go opens everything close-on-exec; clear the flag on the
+		// descriptors the new process needs.
+		if _, _, errno := syscall.Syscall(syscall.SYS_FCNTL, file.Fd(), syscall.F_SETFD, 0); errno != 0 {
+			return errno
+		}
+	}
+	env := append(os.Environ(), copyoverEnv+"="+statePath)
+	return syscall.Exec(executable, os.Args, env)
+}
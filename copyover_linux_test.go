@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestCopyoverRequiresAdmin(t *testing.T) {
+	config := DefaultConfig()
+	config.Admins = []string{"Root"}
+	game, err := NewGameWithConfig(config)
+	if err != nil {
+		t.Fatalf("Failed to create game: %v", err)
+	}
+	called := false
+	game.copyover = func() error {
+		called = true
+		return nil
+	}
+	
+	player := createMockPlayer("Guest")
+	game.AddPlayer(player)
+	player.HandleCommand(game, "copyover")
+	output := strings.Join(player.conn.(*MockConnection).messages, "\n")
+	if called || !strings.Contains(output, "Only admins") {
+		t.Errorf("Expected non-admin to be refused, got %q", output)
+	}
+	
+	admin := createMockPlayer("root")
+	game.AddPlayer(admin)
+	admin.HandleCommand(game, "copyover")
+	if !called {
+		t.Error("Expected admin to start a copyover")
+	}
+}
+
+func TestCopyoverResume(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+	client, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer client.Close()
+	accepted, err := listener.Accept()
+	if err != nil {
+		t.Fatalf("Failed to accept: %v", err)
+	}
+	
+	// Stand in for the descriptor inherited across exec.
+	file, err := accepted.(*net.TCPConn).File()
+	if err != nil {
+		t.Fatalf("Failed to get descriptor: %v", err)
+	}
+	fd, err := syscall.Dup(int(file.Fd()))
+	if err != nil {
+		t.Fatalf("Failed to dup descriptor: %v", err)
+	}
+	file.Close()
+	accepted.Close()
+	
+	config := testConfig(t)
+	game := newTestGame(t, config)
+	game.Start()
+	defer game.Stop()
+	server := NewServer(config, game)
+	server.resume(&copyoverState{Sessions: []copyoverSession{{
+		FD: fd,
+		Player: playerSnapshot{
+			Name:      "Phoenix",
+			Room:      "tavern",
+			Health:    12,
+			MaxHealth: 40,
+			Damage:    7,
+			Inventory: []itemSnapshot{{Name: "bread", Type: "misc"}},
+		},
+	}}})
+	
+	client.SetDeadline(time.Now().Add(5 * time.Second))
+	reader := bufio.NewReader(client)
+	if !readUntilText(reader, "Copyover complete.") {
+		t.Fatal("Expected copyover completion message")
+	}
+	if !readUntilText(reader, "Prancing Pony") {
+		t.Error("Expected to resume in the tavern")
+	}
+	
+	client.Write([]byte("inventory\r\nhealth\r\n"))
+	if !readUntilText(reader, "bread") {
+		t.Error("Expected inventory to survive the copyover")
+	}
+	if !readUntilText(reader, "12/40") {
+		t.Error("Expected health to survive the copyover")
+	}
+}
+
+func TestCopyoverFlushDropsStalledClients(t *testing.T) {
+	readerServer, readerClient := net.Pipe()
+	defer readerClient.Close()
+	stalledServer, stalledClient := net.Pipe()
+	defer stalledClient.Close()
+	
+	reader := NewPlayer(readerServer, "Reader")
+	stalled := NewPlayer(stalledServer, "Stalled")
+	go bufio.NewReader(readerClient).ReadString('\n')
+	reader.SendMessage("Copyover in progress")
+	stalled.SendMessage("Copyover in progress")
+	
+	start := time.Now()
+	flushed := flushOutput([]*Player{stalled, reader})
+	if elapsed := time.Since(start); elapsed > copyoverFlushTimeout+time.Second {
+		t.Errorf("Expected the flush to give up after %v, took %v", copyoverFlushTimeout, elapsed)
+	}
+	if !flushed[reader] || flushed[stalled] {
+		t.Errorf("Expected only the reader to be flushed, got %v", flushed)
+	}
+	if _, err := stalledServer.Write([]byte("x")); err == nil {
+		t.Error("Expected the stalled connection to be closed")
+	}
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+func execCopyover(executable string, files []*os.File, statePath string) error {
+	return errors.New("copyover is only supported on Linux")
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// directionAbbreviations are the short forms players may type for a
+// direction.
+var directionAbbreviations = map[string]string{
+	"n": "north",
+	"s": "south",
+	"e": "east",
+	"w": "west",
+	"u": "up",
+	"d": "down",
+}
+
+// expandDirection turns an abbreviated direction into the full one.
+func expandDirection(direction string) string {
+	if full, ok := directionAbbreviations[direction]; ok {
+		return full
+	}
+	return direction
+}
+
+// doorAction is what the open, close, lock and unlock commands do to a
+// door.
+type doorAction struct {
+	verb    string // as in "you open the door"
+	past    string // as in "the door is opened"
+	needKey bool
+	
+	// check says why the action can't be done to the door, or "" if it can.
+	check func(door *Door) string
+	apply func(door *Door)
+}
+
+var doorActions = map[string]doorAction{
+	"open": {
+		verb: "open", past: "opened",
+		check: func(door *Door) string {
+			switch {
+			case !door.closed:
+				return "It is already open."
+			case door.locked:
+				return "It is locked."
+			}
+			return ""
+		},
+		apply: func(door *Door) { door.closed = false },
+	},
+	"close": {
+		verb: "close", past: "closed",
+		check: func(door *Door) string {
+			if door.closed {
+				return "It is already closed."
+			}
+			return ""
+		},
+		apply: func(door *Door) { door.closed = true },
+	},
+	"lock": {
+		verb: "lock", past: "locked", needKey: true,
+		check: func(door *Door) string {
+			switch {
+			case door.key == "":
+				return "It has no lock."
+			case door.locked:
+				return "It is already locked."
+			case !door.closed:
+				return "You have to close it first."
+			}
+			return ""
+		},
+		apply: func(door *Door) { door.locked = true },
+	},
+	"unlock": {
+		verb: "unlock", past: "unlocked", needKey: true,
+		check: func(door *Door) string {
+			switch {
+			case door.key == "":
+				return "It has no lock."
+			case !door.locked:
+				return "It isn't locked."
+			}
+			return ""
+		},
+		apply: func(door *Door) { door.locked = false },
+	},
+}
+
+// handleDoor runs the open, close, lock and unlock commands.
+func (g *Game) handleDoor(p *Player, command string, args []string) {
+	action := doorActions[command]
+	if len(args) == 0 {
+		p.SendMessage(ColorWarning(fmt.Sprintf("%s which way?", capitalize(action.verb))))
+		return
+	}
+	direction := expandDirection(strings.ToLower(args[0]))
+	door := p.location.doors[direction]
+	if door == nil {
+		p.SendMessage(ColorError(fmt.Sprintf("There is no door %s.", direction)))
+		return
+	}
+	if why := action.check(door); why != "" {
+		p.SendMessage(ColorWarning(why))
+		return
+	}
+	if action.needKey && !p.carriesProto(door.key) {
+		p.SendMessage(ColorWarning("You don't have the key."))
+		return
+	}
+	g.changeDoor(p, direction, action)
+}
+
+// changeDoor does an action to the door in a direction and tells everyone
+// on both sides.
+func (g *Game) changeDoor(p *Player, direction string, action doorAction) {
+	room := p.location
+	door := room.doors[direction]
+	action.apply(door)
+	
+	p.SendMessage(ColorSuccess(fmt.Sprintf("You %s the door %s.", action.verb, direction)))
+	room.Broadcast(fmt.Sprintf("%s %ss the door %s.", ColorName(p.name), action.verb, ColorExit(direction)), p)
+	
+	other := room.exits[direction]
+	back := reverseDirections[direction]
+	if other != room && other.doors[back] == door {
+		other.Broadcast(fmt.Sprintf("The door %s is %s from the other side.", ColorExit(back), action.past), nil)
+	}
+}
+
+// useKey unlocks the first locked door in the player's room that the item
+// is the key to. It reports whether there was one.
+func (g *Game) useKey(p *Player, item *Item) bool {
+	for _, direction := range directions {
+		door := p.location.doors[direction]
+		if door != nil && door.locked && door.key == item.proto {
+			g.changeDoor(p, direction, doorActions["unlock"])
+			return true
+		}
+	}
+	return false
+}
+
+// carries reports whether the player has an item with the name in their
+// inventory.
+func (p *Player) carries(name string) bool {
+	for _, item := range p.inventory {
+		if item.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// carriesProto reports whether the player has an item made from the
+// prototype in their inventory.
+func (p *Player) carriesProto(proto string) bool {
+	for _, item := range p.inventory {
+		if item.proto == proto {
+			return true
+		}
+	}
+	return false
+}
+
+// describeExit is how look lists an exit: its direction, and the door in
+// it if that is closed.
+func (r *Room) describeExit(direction string) string {
+	if door := r.doors[direction]; door != nil && door.closed {
+		return fmt.Sprintf("%s (closed door)", ColorExit(direction))
+	}
+	return ColorExit(direction)
+}
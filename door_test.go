@@ -0,0 +1,139 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestDungeonDoor(t *testing.T) {
+	game := NewGame()
+	player := createMockPlayer("Hero")
+	watcher := createMockPlayer("Watcher")
+	game.AddPlayer(player)
+	game.AddPlayer(watcher)
+	for _, command := range []string{"south", "down"} {
+		player.HandleCommand(game, command)
+	}
+	for _, command := range []string{"west", "down"} {
+		watcher.HandleCommand(game, command)
+	}
+	dungeon, catacombs := game.rooms["dungeon"], game.rooms["catacombs"]
+	if dungeon.doors["north"] == nil || dungeon.doors["north"] != catacombs.doors["south"] {
+		t.Fatal("Expected one door shared by the dungeon and the catacombs")
+	}
+	
+	clearPlayerMessages(player)
+	player.HandleCommand(game, "look")
+	if !strings.Contains(strings.Join(getPlayerMessages(player), "\n"), "north"+ColorReset+" (closed door)") {
+		t.Errorf("Expected look to show the closed door, got:\n%s", strings.Join(getPlayerMessages(player), "\n"))
+	}
+	
+	player.HandleCommand(game, "north")
+	if player.location != dungeon || !strings.Contains(lastMessage(player), "closed") {
+		t.Fatalf("Expected the closed door to stop the player, got %q", lastMessage(player))
+	}
+	player.HandleCommand(game, "open n")
+	if !strings.Contains(lastMessage(player), "locked") {
+		t.Errorf("Expected the door to be locked, got %q", lastMessage(player))
+	}
+	player.HandleCommand(game, "unlock north")
+	if !strings.Contains(lastMessage(player), "don't have the key") {
+		t.Errorf("Expected unlocking without the key to fail, got %q", lastMessage(player))
+	}
+	
+	// Only an item made from the key's prototype fits, whatever it is
+	// called.
+	player.inventory = append(player.inventory, &Item{name: "rusty key", itemType: "misc"})
+	player.HandleCommand(game, "unlock north")
+	if !strings.Contains(lastMessage(player), "don't have the key") {
+		t.Errorf("Expected a lookalike key not to fit, got %q", lastMessage(player))
+	}
+	player.inventory = nil
+	
+	player.HandleCommand(game, "get rusty key")
+	player.HandleCommand(game, "use rusty key")
+	if dungeon.doors["north"].locked {
+		t.Fatalf("Expected the rusty key to unlock the door, got %q", lastMessage(player))
+	}
+	if !strings.Contains(lastMessage(watcher), "unlocked from the other side") {
+		t.Errorf("Expected the other side to hear the lock, got %q", lastMessage(watcher))
+	}
+	
+	player.HandleCommand(game, "open north")
+	if !strings.Contains(lastMessage(watcher), "opened from the other side") {
+		t.Errorf("Expected the other side to see the door open, got %q", lastMessage(watcher))
+	}
+	player.HandleCommand(game, "north")
+	if player.location != catacombs {
+		t.Fatalf("Expected to walk through the open door, got %q", lastMessage(player))
+	}
+	
+	player.HandleCommand(game, "lock south")
+	if !strings.Contains(lastMessage(player), "close it first") {
+		t.Errorf("Expected an open door not to lock, got %q", lastMessage(player))
+	}
+	player.HandleCommand(game, "close south")
+	player.HandleCommand(game, "lock south")
+	if door := catacombs.doors["south"]; !door.closed || !door.locked {
+		t.Errorf("Expected the door to be closed and locked from the catacombs, got %q", lastMessage(player))
+	}
+	if !strings.Contains(lastMessage(watcher), "locks the door") {
+		t.Errorf("Expected the room to see the door locked, got %q", lastMessage(watcher))
+	}
+	player.HandleCommand(game, "open east")
+	if !strings.Contains(lastMessage(player), "no door east") {
+		t.Errorf("Expected no door east, got %q", lastMessage(player))
+	}
+}
+
+func TestDoorState(t *testing.T) {
+	game := NewGame()
+	game.rooms["dungeon"].doors["north"].locked = false
+	world := game.snapshotWorld()
+	
+	restored := NewGame()
+	restored.restoreWorld(world)
+	if door := restored.rooms["catacombs"].doors["south"]; door.locked || !door.closed {
+		t.Errorf("Expected the restored door to be closed but unlocked, got %+v", door)
+	}
+}
+
+func TestDoorDefinitions(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a.area": {Data: []byte(`room cell
+  name Cell
+  exit north yard
+  door north closed
+  door east closed
+  door north open
+
+room yard
+  name Yard
+  exit south cell
+  door south locked
+  door south closed bone
+
+room well
+  name Well
+  exit up yard
+  door up shut
+`)},
+	}
+	_, err := loadWorldData(fsys, "areas")
+	if err == nil {
+		t.Fatal("Expected errors")
+	}
+	for _, want := range []string{
+		`areas/a.area:5: door east but room cell has no exit east`,
+		`areas/a.area:6: room cell already has a door north`,
+		`areas/a.area:11: a locked door needs a key`,
+		`areas/a.area:12: door south needs unknown item "bone"`,
+		`areas/a.area:12: the door between yard and cell is already defined at areas/a.area:4`,
+		`areas/a.area:17: door state must be open, closed or locked, got "shut"`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected error %q in:\n%v", want, err)
+		}
+	}
+}
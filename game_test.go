@@ -1,7 +1,10 @@
 package main
 
 import (
+	"fmt"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestNewGame(t *testing.T) {
@@ -285,4 +288,46 @@ func TestRoomItems(t *testing.T) {
 	} else if temple.items[0].name != "prayer book" {
 		t.Errorf("Expected prayer book in temple, got %s", temple.items[0].name)
 	}
-}
\ No newline at end of file
+}
+
+func TestConcurrentPlayers(t *testing.T) {
+	game := NewGame()
+	game.tickInterval = time.Millisecond
+	game.Start()
+	defer game.Stop()
+	
+	commands := []string{
+		"look", "north", "up", "down", "south", "east", "attack bandit",
+		"west", "south", "attack giant rat", "say Hello!", "who", "north", "rest",
+	}
+	
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			player := createMockPlayer(fmt.Sprintf("Player%d", i))
+			game.Do(func() {
+				game.AddPlayer(player)
+			})
+			for _, command := range commands {
+				game.SubmitCommand(player, command)
+			}
+			game.Do(func() {
+				game.RemovePlayer(player)
+			})
+		}(i)
+	}
+	wg.Wait()
+	
+	game.Do(func() {
+		if len(game.players) != 0 {
+			t.Errorf("Expected 0 players after all left, got %d", len(game.players))
+		}
+		for key, room := range game.rooms {
+			if len(room.players) != 0 {
+				t.Errorf("Room '%s' still has %d players", key, len(room.players))
+			}
+		}
+	})
+}
@@ -5,18 +5,22 @@ import (
 	"net"
 	"os"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 )
 
 type MockConnection struct {
+	mu       sync.Mutex
 	messages []string
 }
 
 func (m *MockConnection) Write(p []byte) (n int, err error) {
 	message := strings.TrimSpace(string(p))
 	if message != "" {
+		m.mu.Lock()
 		m.messages = append(m.messages, message)
+		m.mu.Unlock()
 	}
 	return len(p), nil
 }
@@ -63,14 +67,18 @@ func createMockPlayer(name string) *Player {
 
 func getPlayerMessages(player *Player) []string {
 	if mockConn, ok := player.conn.(*MockConnection); ok {
-		return mockConn.messages
+		mockConn.mu.Lock()
+		defer mockConn.mu.Unlock()
+		return append([]string(nil), mockConn.messages...)
 	}
 	return []string{}
 }
 
 func clearPlayerMessages(player *Player) {
 	if mockConn, ok := player.conn.(*MockConnection); ok {
+		mockConn.mu.Lock()
 		mockConn.messages = make([]string, 0)
+		mockConn.mu.Unlock()
 	}
 }
 
@@ -81,19 +89,20 @@ func TestGameplayTranscript(t *testing.T) {
 	transcript = append(transcript, "")
 	
 	game := NewGame()
-	defer func() {
-		game.running = false
-	}()
+	game.Start()
+	defer game.Stop()
 	
 	alice := createMockPlayer("Alice")
 	bob := createMockPlayer("Bob")
 	
 	transcript = append(transcript, ">>> Alice and Bob enter the game")
-	game.AddPlayer(alice)
-	game.AddPlayer(bob)
+	game.Do(func() {
+		game.AddPlayer(alice)
+		game.AddPlayer(bob)
+	})
 	
 	transcript = append(transcript, "\n>>> Alice looks around the town square")
-	alice.HandleCommand(game, "look")
+	game.SubmitCommand(alice, "look")
 	messages := getPlayerMessages(alice)
 	for _, msg := range messages {
 		transcript = append(transcript, fmt.Sprintf("Alice sees: %s", msg))
@@ -101,7 +110,7 @@ func TestGameplayTranscript(t *testing.T) {
 	clearPlayerMessages(alice)
 	
 	transcript = append(transcript, "\n>>> Alice checks her health")
-	alice.HandleCommand(game, "health")
+	game.SubmitCommand(alice, "health")
 	messages = getPlayerMessages(alice)
 	for _, msg := range messages {
 		transcript = append(transcript, fmt.Sprintf("Alice: %s", msg))
@@ -109,7 +118,7 @@ func TestGameplayTranscript(t *testing.T) {
 	clearPlayerMessages(alice)
 	
 	transcript = append(transcript, "\n>>> Alice goes to the dangerous forest")
-	alice.HandleCommand(game, "south")
+	game.SubmitCommand(alice, "south")
 	messages = getPlayerMessages(alice)
 	for _, msg := range messages {
 		transcript = append(transcript, fmt.Sprintf("Alice: %s", msg))
@@ -117,7 +126,7 @@ func TestGameplayTranscript(t *testing.T) {
 	clearPlayerMessages(alice)
 	
 	transcript = append(transcript, "\n>>> Bob goes to the marketplace")
-	bob.HandleCommand(game, "east")
+	game.SubmitCommand(bob, "east")
 	messages = getPlayerMessages(bob)
 	for _, msg := range messages {
 		transcript = append(transcript, fmt.Sprintf("Bob: %s", msg))
@@ -125,7 +134,7 @@ func TestGameplayTranscript(t *testing.T) {
 	clearPlayerMessages(bob)
 	
 	transcript = append(transcript, "\n>>> Alice attacks the giant rat")
-	alice.HandleCommand(game, "attack giant rat")
+	game.SubmitCommand(alice, "attack giant rat")
 	messages = getPlayerMessages(alice)
 	for _, msg := range messages {
 		transcript = append(transcript, fmt.Sprintf("Alice: %s", msg))
@@ -133,7 +142,7 @@ func TestGameplayTranscript(t *testing.T) {
 	clearPlayerMessages(alice)
 	
 	transcript = append(transcript, "\n>>> Bob attacks the bandit")
-	bob.HandleCommand(game, "fight bandit")
+	game.SubmitCommand(bob, "fight bandit")
 	messages = getPlayerMessages(bob)
 	for _, msg := range messages {
 		transcript = append(transcript, fmt.Sprintf("Bob: %s", msg))
@@ -144,7 +153,7 @@ func TestGameplayTranscript(t *testing.T) {
 	time.Sleep(4 * time.Second)
 	
 	transcript = append(transcript, "\n>>> Checking Alice's condition after monster attacks")
-	alice.HandleCommand(game, "health")
+	game.SubmitCommand(alice, "health")
 	messages = getPlayerMessages(alice)
 	for _, msg := range messages {
 		transcript = append(transcript, fmt.Sprintf("Alice: %s", msg))
@@ -152,7 +161,7 @@ func TestGameplayTranscript(t *testing.T) {
 	clearPlayerMessages(alice)
 	
 	transcript = append(transcript, "\n>>> Checking Bob's condition after monster attacks")
-	bob.HandleCommand(game, "health")
+	game.SubmitCommand(bob, "health")
 	messages = getPlayerMessages(bob)
 	for _, msg := range messages {
 		transcript = append(transcript, fmt.Sprintf("Bob: %s", msg))
@@ -160,7 +169,7 @@ func TestGameplayTranscript(t *testing.T) {
 	clearPlayerMessages(bob)
 	
 	transcript = append(transcript, "\n>>> Alice tries to get the twisted branch")
-	alice.HandleCommand(game, "get twisted branch")
+	game.SubmitCommand(alice, "get twisted branch")
 	messages = getPlayerMessages(alice)
 	for _, msg := range messages {
 		transcript = append(transcript, fmt.Sprintf("Alice: %s", msg))
@@ -168,7 +177,7 @@ func TestGameplayTranscript(t *testing.T) {
 	clearPlayerMessages(alice)
 	
 	transcript = append(transcript, "\n>>> Alice checks her inventory")
-	alice.HandleCommand(game, "inventory")
+	game.SubmitCommand(alice, "inventory")
 	messages = getPlayerMessages(alice)
 	for _, msg := range messages {
 		transcript = append(transcript, fmt.Sprintf("Alice: %s", msg))
@@ -176,7 +185,7 @@ func TestGameplayTranscript(t *testing.T) {
 	clearPlayerMessages(alice)
 	
 	transcript = append(transcript, "\n>>> Bob tries to examine the shiny coin")
-	bob.HandleCommand(game, "examine shiny coin")
+	game.SubmitCommand(bob, "examine shiny coin")
 	messages = getPlayerMessages(bob)
 	for _, msg := range messages {
 		transcript = append(transcript, fmt.Sprintf("Bob: %s", msg))
@@ -184,7 +193,7 @@ func TestGameplayTranscript(t *testing.T) {
 	clearPlayerMessages(bob)
 	
 	transcript = append(transcript, "\n>>> Alice equips the twisted branch weapon")
-	alice.HandleCommand(game, "equip twisted branch")
+	game.SubmitCommand(alice, "equip twisted branch")
 	messages = getPlayerMessages(alice)
 	for _, msg := range messages {
 		transcript = append(transcript, fmt.Sprintf("Alice: %s", msg))
@@ -192,7 +201,7 @@ func TestGameplayTranscript(t *testing.T) {
 	clearPlayerMessages(alice)
 	
 	transcript = append(transcript, "\n>>> Alice checks her equipment")
-	alice.HandleCommand(game, "equipment")
+	game.SubmitCommand(alice, "equipment")
 	messages = getPlayerMessages(alice)
 	for _, msg := range messages {
 		transcript = append(transcript, fmt.Sprintf("Alice: %s", msg))
@@ -200,7 +209,7 @@ func TestGameplayTranscript(t *testing.T) {
 	clearPlayerMessages(alice)
 	
 	transcript = append(transcript, "\n>>> Alice attacks again with weapon equipped")
-	alice.HandleCommand(game, "attack giant rat")
+	game.SubmitCommand(alice, "attack giant rat")
 	messages = getPlayerMessages(alice)
 	for _, msg := range messages {
 		transcript = append(transcript, fmt.Sprintf("Alice: %s", msg))
@@ -208,7 +217,7 @@ func TestGameplayTranscript(t *testing.T) {
 	clearPlayerMessages(alice)
 	
 	transcript = append(transcript, "\n>>> Alice tries to flee back to town square")
-	alice.HandleCommand(game, "north")
+	game.SubmitCommand(alice, "north")
 	messages = getPlayerMessages(alice)
 	for _, msg := range messages {
 		transcript = append(transcript, fmt.Sprintf("Alice: %s", msg))
@@ -216,15 +225,15 @@ func TestGameplayTranscript(t *testing.T) {
 	clearPlayerMessages(alice)
 	
 	transcript = append(transcript, "\n>>> Bob gets the shiny coin and goes to tavern")
-	bob.HandleCommand(game, "get shiny coin")
+	game.SubmitCommand(bob, "get shiny coin")
 	messages = getPlayerMessages(bob)
 	for _, msg := range messages {
 		transcript = append(transcript, fmt.Sprintf("Bob: %s", msg))
 	}
 	clearPlayerMessages(bob)
 	
-	bob.HandleCommand(game, "west")
-	bob.HandleCommand(game, "north")
+	game.SubmitCommand(bob, "west")
+	game.SubmitCommand(bob, "north")
 	messages = getPlayerMessages(bob)
 	for _, msg := range messages {
 		transcript = append(transcript, fmt.Sprintf("Bob: %s", msg))
@@ -232,7 +241,7 @@ func TestGameplayTranscript(t *testing.T) {
 	clearPlayerMessages(bob)
 	
 	transcript = append(transcript, "\n>>> Bob explores the armory above the tavern")
-	bob.HandleCommand(game, "up")
+	game.SubmitCommand(bob, "up")
 	messages = getPlayerMessages(bob)
 	for _, msg := range messages {
 		transcript = append(transcript, fmt.Sprintf("Bob: %s", msg))
@@ -240,7 +249,7 @@ func TestGameplayTranscript(t *testing.T) {
 	clearPlayerMessages(bob)
 	
 	transcript = append(transcript, "\n>>> Bob gets the steel shield")
-	bob.HandleCommand(game, "get steel shield")
+	game.SubmitCommand(bob, "get steel shield")
 	messages = getPlayerMessages(bob)
 	for _, msg := range messages {
 		transcript = append(transcript, fmt.Sprintf("Bob: %s", msg))
@@ -248,7 +257,7 @@ func TestGameplayTranscript(t *testing.T) {
 	clearPlayerMessages(bob)
 	
 	transcript = append(transcript, "\n>>> Bob equips the armor")
-	bob.HandleCommand(game, "equip steel shield")
+	game.SubmitCommand(bob, "equip steel shield")
 	messages = getPlayerMessages(bob)
 	for _, msg := range messages {
 		transcript = append(transcript, fmt.Sprintf("Bob: %s", msg))
@@ -256,14 +265,14 @@ func TestGameplayTranscript(t *testing.T) {
 	clearPlayerMessages(bob)
 	
 	transcript = append(transcript, "\n>>> Alice explores the temple and its underground")
-	alice.HandleCommand(game, "west")
+	game.SubmitCommand(alice, "west")
 	messages = getPlayerMessages(alice)
 	for _, msg := range messages {
 		transcript = append(transcript, fmt.Sprintf("Alice: %s", msg))
 	}
 	clearPlayerMessages(alice)
 	
-	alice.HandleCommand(game, "down")
+	game.SubmitCommand(alice, "down")
 	messages = getPlayerMessages(alice)
 	for _, msg := range messages {
 		transcript = append(transcript, fmt.Sprintf("Alice: %s", msg))
@@ -271,7 +280,7 @@ func TestGameplayTranscript(t *testing.T) {
 	clearPlayerMessages(alice)
 	
 	transcript = append(transcript, "\n>>> Alice encounters the dangerous catacombs")
-	alice.HandleCommand(game, "look")
+	game.SubmitCommand(alice, "look")
 	messages = getPlayerMessages(alice)
 	for _, msg := range messages {
 		transcript = append(transcript, fmt.Sprintf("Alice: %s", msg))
@@ -279,7 +288,7 @@ func TestGameplayTranscript(t *testing.T) {
 	clearPlayerMessages(alice)
 	
 	transcript = append(transcript, "\n>>> Alice gets the leather armor")
-	alice.HandleCommand(game, "get leather armor")
+	game.SubmitCommand(alice, "get leather armor")
 	messages = getPlayerMessages(alice)
 	for _, msg := range messages {
 		transcript = append(transcript, fmt.Sprintf("Alice: %s", msg))
@@ -287,8 +296,8 @@ func TestGameplayTranscript(t *testing.T) {
 	clearPlayerMessages(alice)
 	
 	transcript = append(transcript, "\n>>> Alice equips armor and fights zombie")
-	alice.HandleCommand(game, "equip leather armor")
-	alice.HandleCommand(game, "attack shambling zombie")
+	game.SubmitCommand(alice, "equip leather armor")
+	game.SubmitCommand(alice, "attack shambling zombie")
 	messages = getPlayerMessages(alice)
 	for _, msg := range messages {
 		transcript = append(transcript, fmt.Sprintf("Alice: %s", msg))
@@ -296,8 +305,8 @@ func TestGameplayTranscript(t *testing.T) {
 	clearPlayerMessages(alice)
 	
 	transcript = append(transcript, "\n>>> Alice escapes to town square")
-	alice.HandleCommand(game, "up")
-	alice.HandleCommand(game, "east")
+	game.SubmitCommand(alice, "up")
+	game.SubmitCommand(alice, "east")
 	messages = getPlayerMessages(alice)
 	for _, msg := range messages {
 		transcript = append(transcript, fmt.Sprintf("Alice: %s", msg))
@@ -305,8 +314,8 @@ func TestGameplayTranscript(t *testing.T) {
 	clearPlayerMessages(alice)
 	
 	transcript = append(transcript, "\n>>> Alice explores the new pirate cove")
-	alice.HandleCommand(game, "east")
-	alice.HandleCommand(game, "south")
+	game.SubmitCommand(alice, "east")
+	game.SubmitCommand(alice, "south")
 	messages = getPlayerMessages(alice)
 	for _, msg := range messages {
 		transcript = append(transcript, fmt.Sprintf("Alice: %s", msg))
@@ -314,7 +323,7 @@ func TestGameplayTranscript(t *testing.T) {
 	clearPlayerMessages(alice)
 	
 	transcript = append(transcript, "\n>>> Alice examines the cutlass with enhanced examine")
-	alice.HandleCommand(game, "examine cutlass")
+	game.SubmitCommand(alice, "examine cutlass")
 	messages = getPlayerMessages(alice)
 	for _, msg := range messages {
 		transcript = append(transcript, fmt.Sprintf("Alice: %s", msg))
@@ -322,8 +331,8 @@ func TestGameplayTranscript(t *testing.T) {
 	clearPlayerMessages(alice)
 	
 	transcript = append(transcript, "\n>>> Alice gets the cutlass and encounters sea monsters")
-	alice.HandleCommand(game, "get cutlass")
-	alice.HandleCommand(game, "attack bloodthirsty pirate")
+	game.SubmitCommand(alice, "get cutlass")
+	game.SubmitCommand(alice, "attack bloodthirsty pirate")
 	messages = getPlayerMessages(alice)
 	for _, msg := range messages {
 		transcript = append(transcript, fmt.Sprintf("Alice: %s", msg))
@@ -331,7 +340,7 @@ func TestGameplayTranscript(t *testing.T) {
 	clearPlayerMessages(alice)
 	
 	transcript = append(transcript, "\n>>> Alice explores the volcanic cavern underground")
-	alice.HandleCommand(game, "down")
+	game.SubmitCommand(alice, "down")
 	messages = getPlayerMessages(alice)
 	for _, msg := range messages {
 		transcript = append(transcript, fmt.Sprintf("Alice: %s", msg))
@@ -339,9 +348,9 @@ func TestGameplayTranscript(t *testing.T) {
 	clearPlayerMessages(alice)
 	
 	transcript = append(transcript, "\n>>> Alice gets obsidian dagger and fights lava salamander")
-	alice.HandleCommand(game, "get obsidian dagger")
-	alice.HandleCommand(game, "equip obsidian dagger")
-	alice.HandleCommand(game, "attack lava salamander")
+	game.SubmitCommand(alice, "get obsidian dagger")
+	game.SubmitCommand(alice, "equip obsidian dagger")
+	game.SubmitCommand(alice, "attack lava salamander")
 	messages = getPlayerMessages(alice)
 	for _, msg := range messages {
 		transcript = append(transcript, fmt.Sprintf("Alice: %s", msg))
@@ -349,7 +358,7 @@ func TestGameplayTranscript(t *testing.T) {
 	clearPlayerMessages(alice)
 	
 	transcript = append(transcript, "\n>>> Alice uses rest command to heal")
-	alice.HandleCommand(game, "rest")
+	game.SubmitCommand(alice, "rest")
 	messages = getPlayerMessages(alice)
 	for _, msg := range messages {
 		transcript = append(transcript, fmt.Sprintf("Alice: %s", msg))
@@ -357,11 +366,11 @@ func TestGameplayTranscript(t *testing.T) {
 	clearPlayerMessages(alice)
 	
 	transcript = append(transcript, "\n>>> Bob goes to ice fortress via wizard tower")
-	bob.HandleCommand(game, "down")
-	bob.HandleCommand(game, "west")
-	bob.HandleCommand(game, "down")
-	bob.HandleCommand(game, "up")
-	bob.HandleCommand(game, "up")
+	game.SubmitCommand(bob, "down")
+	game.SubmitCommand(bob, "west")
+	game.SubmitCommand(bob, "down")
+	game.SubmitCommand(bob, "up")
+	game.SubmitCommand(bob, "up")
 	messages = getPlayerMessages(bob)
 	for _, msg := range messages {
 		transcript = append(transcript, fmt.Sprintf("Bob: %s", msg))
@@ -369,10 +378,10 @@ func TestGameplayTranscript(t *testing.T) {
 	clearPlayerMessages(bob)
 	
 	transcript = append(transcript, "\n>>> Bob gets frost armor and fights ice monsters")
-	bob.HandleCommand(game, "get frost armor")
-	bob.HandleCommand(game, "unequip steel shield")
-	bob.HandleCommand(game, "equip frost armor")
-	bob.HandleCommand(game, "attack frost yeti")
+	game.SubmitCommand(bob, "get frost armor")
+	game.SubmitCommand(bob, "unequip steel shield")
+	game.SubmitCommand(bob, "equip frost armor")
+	game.SubmitCommand(bob, "attack frost yeti")
 	messages = getPlayerMessages(bob)
 	for _, msg := range messages {
 		transcript = append(transcript, fmt.Sprintf("Bob: %s", msg))
@@ -380,8 +389,8 @@ func TestGameplayTranscript(t *testing.T) {
 	clearPlayerMessages(bob)
 	
 	transcript = append(transcript, "\n>>> Bob explores sky temple and uses rest")
-	bob.HandleCommand(game, "west")
-	bob.HandleCommand(game, "rest")
+	game.SubmitCommand(bob, "west")
+	game.SubmitCommand(bob, "rest")
 	messages = getPlayerMessages(bob)
 	for _, msg := range messages {
 		transcript = append(transcript, fmt.Sprintf("Bob: %s", msg))
@@ -389,9 +398,9 @@ func TestGameplayTranscript(t *testing.T) {
 	clearPlayerMessages(bob)
 	
 	transcript = append(transcript, "\n>>> Bob gets celestial blade and fights seraph")
-	bob.HandleCommand(game, "get celestial blade")
-	bob.HandleCommand(game, "equip celestial blade")
-	bob.HandleCommand(game, "attack golden seraph")
+	game.SubmitCommand(bob, "get celestial blade")
+	game.SubmitCommand(bob, "equip celestial blade")
+	game.SubmitCommand(bob, "attack golden seraph")
 	messages = getPlayerMessages(bob)
 	for _, msg := range messages {
 		transcript = append(transcript, fmt.Sprintf("Bob: %s", msg))
@@ -399,11 +408,11 @@ func TestGameplayTranscript(t *testing.T) {
 	clearPlayerMessages(bob)
 	
 	transcript = append(transcript, "\n>>> Alice goes to temple and uses prayer book for healing")
-	alice.HandleCommand(game, "up")
-	alice.HandleCommand(game, "north")
-	alice.HandleCommand(game, "west")
-	alice.HandleCommand(game, "get prayer book")
-	alice.HandleCommand(game, "use prayer book")
+	game.SubmitCommand(alice, "up")
+	game.SubmitCommand(alice, "north")
+	game.SubmitCommand(alice, "west")
+	game.SubmitCommand(alice, "get prayer book")
+	game.SubmitCommand(alice, "use prayer book")
 	messages = getPlayerMessages(alice)
 	for _, msg := range messages {
 		transcript = append(transcript, fmt.Sprintf("Alice: %s", msg))
@@ -411,7 +420,7 @@ func TestGameplayTranscript(t *testing.T) {
 	clearPlayerMessages(alice)
 	
 	transcript = append(transcript, "\n>>> Checking who is online from different locations")
-	alice.HandleCommand(game, "who")
+	game.SubmitCommand(alice, "who")
 	messages = getPlayerMessages(alice)
 	for _, msg := range messages {
 		transcript = append(transcript, fmt.Sprintf("Alice: %s", msg))
@@ -419,7 +428,7 @@ func TestGameplayTranscript(t *testing.T) {
 	clearPlayerMessages(alice)
 	
 	transcript = append(transcript, "\n>>> Alice says something about the expanded world")
-	alice.HandleCommand(game, "say This world is amazing! I found sea monsters, lava creatures, and divine weapons!")
+	game.SubmitCommand(alice, "say This world is amazing! I found sea monsters, lava creatures, and divine weapons!")
 	messages = getPlayerMessages(alice)
 	for _, msg := range messages {
 		transcript = append(transcript, fmt.Sprintf("Alice: %s", msg))
@@ -427,6 +436,7 @@ func TestGameplayTranscript(t *testing.T) {
 	clearPlayerMessages(alice)
 	
 	transcript = append(transcript, "\n>>> Final status check")
+	game.Stop()
 	transcript = append(transcript, fmt.Sprintf("Alice health: %d/%d", alice.health, alice.maxHealth))
 	transcript = append(transcript, fmt.Sprintf("Bob health: %d/%d", bob.health, bob.maxHealth))
 	transcript = append(transcript, fmt.Sprintf("Alice location: %s", alice.location.name))
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"hash/fnv"
+	"log"
+	"strings"
+	"sync"
+)
+
+// gmcpSession holds what a GMCP client has told us about itself. It is
+// written by the connection's reading goroutine and read by the game loop.
+type gmcpSession struct {
+	conn *TelnetConn
+	
+	mu       sync.Mutex
+	client   string
+	version  string
+	supports map[string]int
+	
+	// game and player are set once the connection has a player, whose
+	// writer then owns the output.
+	game   *Game
+	player *Player
+}
+
+func newGMCPSession(conn *TelnetConn) *gmcpSession {
+	return &gmcpSession{
+		conn:     conn,
+		supports: make(map[string]int),
+	}
+}
+
+// splitGMCP separates "Package.Name <json>" into its parts.
+func splitGMCP(data []byte) (string, []byte) {
+	pkg, payload, _ := bytes.Cut(bytes.TrimSpace(data), []byte(" "))
+	return string(pkg), bytes.TrimSpace(payload)
+}
+
+// receive handles a GMCP message from the client.
+func (s *gmcpSession) receive(data []byte) {
+	pkg, payload := splitGMCP(data)
+	
+	switch strings.ToLower(pkg) {
+	case "core.hello":
+		var hello struct {
+			Client  string `json:"client"`
+			Version string `json:"version"`
+		}
+		if err := json.Unmarshal(payload, &hello); err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.client = hello.Client
+		s.version = hello.Version
+		s.mu.Unlock()
+		log.Printf("GMCP client: %s %s", hello.Client, hello.Version)
+		
+	case "core.supports.set", "core.supports.add", "core.supports.remove":
+		var modules []string
+		if err := json.Unmarshal(payload, &modules); err != nil {
+			return
+		}
+		s.mu.Lock()
+		if strings.EqualFold(pkg, "core.supports.set") {
+			s.supports = make(map[string]int)
+		}
+		for _, module := range modules {
+			name, version := parseGMCPModule(module)
+			if strings.EqualFold(pkg, "core.supports.remove") {
+				delete(s.supports, name)
+			} else {
+				s.supports[name] = version
+			}
+		}
+		s.mu.Unlock()
+		
+	case "core.ping":
+		s.mu.Lock()
+		game, player := s.game, s.player
+		s.mu.Unlock()
+		if player == nil {
+			// While logging in, the connection's own goroutine is the
+			// only one writing to it.
+			s.conn.Subnegotiate(TelnetOptionGMCP, []byte("Core.Ping"))
+			return
+		}
+		game.Do(func() {
+			if player.gmcp == s {
+				player.queue(outputFrame{option: TelnetOptionGMCP, data: []byte("Core.Ping")})
+			}
+		})
+	}
+}
+
+// attach sends replies to the client through the player's output queue
+// from now on. It runs on the game loop.
+func (s *gmcpSession) attach(g *Game, p *Player) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.game, s.player = g, p
+}
+
+// parseGMCPModule splits a Core.Supports entry such as "Char.Items 1".
+func parseGMCPModule(module string) (string, int) {
+	name, versionText, _ := strings.Cut(strings.TrimSpace(module), " ")
+	version := 1
+	if n, err := json.Number(versionText).Int64(); err == nil {
+		version = int(n)
+	}
+	return strings.ToLower(name), version
+}
+
+// supported reports whether the client asked for a package. A client that
+// never sent Core.Supports gets everything.
+func (s *gmcpSession) supported(pkg string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	
+	if len(s.supports) == 0 {
+		return true
+	}
+	name := strings.ToLower(pkg)
+	for {
+		if _, ok := s.supports[name]; ok {
+			return true
+		}
+		i := strings.LastIndex(name, ".")
+		if i < 0 {
+			return false
+		}
+		name = name[:i]
+	}
+}
+
+// clientName describes the client from its Core.Hello, if it sent one.
+func (s *gmcpSession) clientName() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return strings.TrimSpace(s.client + " " + s.version)
+}
+
+type gmcpVitals struct {
+	HP    int `json:"hp"`
+	MaxHP int `json:"maxhp"`
+}
+
+type gmcpRoomInfo struct {
+	Num   uint32            `json:"num"`
+	ID    string            `json:"id"`
+	Name  string            `json:"name"`
+	Exits map[string]uint32 `json:"exits"`
+}
+
+type gmcpItem struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Equipped bool   `json:"equipped,omitempty"`
+}
+
+type gmcpInventory struct {
+	Location string     `json:"location"`
+	Items    []gmcpItem `json:"items"`
+}
+
+type gmcpTarget struct {
+	Name      string `json:"name,omitempty"`
+	Health    int    `json:"hp,omitempty"`
+	MaxHealth int    `json:"maxhp,omitempty"`
+}
+
+// roomNumber gives a room a stable numeric id for client mappers, which
+// expect Room.Info numbers rather than names.
+func roomNumber(id string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(id))
+	return h.Sum32()
+}
+
+func (p *Player) gmcpEnabled() bool {
+	return p.gmcp != nil && p.telnet != nil && p.telnet.LocalEnabled(TelnetOptionGMCP)
+}
+
+// pushGMCP sends a package only if its contents changed since it was last
+// sent to this player.
+func (p *Player) pushGMCP(pkg string, data any) {
+	if !p.gmcp.supported(pkg) {
+		return
+	}
+	payload, err := json.Marshal(data)
+	if err != nil {
+		log.Printf("GMCP %s: %v", pkg, err)
+		return
+	}
+	if p.gmcpSent == nil {
+		p.gmcpSent = make(map[string]string)
+	}
+	if p.gmcpSent[pkg] == string(payload) {
+		return
+	}
+	p.gmcpSent[pkg] = string(payload)
+	p.queue(outputFrame{option: TelnetOptionGMCP, data: append([]byte(pkg+" "), payload...)})
+}
+
+// updateGMCP pushes whichever of the player's vitals, room, inventory and
+// combat target changed. The game loop calls it after every event.
+func (p *Player) updateGMCP() {
+	if p.output == nil || !p.gmcpEnabled() {
+		return
+	}
+	
+	p.pushGMCP("Char.Vitals", gmcpVitals{HP: p.health, MaxHP: p.maxHealth})
+	
+	if p.location != nil {
+		info := gmcpRoomInfo{
+			Num:   roomNumber(p.location.id),
+			ID:    p.location.id,
+			Name:  p.location.name,
+			Exits: make(map[string]uint32),
+		}
+		for direction, room := range p.location.exits {
+			info.Exits[direction] = roomNumber(room.id)
+		}
+		p.pushGMCP("Room.Info", info)
+	}
+	
+	inventory := gmcpInventory{Location: "inv", Items: make([]gmcpItem, 0, len(p.inventory)+2)}
+	for _, item := range []*Item{p.weapon, p.armor} {
+		if item != nil {
+			inventory.Items = append(inventory.Items, gmcpItem{Name: item.name, Type: item.itemType, Equipped: true})
+		}
+	}
+	for _, item := range p.inventory {
+		inventory.Items = append(inventory.Items, gmcpItem{Name: item.name, Type: item.itemType})
+	}
+	p.pushGMCP("Char.Items.Inv", inventory)
+	
+	target := gmcpTarget{}
+	if p.target != nil && p.target.alive && p.target.location == p.location {
+		target = gmcpTarget{Name: p.target.name, Health: p.target.health, MaxHealth: p.target.maxHealth}
+	}
+	p.pushGMCP("Char.Combat.Target", target)
+}
+
+// updateGMCP refreshes GMCP data for every connected player.
+func (g *Game) updateGMCP() {
+	for _, player := range g.players {
+		player.updateGMCP()
+	}
+}
+
+// gmcpState is what the client told us about itself, carried across a
+// copyover.
+type gmcpState struct {
+	Client   string         `json:"client,omitempty"`
+	Version  string         `json:"version,omitempty"`
+	Supports map[string]int `json:"supports,omitempty"`
+}
+
+func (s *gmcpSession) state() gmcpState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	
+	supports := make(map[string]int, len(s.supports))
+	for name, version := range s.supports {
+		supports[name] = version
+	}
+	return gmcpState{Client: s.client, Version: s.version, Supports: supports}
+}
+
+func (s *gmcpSession) resume(state gmcpState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	
+	s.client = state.Client
+	s.version = state.Version
+	for name, version := range state.Supports {
+		s.supports[name] = version
+	}
+}
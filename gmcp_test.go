@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+// createGMCPPlayer returns a player whose client has negotiated GMCP, with
+// an output queue the test can inspect.
+func createGMCPPlayer(t *testing.T, name string) *Player {
+	server, _ := telnetPipe(t)
+	server.options[TelnetOptionGMCP] = &telnetOption{local: true}
+	
+	player := createTestPlayer(name)
+	player.conn = server
+	player.telnet = server
+	player.gmcp = newGMCPSession(server)
+	player.health = 30
+	player.maxHealth = 30
+	player.damage = 5
+	player.output = make(chan outputFrame, outputQueueSize)
+	return player
+}
+
+// drainGMCP returns the GMCP messages queued for a player, keyed by package.
+func drainGMCP(player *Player) map[string]string {
+	messages := make(map[string]string)
+	for {
+		select {
+		case frame := <-player.output:
+			if frame.option == TelnetOptionGMCP {
+				pkg, payload := splitGMCP(frame.data)
+				messages[pkg] = string(payload)
+			}
+		default:
+			return messages
+		}
+	}
+}
+
+func TestGMCPSupports(t *testing.T) {
+	session := newGMCPSession(nil)
+	
+	if !session.supported("Char.Vitals") {
+		t.Error("Clients that never sent Core.Supports should get every package")
+	}
+	
+	session.receive([]byte(`Core.Supports.Set ["Char 1", "Room 1"]`))
+	if !session.supported("Char.Items.Inv") {
+		t.Error("Char.Items.Inv should be covered by the Char module")
+	}
+	if !session.supported("Room.Info") {
+		t.Error("Room.Info should be supported")
+	}
+	if session.supported("Comm.Channel") {
+		t.Error("Comm.Channel was not requested")
+	}
+	
+	session.receive([]byte(`Core.Supports.Remove ["Room"]`))
+	if session.supported("Room.Info") {
+		t.Error("Room module should have been removed")
+	}
+	
+	session.receive([]byte(`Core.Hello {"client": "Mudlet", "version": "4.17.2"}`))
+	if session.clientName() != "Mudlet 4.17.2" {
+		t.Errorf("Unexpected client name %q", session.clientName())
+	}
+}
+
+func TestGMCPUpdates(t *testing.T) {
+	game := NewGame()
+	player := createGMCPPlayer(t, "Mapper")
+	game.AddPlayer(player)
+	
+	game.updateGMCP()
+	messages := drainGMCP(player)
+	for _, pkg := range []string{"Char.Vitals", "Room.Info", "Char.Items.Inv", "Char.Combat.Target"} {
+		if _, ok := messages[pkg]; !ok {
+			t.Errorf("Expected initial %s message", pkg)
+		}
+	}
+	
+	var room gmcpRoomInfo
+	if err := json.Unmarshal([]byte(messages["Room.Info"]), &room); err != nil {
+		t.Fatalf("Bad Room.Info payload: %v", err)
+	}
+	if room.ID != "town_square" || room.Exits["north"] != roomNumber("tavern") {
+		t.Errorf("Unexpected Room.Info %+v", room)
+	}
+	
+	// Nothing changed, so nothing is sent again.
+	game.updateGMCP()
+	if messages := drainGMCP(player); len(messages) != 0 {
+		t.Errorf("Expected no messages without changes, got %v", messages)
+	}
+	
+	player.HandleCommand(game, "north")
+	player.HandleCommand(game, "get wooden mug")
+	game.updateGMCP()
+	messages = drainGMCP(player)
+	if !strings.Contains(messages["Room.Info"], `"tavern"`) {
+		t.Errorf("Expected Room.Info for the tavern, got %q", messages["Room.Info"])
+	}
+	if !strings.Contains(messages["Char.Items.Inv"], "wooden mug") {
+		t.Errorf("Expected inventory update, got %q", messages["Char.Items.Inv"])
+	}
+	if _, ok := messages["Char.Vitals"]; ok {
+		t.Error("Vitals did not change and should not be resent")
+	}
+	
+	player.HandleCommand(game, "south")
+	player.HandleCommand(game, "east")
+	player.HandleCommand(game, "attack bandit")
+	game.updateGMCP()
+	messages = drainGMCP(player)
+	if !strings.Contains(messages["Char.Combat.Target"], "bandit") {
+		t.Errorf("Expected combat target update, got %q", messages["Char.Combat.Target"])
+	}
+}
+
+func TestGMCPPingQueued(t *testing.T) {
+	game := newTestGame(t, testConfig(t))
+	game.Start()
+	defer game.Stop()
+	player := createGMCPPlayer(t, "Pinger")
+	game.Do(func() { player.gmcp.attach(game, player) })
+	
+	// The reply goes through the output queue rather than straight to the
+	// connection, so it can't cut into the writer's output.
+	player.gmcp.receive([]byte("Core.Ping"))
+	if _, ok := drainGMCP(player)["Core.Ping"]; !ok {
+		t.Error("Expected the Core.Ping reply to be queued")
+	}
+}
+
+func TestGMCPUpdatesDuringStalledWrite(t *testing.T) {
+	game := NewGame()
+	player := createGMCPPlayer(t, "Mapper")
+	game.AddPlayer(player)
+	
+	// A write that never finishes holds the connection's write lock.
+	player.telnet.writeMu.Lock()
+	defer player.telnet.writeMu.Unlock()
+	
+	done := make(chan struct{})
+	go func() {
+		player.updateGMCP()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("updateGMCP blocked behind a stalled write")
+	}
+	if _, ok := drainGMCP(player)["Char.Vitals"]; !ok {
+		t.Error("Expected Char.Vitals to be queued")
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// Item is one object in the world. Items are made from the prototypes in
+// the area files (itemProto), and each gets its own id, so two iron swords
+// are two items that can be told apart.
+type Item struct {
+	id          uint64
+	proto       string // id of the prototype it was made from, if any
+	name        string
+	description string
+	itemType    string // "weapon", "armor", "misc" or "corpse"
+	damage      int    // for weapons
+	defense     int    // for armor
+	
+	// A corpse holds the monster's loot and coins, and rots away at
+	// decays.
+	contents []*Item
+	gold     int
+	decays   time.Time
+}
+
+// tag names the item for builders: its prototype and id.
+func (i *Item) tag() string {
+	if i.proto == "" {
+		return fmt.Sprintf("#%d", i.id)
+	}
+	return fmt.Sprintf("%s #%d", i.proto, i.id)
+}
+
+// itemIDs hands out item ids. The world state saves the last one handed
+// out, and every id loaded from a save is reserved, so ids stay unique
+// across restarts. A saved id that is already in use is replaced instead.
+var itemIDs idCounter
+
+type idCounter struct {
+	last atomic.Uint64
+}
+
+// next returns an id that hasn't been handed out or reserved.
+func (c *idCounter) next() uint64 {
+	return c.last.Add(1)
+}
+
+// reserve makes sure id is never handed out.
+func (c *idCounter) reserve(id uint64) {
+	for {
+		last := c.last.Load()
+		if id <= last || c.last.CompareAndSwap(last, id) {
+			return
+		}
+	}
+}
+
+// newItem makes an item from the prototype with a new id.
+func (i *itemProto) newItem() *Item {
+	return &Item{
+		id:          itemIDs.next(),
+		proto:       i.id,
+		name:        i.name,
+		description: i.description,
+		itemType:    i.itemType,
+		damage:      i.damage,
+		defense:     i.defense,
+	}
+}
+
+// newItem makes an item from the prototype with an id, or nil if there is
+// no such prototype.
+func (g *Game) newItem(proto string) *Item {
+	if p := g.world.items[proto]; p != nil {
+		return p.newItem()
+	}
+	return nil
+}
+
+// itemValue is what an item is worth in gold, which its prototype decides.
+// Items that weren't made from one are worthless.
+func (g *Game) itemValue(item *Item) int {
+	if p := g.world.items[item.proto]; p != nil {
+		return p.value
+	}
+	return 0
+}
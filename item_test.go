@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestItemInstances(t *testing.T) {
+	game := NewGame()
+	first, second := game.newItem("iron_sword"), game.newItem("iron_sword")
+	if first == nil || second == nil {
+		t.Fatal("Expected iron swords from the prototype")
+	}
+	if first.id == second.id || first.proto != "iron_sword" || second.proto != "iron_sword" {
+		t.Errorf("Expected two iron swords with their own ids, got %s and %s", first.tag(), second.tag())
+	}
+	if game.newItem("no_such_item") != nil {
+		t.Error("Expected no item from an unknown prototype")
+	}
+	
+	alice, bob := createMockPlayer("Alice"), createMockPlayer("Bob")
+	alice.inventory = append(alice.inventory, first)
+	bob.inventory = append(bob.inventory, second)
+	alice.inventory[0].damage = 99
+	if bob.inventory[0].damage == 99 {
+		t.Error("Changing one player's sword should not change the other's")
+	}
+	
+	game.config.Builders = []string{"Alice"}
+	game.AddPlayer(alice)
+	alice.HandleCommand(game, "examine iron sword")
+	if !strings.Contains(lastMessage(alice), first.tag()) {
+		t.Errorf("Expected a builder to see the item's id, got %q", lastMessage(alice))
+	}
+}
+
+func TestItemIDsSurviveSnapshots(t *testing.T) {
+	game := NewGame()
+	mug := game.rooms["tavern"].items[0]
+	data, err := json.Marshal(game.snapshotWorld())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var world worldSnapshot
+	if err := json.Unmarshal(data, &world); err != nil {
+		t.Fatal(err)
+	}
+	
+	restored := NewGame()
+	restored.restoreWorld(world)
+	got := restored.rooms["tavern"].items[0]
+	if got.id != mug.id || got.proto != "wooden_mug" {
+		t.Errorf("Expected the mug to keep its id, got %s, want %s", got.tag(), mug.tag())
+	}
+	if next := restored.newItem("wooden_mug"); next.id <= world.LastItemID {
+		t.Errorf("Expected new ids after the saved ones, got %d after %d", next.id, world.LastItemID)
+	}
+	
+	// Items saved before they had ids get new ones.
+	old := itemSnapshot{Name: "old boot", Type: "misc"}.restore(nil)
+	if old.id == 0 {
+		t.Error("Expected an item from an old save to get an id")
+	}
+}
+
+func TestRestoredItemIDsDoNotCollide(t *testing.T) {
+	game := NewGame()
+	mug := game.rooms["tavern"].items[0]
+	
+	// A save made before the world state was thrown away holds an id the
+	// world has since handed out again.
+	saved := playerSnapshot{
+		Name:      "Returner",
+		Inventory: []itemSnapshot{{ID: mug.id, Proto: "rusty_sword", Name: "rusty sword", Type: "weapon"}},
+	}
+	player := createTestPlayer("")
+	saved.restore(player, game.itemsInUse())
+	game.AddPlayer(player)
+	
+	sword := player.inventory[0]
+	if sword.id == mug.id {
+		t.Fatalf("Expected the restored sword to get a new id, both are %s", mug.tag())
+	}
+	if next := game.newItem("wooden_mug"); next.id == sword.id || next.id == mug.id {
+		t.Errorf("Expected a new id, got %s again", next.tag())
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// levelXP is the total experience needed for each level: levelXP[n] is
+// what it takes to reach level n+1. The last entry is the highest level.
+var levelXP = []int{0, 100, 250, 450, 700, 1000, 1400, 1900, 2500, 3200}
+
+const (
+	// Each level gained raises maximum health and base damage by these,
+	// and heals the player fully.
+	levelHealthGain = 5
+	levelDamageGain = 1
+	
+	// scoreBarWidth is how many characters the progress bar in score has.
+	scoreBarWidth = 20
+)
+
+// maxLevel is the highest level there is.
+func maxLevel() int {
+	return len(levelXP)
+}
+
+// xpForLevel is the total experience needed to reach a level.
+func xpForLevel(level int) int {
+	return levelXP[level-1]
+}
+
+// killXP is the experience for killing a monster. A monster is worth its
+// health plus three times its damage, scaled by how strong it is next to
+// the player, so a rat is worth little to a veteran and a dragon a lot to a
+// beginner.
+func killXP(m *Monster, p *Player) int {
+	monsterPower := m.maxHealth + 3*m.damage
+	playerPower := p.maxHealth + 3*p.attackDamage()
+	return max(monsterPower*monsterPower/max(playerPower, 1), 1)
+}
+
+// attackDamage is the player's damage with their weapon.
+func (p *Player) attackDamage() int {
+	if p.weapon != nil {
+		return p.damage + p.weapon.damage
+	}
+	return p.damage
+}
+
+// awardXP gives the player experience and any levels it earns them.
+func (g *Game) awardXP(p *Player, xp int) {
+	p.level = max(p.level, 1)
+	p.xp += xp
+	p.SendMessage(ColorSuccess(fmt.Sprintf("You gain %d experience.", xp)))
+	
+	for p.level < maxLevel() && p.xp >= xpForLevel(p.level+1) {
+		p.level++
+		p.maxHealth += levelHealthGain
+		p.damage += levelDamageGain
+		p.health = p.maxHealth
+		p.SendMessage(ColorMagic(fmt.Sprintf("You have reached level %d!", p.level)))
+		p.SendMessage(ColorSuccess(fmt.Sprintf("Your maximum health increases to %d and your base damage to %d.", p.maxHealth, p.damage)))
+		g.broadcastAll(ColorInfo(fmt.Sprintf("%s has reached level %d!", ColorName(p.name), p.level)), p)
+	}
+}
+
+// showScore sends the player their level, stats and progress to the next
+// level.
+func (g *Game) showScore(p *Player) {
+	level := max(p.level, 1)
+	p.SendMessage(fmt.Sprintf("%s%s%s, level %d", ColorBold, ColorName(p.name), ColorReset, level))
+	p.SendMessage(fmt.Sprintf("  Health:     %d/%d", p.health, p.maxHealth))
+	p.SendMessage(fmt.Sprintf("  Damage:     %d (%d with your weapon)", p.damage, p.attackDamage()))
+	if p.armor != nil {
+		p.SendMessage(fmt.Sprintf("  Defense:    %d", p.armor.defense))
+	}
+	p.SendMessage(fmt.Sprintf("  Gold:       %d", p.gold))
+	if level >= maxLevel() {
+		p.SendMessage(fmt.Sprintf("  Experience: %d (the highest level)", p.xp))
+		return
+	}
+	
+	from, to := xpForLevel(level), xpForLevel(level+1)
+	filled := min(max((p.xp-from)*scoreBarWidth/(to-from), 0), scoreBarWidth)
+	bar := strings.Repeat("#", filled) + strings.Repeat("-", scoreBarWidth-filled)
+	p.SendMessage(fmt.Sprintf("  Experience: %d/%d [%s] %d to level %d", p.xp, to, bar, to-p.xp, level+1))
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestKillXP(t *testing.T) {
+	player := createMockPlayer("Novice")
+	rat := NewMonster("giant rat", "", 15, 3, true)
+	dragon := NewMonster("ancient dragon", "", 100, 15, true)
+	if xp := killXP(rat, player); xp != 12 {
+		t.Errorf("Expected 12 experience for a rat, got %d", xp)
+	}
+	if xp := killXP(dragon, player); xp != 467 {
+		t.Errorf("Expected 467 experience for a dragon, got %d", xp)
+	}
+	
+	player.maxHealth, player.damage = 80, 12
+	player.weapon = &Item{name: "iron sword", itemType: "weapon", damage: 8}
+	if xp := killXP(rat, player); xp != 4 {
+		t.Errorf("Expected a rat to be worth little to a veteran, got %d", xp)
+	}
+}
+
+func TestLevelUp(t *testing.T) {
+	game := NewGame()
+	player := createMockPlayer("Climber")
+	other := createMockPlayer("Onlooker")
+	game.AddPlayer(player)
+	game.AddPlayer(other)
+	player.health = 10
+	
+	game.awardXP(player, 60)
+	if player.level != 1 || player.xp != 60 {
+		t.Fatalf("Expected level 1 with 60 experience, got level %d with %d", player.level, player.xp)
+	}
+	game.awardXP(player, 200)
+	if player.level != 3 || player.maxHealth != 40 || player.damage != 7 || player.health != 40 {
+		t.Errorf("Expected level 3 with 40 health and 7 damage, got level %d, %d/%d health, %d damage", player.level, player.health, player.maxHealth, player.damage)
+	}
+	if !strings.Contains(lastMessage(other), "has reached level 3") {
+		t.Errorf("Expected the level to be announced, got %q", lastMessage(other))
+	}
+	
+	clearPlayerMessages(player)
+	player.HandleCommand(game, "score")
+	got := ansiCodes.ReplaceAllString(strings.Join(getPlayerMessages(player), "\n"), "")
+	for _, want := range []string{"Climber, level 3", "Health:     40/40", "Experience: 260/450 [#-------------------] 190 to level 4"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Expected %q in score:\n%s", want, got)
+		}
+	}
+	
+	game.awardXP(player, 100000)
+	if player.level != maxLevel() {
+		t.Errorf("Expected the highest level, got %d", player.level)
+	}
+	player.HandleCommand(game, "score")
+	if !strings.Contains(lastMessage(player), "the highest level") {
+		t.Errorf("Expected score to show the highest level, got %q", lastMessage(player))
+	}
+}
+
+func TestLevelSaved(t *testing.T) {
+	player := createTestPlayer("Veteran")
+	player.level, player.xp = 4, 500
+	loaded := createTestPlayer("")
+	player.snapshot().restore(loaded, nil)
+	if loaded.level != 4 || loaded.xp != 500 {
+		t.Errorf("Expected level 4 with 500 experience, got %d and %d", loaded.level, loaded.xp)
+	}
+	
+	old := playerSnapshot{Name: "Oldtimer", Health: 30, MaxHealth: 30, Damage: 5}
+	old.restore(loaded, nil)
+	if loaded.level != 1 || loaded.xp != 0 {
+		t.Errorf("Expected a save from before levels to be level 1, got %d", loaded.level)
+	}
+}
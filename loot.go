@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+// rollLoot picks what a monster drops: rolls picks from its weighted loot
+// table, each giving a number of the item in its range, then a chance at
+// each rare drop. It returns the item ids, with the rare ones separate so
+// they can be announced. intn is rand.Intn, or a fixed source in tests.
+func (m *monsterProto) rollLoot(intn func(int) int) (loot, rare []string) {
+	total := 0
+	for _, entry := range m.loot {
+		total += entry.weight
+	}
+	rolls := max(m.rolls, 1)
+	for range rolls {
+		if total == 0 {
+			break
+		}
+		pick := intn(total)
+		for _, entry := range m.loot {
+			if pick >= entry.weight {
+				pick -= entry.weight
+				continue
+			}
+			if entry.item != "" {
+				for range entry.min + intn(entry.max-entry.min+1) {
+					loot = append(loot, entry.item)
+				}
+			}
+			break
+		}
+	}
+	for _, drop := range m.rare {
+		if intn(drop.oneIn) == 0 {
+			rare = append(rare, drop.item)
+		}
+	}
+	return loot, rare
+}
+
+// rollGold picks how many coins a monster carries.
+func (m *monsterProto) rollGold(intn func(int) int) int {
+	if m.goldMax == 0 {
+		return 0
+	}
+	return m.goldMin + intn(m.goldMax-m.goldMin+1)
+}
+
+// leaveCorpse puts the corpse of a monster that was just killed in its
+// room, holding the loot and coins rolled for it.
+func (g *Game) leaveCorpse(killer *Player, monster *Monster) {
+	room := monster.location
+	if room == nil {
+		return
+	}
+	corpse := &Item{
+		id:          itemIDs.next(),
+		name:        monster.name + " corpse",
+		description: fmt.Sprintf("What is left of the %s.", monster.name),
+		itemType:    "corpse",
+		decays:      time.Now().Add(time.Duration(g.config.World.CorpseDecay)),
+	}
+	var rare []string
+	if proto := g.world.monsters[monster.proto]; proto != nil {
+		var loot []string
+		loot, rare = proto.rollLoot(rand.Intn)
+		for _, id := range append(loot, rare...) {
+			if item := g.newItem(id); item != nil {
+				corpse.contents = append(corpse.contents, item)
+			}
+		}
+		corpse.gold = proto.rollGold(rand.Intn)
+	}
+	room.items = append(room.items, corpse)
+	
+	room.Broadcast(fmt.Sprintf("The %s falls to the ground, leaving a %s.", ColorMonster(monster.name), ColorItem(corpse.name)), nil)
+	if len(rare) > 0 {
+		killer.SendMessage(ColorMagic("Something rare glints among the remains!"))
+	}
+}
+
+// findCorpse returns the corpse in the room that name refers to: its full
+// name, the end of it ("rat corpse") or just "corpse". The oldest matching
+// corpse comes first.
+func (r *Room) findCorpse(name string) *Item {
+	for _, item := range r.items {
+		if item.itemType != "corpse" {
+			continue
+		}
+		itemName := strings.ToLower(item.name)
+		if itemName == name || strings.HasSuffix(itemName, " "+name) {
+			return item
+		}
+	}
+	return nil
+}
+
+// lootCorpse runs "get <item> from <corpse>" and "get all from <corpse>".
+// "get gold from <corpse>" takes just the coins.
+func (g *Game) lootCorpse(p *Player, itemName, corpseName string) {
+	corpse := p.location.findCorpse(corpseName)
+	if corpse == nil {
+		p.SendMessage(ColorError(fmt.Sprintf("You don't see a %s here.", corpseName)))
+		return
+	}
+	if len(corpse.contents) == 0 && corpse.gold == 0 {
+		p.SendMessage(ColorInfo(fmt.Sprintf("The %s is empty.", ColorItem(corpse.name))))
+		return
+	}
+	
+	gold := 0
+	if itemName == "all" || isGold(itemName) {
+		gold = corpse.gold
+	}
+	var taken, left []*Item
+	for _, item := range corpse.contents {
+		if itemName == "all" || strings.ToLower(item.name) == itemName && len(taken) == 0 {
+			taken = append(taken, item)
+		} else {
+			left = append(left, item)
+		}
+	}
+	if len(taken) == 0 && gold == 0 {
+		p.SendMessage(ColorError(fmt.Sprintf("There is no %s in the %s.", itemName, ColorItem(corpse.name))))
+		return
+	}
+	corpse.contents = left
+	corpse.gold -= gold
+	p.gold += gold
+	if gold > 0 {
+		p.SendMessage(fmt.Sprintf("You take %s from the %s.", goldCoins(gold), ColorItem(corpse.name)))
+	}
+	p.inventory = append(p.inventory, taken...)
+	for _, item := range taken {
+		p.SendMessage(fmt.Sprintf("You take the %s from the %s.", ColorItem(item.name), ColorItem(corpse.name)))
+	}
+	p.location.Broadcast(fmt.Sprintf("%s loots the %s.", ColorName(p.name), ColorItem(corpse.name)), p)
+}
+
+// describeCorpse shows what is left in a corpse.
+func describeCorpse(p *Player, corpse *Item) {
+	p.SendMessage(fmt.Sprintf("%s: %s", ColorItem(corpse.name), corpse.description))
+	if len(corpse.contents) == 0 && corpse.gold == 0 {
+		p.SendMessage("  It has nothing on it.")
+		return
+	}
+	if corpse.gold > 0 {
+		p.SendMessage(fmt.Sprintf("  %s", goldCoins(corpse.gold)))
+	}
+	for _, item := range corpse.contents {
+		p.SendMessage(fmt.Sprintf("  %s", ColorItem(item.name)))
+	}
+}
+
+// decayCorpses removes the corpses that have lain long enough, with
+// whatever is still in them.
+func (g *Game) decayCorpses(now time.Time) {
+	for _, room := range g.rooms {
+		kept := room.items[:0]
+		for _, item := range room.items {
+			if item.itemType == "corpse" && !now.Before(item.decays) {
+				room.Broadcast(fmt.Sprintf("The %s rots away.", ColorItem(item.name)), nil)
+				continue
+			}
+			kept = append(kept, item)
+		}
+		room.items = kept
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// fixedRolls returns an intn that gives back the values in order.
+func fixedRolls(t *testing.T, values ...int) func(int) int {
+	return func(n int) int {
+		if len(values) == 0 {
+			t.Fatal("Rolled more often than expected")
+		}
+		v := values[0]
+		values = values[1:]
+		if v >= n {
+			t.Fatalf("Roll %d is out of range for Intn(%d)", v, n)
+		}
+		return v
+	}
+}
+
+func TestRollLoot(t *testing.T) {
+	monster := &monsterProto{
+		loot: []lootEntry{
+			{item: "bone", weight: 30, min: 1, max: 3},
+			{item: "", weight: 60, min: 1, max: 1},
+			{item: "tooth", weight: 10, min: 1, max: 1},
+		},
+		rolls: 2,
+		rare:  []rareDrop{{item: "ruby", oneIn: 50}},
+	}
+	
+	// A roll of 12 lands on the bones, and 2 more than the minimum of 1
+	// drop; 95 lands on the tooth; the rare drop hits on 0.
+	loot, rare := monster.rollLoot(fixedRolls(t, 12, 2, 95, 0, 0))
+	if strings.Join(loot, ",") != "bone,bone,bone,tooth" || strings.Join(rare, ",") != "ruby" {
+		t.Errorf("Unexpected drops %v and %v", loot, rare)
+	}
+	
+	// 30 to 89 is nothing, and the ruby misses.
+	loot, rare = monster.rollLoot(fixedRolls(t, 30, 89, 1))
+	if len(loot) != 0 || len(rare) != 0 {
+		t.Errorf("Expected no drops, got %v and %v", loot, rare)
+	}
+}
+
+func TestLootDefinitions(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a.area": {Data: []byte(`monster rat
+  name rat
+  health 3
+  loot tail
+  loot tail 0
+  loot tail 5 3-1
+  loot gem 5
+  rolls 0
+  rare ruby 0
+`)},
+	}
+	_, err := loadWorldData(fsys, "areas")
+	if err == nil {
+		t.Fatal("Expected errors")
+	}
+	for _, want := range []string{
+		`areas/a.area:4: loot needs an item, a weight`,
+		`areas/a.area:5: loot weight must be a positive number, got "0"`,
+		`areas/a.area:6: loot quantity must be a number or a range like 1-3, got "3-1"`,
+		`areas/a.area:7: monster rat drops unknown item "gem"`,
+		`areas/a.area:8: rolls must be at least 1`,
+		`areas/a.area:9: rare needs an item and how rare it is`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected error %q in:\n%v", want, err)
+		}
+	}
+}
+
+func TestCorpses(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "den.area"), []byte(`item tooth
+  name rat tooth
+
+item tail
+  name rat tail
+
+monster rat
+  name giant rat
+  health 1
+  loot tooth 1 2
+  rare tail 1
+
+room den
+  name Den
+  spawn rat
+`), 0644)
+	config := testConfig(t)
+	config.World.Dir = dir
+	config.Player.StartRoom = "den"
+	config.Player.RespawnRoom = "den"
+	game := newTestGame(t, config)
+	player := createMockPlayer("Hunter")
+	watcher := createMockPlayer("Watcher")
+	game.AddPlayer(player)
+	game.AddPlayer(watcher)
+	den := game.rooms["den"]
+	
+	player.HandleCommand(game, "attack giant rat")
+	corpse := den.findCorpse("corpse")
+	if corpse == nil || corpse.name != "giant rat corpse" || len(corpse.contents) != 3 {
+		t.Fatalf("Expected a corpse with two teeth and a tail, got %+v", corpse)
+	}
+	if got := strings.Join(getPlayerMessages(player), "\n"); !strings.Contains(got, "rare") || !strings.Contains(lastMessage(watcher), "giant rat corpse") {
+		t.Errorf("Expected the rare drop and the corpse to be announced, got:\n%s\nand %q", got, lastMessage(watcher))
+	}
+	
+	player.HandleCommand(game, "get giant rat corpse")
+	if player.carries("giant rat corpse") {
+		t.Error("Corpses should not be carried")
+	}
+	clearPlayerMessages(player)
+	player.HandleCommand(game, "examine rat corpse")
+	if got := strings.Join(getPlayerMessages(player), "\n"); !strings.Contains(got, "rat tooth") || !strings.Contains(got, "rat tail") {
+		t.Errorf("Expected examine to list the loot, got:\n%s", got)
+	}
+	
+	player.HandleCommand(game, "get rat tail from corpse")
+	if !player.carries("rat tail") || len(corpse.contents) != 2 {
+		t.Fatalf("Expected to take the tail, got %q", lastMessage(player))
+	}
+	player.HandleCommand(game, "get all from corpse")
+	if len(player.inventory) != 3 || len(corpse.contents) != 0 {
+		t.Fatalf("Expected to take everything, got %q", lastMessage(player))
+	}
+	if player.inventory[1].id == player.inventory[2].id {
+		t.Error("The two teeth should be separate items")
+	}
+	player.HandleCommand(game, "get all from corpse")
+	if !strings.Contains(lastMessage(player), "empty") {
+		t.Errorf("Expected the corpse to be empty, got %q", lastMessage(player))
+	}
+	
+	// Corpses are kept with the world state until they rot.
+	corpse.contents = append(corpse.contents, game.newItem("tooth"))
+	restored := newTestGame(t, config)
+	restored.restoreWorld(game.snapshotWorld())
+	saved := restored.rooms["den"].findCorpse("corpse")
+	if saved == nil || len(saved.contents) != 1 || !saved.decays.Equal(corpse.decays) {
+		t.Errorf("Expected the corpse to survive a restart, got %+v", saved)
+	}
+	
+	game.decayCorpses(corpse.decays.Add(-time.Second))
+	if den.findCorpse("corpse") == nil {
+		t.Fatal("The corpse should not rot early")
+	}
+	game.decayCorpses(corpse.decays)
+	if den.findCorpse("corpse") != nil || !strings.Contains(lastMessage(player), "rots away") {
+		t.Errorf("Expected the corpse to rot away, got %q", lastMessage(player))
+	}
+}
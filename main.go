@@ -2,83 +2,277 @@ package main
 
 import (
 	"bufio"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"net"
+	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
 )
 
-func handleConnection(conn net.Conn, game *Game) {
+func handleConnection(rawConn net.Conn, game *Game) {
+	conn, gmcp := newTelnetSession(rawConn)
+	conn.Negotiate()
+	
+	runSession(conn, game, gmcp)
+}
+
+// newTelnetSession wraps a client connection with the telnet layer and GMCP.
+func newTelnetSession(rawConn net.Conn) (*TelnetConn, *gmcpSession) {
+	conn := NewTelnetConn(rawConn)
+	gmcp := newGMCPSession(conn)
+	conn.Handle(TelnetOptionGMCP, gmcp.receive)
+	return conn, gmcp
+}
+
+// runSession logs a player in and feeds their commands to the game until the
+// connection closes. Every transport (telnet, WebSocket) ends up here; gmcp
+// is nil for connections that cannot carry GMCP.
+func runSession(conn net.Conn, game *Game, gmcp *gmcpSession) {
+	game.sessions.add(conn)
+	defer game.sessions.done(conn)
 	defer conn.Close()
 	
 	GlobalTelemetry.IncrementConnections()
 	defer GlobalTelemetry.DecrementActiveConnections()
 	
 	fmt.Fprintf(conn, "%sWelcome to the MUD!%s\r\n", ColorBold+ColorBrightGreen, ColorReset)
-	fmt.Fprintf(conn, "%sWhat is your name?%s ", ColorBrightCyan, ColorReset)
 	
 	scanner := bufio.NewScanner(conn)
-	
-	if !scanner.Scan() {
+	name, ok := login(conn, scanner, game.accounts)
+	if !ok {
 		return
 	}
 	
-	name := strings.TrimSpace(scanner.Text())
-	if name == "" {
-		fmt.Fprintf(conn, "%sInvalid name. Goodbye!%s\r\n", ColorError(""), ColorReset)
+	var playing bool
+	if !game.Do(func() { playing = game.findPlayer(name) != nil }) {
 		return
 	}
-	
-	player := &Player{
-		conn:      conn,
-		name:      name,
-		scanner:   scanner,
-		inventory: make([]*Item, 0),
-		health:    30,
-		maxHealth: 30,
-		damage:    5,
+	if playing {
+		fmt.Fprintf(conn, "%s ", ColorWarning(fmt.Sprintf("%s is already playing. Take over that session? (y/n)", name)))
+		if !scanner.Scan() || !strings.HasPrefix(strings.ToLower(strings.TrimSpace(scanner.Text())), "y") {
+			fmt.Fprintf(conn, "%s\r\n", ColorInfo("Goodbye!"))
+			return
+		}
 	}
 	
-	GlobalTelemetry.IncrementPlayersCreated()
-	game.AddPlayer(player)
-	defer game.RemovePlayer(player)
-	
-	player.SendMessage(fmt.Sprintf("%sHello, %s!%s", ColorBrightGreen, ColorName(name), ColorReset))
-	player.HandleCommand(game, "look")
-	
-	player.location.Broadcast(fmt.Sprintf("%s has entered the game.", ColorName(name)), player)
-	
-	for scanner.Scan() {
-		command := scanner.Text()
-		player.HandleCommand(game, command)
+	// The save is loaded on the game loop once the player is known not to
+	// be playing, so a session that quits while the prompt above waits has
+	// saved its latest progress first.
+	var loadErr error
+	playSession(game, conn, scanner, func() *Player {
+		if existing := game.findPlayer(name); existing != nil {
+			log.Printf("%s took over their session from %v", name, conn.RemoteAddr())
+			existing.takeOver(conn, gmcp)
+			gmcp.attach(game, existing)
+			existing.SendMessage(ColorSuccess("You take over your session."))
+			existing.HandleCommand(game, "look")
+			return existing
+		}
+		
+		saved, err := game.saves.Load(name)
+		if err != nil && !errors.Is(err, errNoSave) {
+			loadErr = err
+			return nil
+		}
+		
+		player := NewPlayer(conn, name)
+		player.gmcp = gmcp
+		gmcp.attach(game, player)
+		if err == nil {
+			saved.restore(player, game.itemsInUse())
+			game.addPlayerAt(player, game.roomOrStart(saved.Room))
+			player.SendMessage(fmt.Sprintf("%sWelcome back, %s!%s", ColorBrightGreen, ColorName(name), ColorReset))
+		} else {
+			player.health = game.config.Player.Health
+			player.maxHealth = game.config.Player.Health
+			player.damage = game.config.Player.Damage
+			player.gold = game.config.Player.Gold
+			GlobalTelemetry.IncrementPlayersCreated()
+			game.AddPlayer(player)
+			player.SendMessage(fmt.Sprintf("%sHello, %s!%s", ColorBrightGreen, ColorName(name), ColorReset))
+		}
+		player.HandleCommand(game, "look")
+		player.location.Broadcast(fmt.Sprintf("%s has entered the game.", ColorName(name)), player)
+		return player
+	})
+	if loadErr != nil {
+		log.Printf("Failed to load %s: %v", name, loadErr)
+		fmt.Fprintf(conn, "%s\r\n", ColorError("Your saved character could not be loaded. Please contact an admin."))
 	}
-	
-	player.location.Broadcast(fmt.Sprintf("%s has left the game.", ColorName(name)), player)
 }
 
-func main() {
-	game := NewGame()
+// resumeSession puts a player handed over by a copyover back where they
+// were, without logging in again.
+func resumeSession(conn net.Conn, game *Game, gmcp *gmcpSession, saved playerSnapshot) {
+	game.sessions.add(conn)
+	defer game.sessions.done(conn)
+	defer conn.Close()
 	
-	GlobalTelemetry.StartPeriodicLogging(5 * time.Minute)
+	GlobalTelemetry.IncrementConnections()
+	defer GlobalTelemetry.DecrementActiveConnections()
 	
-	listener, err := net.Listen("tcp", ":4000")
-	if err != nil {
-		log.Fatal("Failed to start server:", err)
+	playSession(game, conn, bufio.NewScanner(conn), func() *Player {
+		player := NewPlayer(conn, saved.Name)
+		saved.restore(player, game.itemsInUse())
+		player.gmcp = gmcp
+		gmcp.attach(game, player)
+		
+		game.addPlayerAt(player, game.roomOrStart(saved.Room))
+		player.SendMessage(ColorSuccess("Copyover complete."))
+		player.HandleCommand(game, "look")
+		return player
+	})
+}
+
+// playSession runs enter on the game loop to bring a player in on conn,
+// then feeds their commands to the game until the connection closes. enter
+// returns nil to turn the connection away. If another connection takes the
+// player over meanwhile, the player is left in the game for it.
+func playSession(game *Game, conn net.Conn, scanner *bufio.Scanner, enter func() *Player) {
+	var player *Player
+	if !game.Do(func() {
+		if player = enter(); player != nil {
+			player.scanner = scanner
+		}
+	}) || player == nil {
+		return
 	}
-	defer listener.Close()
 	
-	fmt.Println("MUD server listening on port 4000")
-	fmt.Println("Connect with: telnet localhost 4000")
-	fmt.Printf("Telemetry: %s\n", GlobalTelemetry.GetSummary())
+	for scanner.Scan() {
+		if !game.SubmitCommand(player, scanner.Text()) {
+			break
+		}
+	}
 	
+	owned := true
+	game.Do(func() {
+		owned = player.conn == conn
+		if !owned {
+			return
+		}
+		game.savePlayer(player)
+		player.location.Broadcast(fmt.Sprintf("%s has left the game.", ColorName(player.name)), player)
+		game.RemovePlayer(player)
+	})
+	if owned {
+		player.stopOutput()
+	}
+}
+
+// serve accepts connections until the listener is closed.
+func serve(listener net.Listener, game *Game) {
 	for {
 		conn, err := listener.Accept()
 		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
 			log.Printf("Failed to accept connection: %v", err)
 			continue
 		}
 		
 		go handleConnection(conn, game)
 	}
-}
\ No newline at end of file
+}
+
+func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "validate":
+			os.Exit(validateCommand(os.Args[2:], os.Stdout, os.Stderr))
+		case "map":
+			os.Exit(mapCommand(os.Args[2:], os.Stdout, os.Stderr))
+		}
+	}
+	
+	config, err := LoadConfig(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		PrintConfigUsage(os.Stdout)
+		return
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	
+	if config.Log.File != "" {
+		logFile, err := os.OpenFile(config.Log.File, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			log.Fatal("Failed to open log file: ", err)
+		}
+		defer logFile.Close()
+		log.SetOutput(logFile)
+		GlobalTelemetry.SetOutput(logFile)
+	}
+	
+	copyover, err := loadCopyoverState()
+	if err != nil {
+		log.Printf("Ignoring copyover state: %v", err)
+	}
+	
+	game, err := NewGameWithConfig(config)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "cannot start the game:")
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	switch {
+	case copyover != nil:
+		game.restoreWorld(copyover.World)
+	case config.World.Fresh:
+		log.Printf("Starting with a fresh world")
+	default:
+		if err := game.loadWorld(); err != nil {
+			log.Fatal("Failed to load world state (use -fresh to start without it): ", err)
+		}
+	}
+	game.Start()
+	
+	if config.Telemetry.Enabled {
+		GlobalTelemetry.StartPeriodicLogging(time.Duration(config.Telemetry.Interval))
+		if config.Telemetry.DumpFile != "" {
+			GlobalTelemetry.StartPeriodicDump(config.Telemetry.DumpFile, time.Duration(config.Telemetry.Interval))
+		}
+	}
+	
+	server := NewServer(config, game)
+	if copyover != nil {
+		server.inherit(copyover.Listeners)
+	}
+	if err := server.Listen(); err != nil {
+		log.Fatal("Failed to start server: ", err)
+	}
+	server.Serve()
+	if copyover != nil {
+		server.resume(copyover)
+	}
+	
+	if config.TLS.Address != "" {
+		fmt.Printf("TLS listener on %s\n", config.TLS.Address)
+	}
+	if config.Web != "" {
+		fmt.Printf("Play in a browser at http://localhost:%s/\n", listenPort(config.Web))
+	}
+	fmt.Printf("MUD server listening on %s\n", config.Telnet)
+	fmt.Printf("Connect with: telnet localhost %s\n", listenPort(config.Telnet))
+	fmt.Printf("Telemetry: %s\n", GlobalTelemetry.GetSummary())
+	
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	sig := <-signals
+	log.Printf("Received %v", sig)
+	server.Shutdown(time.Duration(config.ShutdownCountdown), signals)
+}
+
+// listenPort returns the port of a listen address for display.
+func listenPort(address string) string {
+	if _, port, err := net.SplitHostPort(address); err == nil {
+		return port
+	}
+	return address
+}
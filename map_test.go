@@ -1,47 +1,14 @@
 package main
 
 import (
-	"fmt"
-	"image"
-	"image/color"
-	"image/draw"
+	"bytes"
 	"image/png"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
-
-	"golang.org/x/image/font"
-	"golang.org/x/image/font/basicfont"
-	"golang.org/x/image/math/fixed"
 )
 
-type RoomPosition struct {
-	x, y, z int
-}
-
-var roomPositions = map[string]RoomPosition{
-	"town_square":      {2, 2, 0},
-	"tavern":           {2, 1, 0},
-	"forest":           {2, 3, 0},
-	"market":           {3, 2, 0},
-	"temple":           {1, 2, 0},
-	"armory":           {2, 1, 1},
-	"deep_forest":      {2, 4, 0},
-	"dungeon":          {2, 3, -1},
-	"catacombs":        {1, 2, -1},
-	"wizard_tower":     {1, 2, 1},
-	"dragon_lair":      {3, 4, 0},
-	"cemetery":         {1, 4, 0},
-	"pirate_cove":      {3, 3, 0},
-	"volcanic_cavern":  {3, 3, -1},
-	"ice_fortress":     {2, 2, 2},
-	"sky_temple":       {1, 2, 2},
-	"cursed_swamp":     {0, 3, 0},
-	"crystal_mines":    {3, 2, -1},
-	"haunted_library":  {0, 2, 0},
-	"goblin_warren":    {3, 2, 1},
-}
-
 func TestRoomConnectivity(t *testing.T) {
 	game := NewGame()
 	
@@ -214,284 +181,125 @@ func TestRoomContents(t *testing.T) {
 	t.Logf("All room content tests passed")
 }
 
-func TestGenerateMapPNG(t *testing.T) {
+func TestLayoutRooms(t *testing.T) {
 	game := NewGame()
-	
-	// Create image
-	const (
-		cellSize = 120
-		margin   = 50
-		mapWidth = 5
-		mapHeight = 5
-		levels   = 4 // -1, 0, 1, 2
-	)
-	
-	imgWidth := mapWidth*cellSize + 2*margin + 200 // extra space for legend
-	imgHeight := levels*mapHeight*cellSize + 2*margin + 100
-	
-	img := image.NewRGBA(image.Rect(0, 0, imgWidth, imgHeight))
-	
-	// Fill background
-	draw.Draw(img, img.Bounds(), &image.Uniform{color.RGBA{240, 240, 240, 255}}, image.Point{}, draw.Src)
-	
-	// Colors for different room types
-	colors := map[string]color.RGBA{
-		"town_square":  {100, 200, 100, 255}, // Green
-		"tavern":       {200, 150, 100, 255}, // Brown
-		"forest":       {50, 150, 50, 255},   // Dark green
-		"market":       {200, 200, 100, 255}, // Yellow
-		"temple":       {150, 150, 200, 255}, // Light blue
-		"armory":       {150, 150, 150, 255}, // Gray
-		"deep_forest":  {30, 100, 30, 255},   // Very dark green
-		"dungeon":      {100, 50, 50, 255},   // Dark red
-		"catacombs":    {80, 80, 80, 255},    // Dark gray
-		"wizard_tower": {150, 100, 200, 255}, // Purple
-		"dragon_lair":  {200, 50, 50, 255},   // Red
-		"cemetery":     {120, 120, 120, 255}, // Medium gray
+	positions := layoutRooms(game.rooms, "town_square")
+	if len(positions) != len(game.rooms) {
+		t.Fatalf("Expected every room placed, got %d of %d", len(positions), len(game.rooms))
 	}
 	
-	// Draw rooms for each level
-	for level := -1; level <= 2; level++ {
-		levelOffset := (level + 1) * (mapHeight * cellSize + 30)
-		
-		// Draw level label
-		drawText(img, fmt.Sprintf("Level %d", level), margin-30, margin+levelOffset-10, color.RGBA{0, 0, 0, 255})
-		
-		for roomKey, pos := range roomPositions {
-			if pos.z != level {
-				continue
-			}
-			
-			room := game.rooms[roomKey]
-			if room == nil {
-				continue
-			}
-			
-			x := margin + pos.x*cellSize
-			y := margin + levelOffset + pos.y*cellSize
-			
-			// Draw room rectangle
-			roomColor := colors[roomKey]
-			if roomColor.A == 0 {
-				roomColor = color.RGBA{200, 200, 200, 255} // Default gray
-			}
-			
-			drawRect(img, x, y, cellSize-10, cellSize-10, roomColor)
-			
-			// Draw room name
-			lines := splitRoomName(room.name)
-			for i, line := range lines {
-				drawText(img, line, x+5, y+15+i*12, color.RGBA{0, 0, 0, 255})
-			}
-			
-			// Draw monster count
-			if len(room.monsters) > 0 {
-				drawText(img, fmt.Sprintf("M:%d", len(room.monsters)), x+5, y+cellSize-25, color.RGBA{200, 0, 0, 255})
-			}
-			
-			// Draw item indicator
-			if len(room.items) > 0 {
-				drawText(img, fmt.Sprintf("I:%d", len(room.items)), x+5, y+cellSize-12, color.RGBA{0, 0, 200, 255})
-			}
-		}
-		
-		// Draw connections for this level
-		for roomKey, pos := range roomPositions {
-			if pos.z != level {
-				continue
-			}
-			
-			room := game.rooms[roomKey]
-			if room == nil {
-				continue
-			}
-			
-			x1 := margin + pos.x*cellSize + cellSize/2
-			y1 := margin + levelOffset + pos.y*cellSize + cellSize/2
-			
-			for dir, connectedRoom := range room.exits {
-				connectedKey := ""
-				for key, r := range game.rooms {
-					if r == connectedRoom {
-						connectedKey = key
-						break
-					}
-				}
-				
-				if connectedPos, exists := roomPositions[connectedKey]; exists && connectedPos.z == level {
-					x2 := margin + connectedPos.x*cellSize + cellSize/2
-					y2 := margin + levelOffset + connectedPos.y*cellSize + cellSize/2
-					
-					// Draw connection line
-					drawLine(img, x1, y1, x2, y2, color.RGBA{100, 100, 100, 255})
-					
-					// Draw direction label
-					midX := (x1 + x2) / 2
-					midY := (y1 + y2) / 2
-					drawText(img, strings.ToUpper(dir[:1]), midX-3, midY+3, color.RGBA{50, 50, 50, 255})
-				}
-			}
+	seen := make(map[mapPos]string)
+	for id, pos := range positions {
+		if other, taken := seen[pos]; taken {
+			t.Errorf("Rooms %s and %s share position %v", id, other, pos)
 		}
+		seen[pos] = id
 	}
 	
-	// Draw legend
-	legendX := mapWidth*cellSize + margin + 20
-	legendY := margin
-	
-	drawText(img, "MUD World Map", legendX, legendY, color.RGBA{0, 0, 0, 255})
-	legendY += 25
-	
-	drawText(img, "Legend:", legendX, legendY, color.RGBA{0, 0, 0, 255})
-	legendY += 20
-	
-	drawText(img, "M:X = X Monsters", legendX, legendY, color.RGBA{200, 0, 0, 255})
-	legendY += 15
-	drawText(img, "I:X = X Items", legendX, legendY, color.RGBA{0, 0, 200, 255})
-	legendY += 25
-	
-	// Room type legend
-	legendEntries := []struct {
-		name  string
-		color color.RGBA
-	}{
-		{"Town Square", colors["town_square"]},
-		{"Tavern", colors["tavern"]},
-		{"Forest Areas", colors["forest"]},
-		{"Market", colors["market"]},
-		{"Temple", colors["temple"]},
-		{"Underground", colors["dungeon"]},
-		{"Dragon Lair", colors["dragon_lair"]},
-	}
-	
-	for _, entry := range legendEntries {
-		drawRect(img, legendX, legendY-8, 15, 10, entry.color)
-		drawText(img, entry.name, legendX+20, legendY, color.RGBA{0, 0, 0, 255})
-		legendY += 18
+	square := positions["town_square"]
+	for direction, want := range map[string]string{"north": "tavern", "east": "market", "down": ""} {
+		if want == "" {
+			continue
+		}
+		if got := positions[want]; got != square.add(directionOffsets[direction]) {
+			t.Errorf("Expected %s %s of the square at %v, got %v", want, direction, square.add(directionOffsets[direction]), got)
+		}
 	}
-	
-	// Save PNG
-	file, err := os.Create("mud_map.png")
-	if err != nil {
-		t.Fatalf("Failed to create map file: %v", err)
+	if positions["armory"].z != 1 || positions["dungeon"].z != -1 || positions["ice_fortress"].z != 2 {
+		t.Error("Expected up and down exits to change level")
 	}
-	defer file.Close()
 	
-	err = png.Encode(file, img)
-	if err != nil {
-		t.Fatalf("Failed to encode PNG: %v", err)
+	// A room that can't be reached still gets a place of its own.
+	game.rooms["island"] = &Room{id: "island", name: "Island", exits: make(map[string]*Room)}
+	positions = layoutRooms(game.rooms, "town_square")
+	for id, pos := range positions {
+		if id != "island" && pos == positions["island"] {
+			t.Errorf("Island placed on top of %s", id)
+		}
 	}
-	
-	t.Logf("Map saved to mud_map.png")
-	t.Logf("Map dimensions: %dx%d pixels", imgWidth, imgHeight)
-	t.Logf("Rooms mapped: %d", len(roomPositions))
 }
 
-func drawRect(img *image.RGBA, x, y, width, height int, c color.RGBA) {
-	for dy := 0; dy < height; dy++ {
-		for dx := 0; dx < width; dx++ {
-			if x+dx < img.Bounds().Max.X && y+dy < img.Bounds().Max.Y {
-				img.Set(x+dx, y+dy, c)
-			}
-		}
+func TestMapFormats(t *testing.T) {
+	game := NewGame()
+	m := newWorldMap(game.rooms, "town_square", mapOptions{
+		monsters: true,
+		items:    true,
+		visits:   map[string]int64{"Town Square": 10, "Dark Forest": 5},
+	})
+	if len(m.levels) != 4 || m.levels[0] != 2 || m.levels[3] != -1 {
+		t.Errorf("Expected levels 2 down to -1, got %v", m.levels)
 	}
 	
-	// Draw border
-	borderColor := color.RGBA{0, 0, 0, 255}
-	for dx := 0; dx < width; dx++ {
-		if x+dx < img.Bounds().Max.X {
-			if y < img.Bounds().Max.Y {
-				img.Set(x+dx, y, borderColor)
-			}
-			if y+height-1 < img.Bounds().Max.Y {
-				img.Set(x+dx, y+height-1, borderColor)
-			}
-		}
+	var dot bytes.Buffer
+	if err := m.writeDOT(&dot); err != nil {
+		t.Fatal(err)
 	}
-	for dy := 0; dy < height; dy++ {
-		if y+dy < img.Bounds().Max.Y {
-			if x < img.Bounds().Max.X {
-				img.Set(x, y+dy, borderColor)
-			}
-			if x+width-1 < img.Bounds().Max.X {
-				img.Set(x+width-1, y+dy, borderColor)
-			}
+	for _, want := range []string{
+		`"tavern" -> "town_square" [label="south", dir=both];`,
+		`"armory" -> "tavern" [label="down", dir=both, style=dashed];`,
+		`monster: giant rat`,
+		`item: wooden mug`,
+		`Town Square\n10 visits`,
+	} {
+		if !strings.Contains(dot.String(), want) {
+			t.Errorf("Expected %q in DOT output", want)
 		}
 	}
-}
-
-func drawLine(img *image.RGBA, x1, y1, x2, y2 int, c color.RGBA) {
-	dx := abs(x2 - x1)
-	dy := abs(y2 - y1)
+	if strings.Contains(dot.String(), `"town_square" -> "tavern"`) {
+		t.Error("Expected two-way exits to be drawn once")
+	}
 	
-	var sx, sy int
-	if x1 < x2 {
-		sx = 1
-	} else {
-		sx = -1
+	var svg bytes.Buffer
+	if err := m.writeSVG(&svg); err != nil {
+		t.Fatal(err)
 	}
-	if y1 < y2 {
-		sy = 1
-	} else {
-		sy = -1
+	for _, want := range []string{"<svg", "Level 2 (above)", "Wizard&#39;s Tower", "&#9650;", "giant rat", "</svg>"} {
+		if !strings.Contains(svg.String(), want) {
+			t.Errorf("Expected %q in SVG output", want)
+		}
 	}
 	
-	err := dx - dy
-	x, y := x1, y1
-	
-	for {
-		if x >= 0 && x < img.Bounds().Max.X && y >= 0 && y < img.Bounds().Max.Y {
-			img.Set(x, y, c)
-		}
-		
-		if x == x2 && y == y2 {
-			break
-		}
-		
-		e2 := 2 * err
-		if e2 > -dy {
-			err -= dy
-			x += sx
-		}
-		if e2 < dx {
-			err += dx
-			y += sy
-		}
+	var image bytes.Buffer
+	if err := m.writePNG(&image); err != nil {
+		t.Fatal(err)
 	}
-}
-
-func abs(x int) int {
-	if x < 0 {
-		return -x
+	decoded, err := png.Decode(&image)
+	if err != nil {
+		t.Fatalf("Map is not a valid PNG: %v", err)
+	}
+	width, height := m.canvasSize()
+	if decoded.Bounds().Dx() != width || decoded.Bounds().Dy() != height {
+		t.Errorf("Expected a %dx%d image, got %v", width, height, decoded.Bounds())
 	}
-	return x
 }
 
-func drawText(img *image.RGBA, text string, x, y int, c color.RGBA) {
-	face := basicfont.Face7x13
+func TestMapCommand(t *testing.T) {
+	dir := t.TempDir()
+	heat := filepath.Join(dir, "telemetry.json")
+	os.WriteFile(heat, []byte(`{"room_visits": {"Marketplace": 3}}`), 0644)
 	
-	drawer := &font.Drawer{
-		Dst:  img,
-		Src:  &image.Uniform{c},
-		Face: face,
-		Dot:  fixed.Point26_6{fixed.Int26_6(x * 64), fixed.Int26_6(y * 64)},
+	var out, errs bytes.Buffer
+	if status := mapCommand([]string{"-heat", heat, "-o", filepath.Join(dir, "map.svg")}, &out, &errs); status != 0 {
+		t.Fatalf("map failed with status %d: %s", status, errs.String())
+	}
+	data, _ := os.ReadFile(filepath.Join(dir, "map.svg"))
+	if !strings.Contains(string(data), "3 visits") {
+		t.Error("Expected heat annotations in the SVG file")
 	}
 	
-	drawer.DrawString(text)
+	if status := mapCommand(nil, &out, &errs); status != 0 || !strings.HasPrefix(out.String(), "digraph world {") {
+		t.Errorf("Expected DOT on standard output by default, got status %d", status)
+	}
+	if status := mapCommand([]string{"-format", "gif"}, &out, &errs); status != 2 {
+		t.Errorf("Expected an unknown format to be a usage error, got %d", status)
+	}
 }
 
-func splitRoomName(name string) []string {
-	words := strings.Fields(name)
-	if len(words) <= 2 {
-		return []string{name}
-	}
-	
-	// Split long names into multiple lines
-	if len(name) > 15 {
-		mid := len(words) / 2
-		line1 := strings.Join(words[:mid], " ")
-		line2 := strings.Join(words[mid:], " ")
-		return []string{line1, line2}
+// TestGenerateMapPNG draws the built-in world to mud_map.png.
+func TestGenerateMapPNG(t *testing.T) {
+	var errs bytes.Buffer
+	if status := mapCommand([]string{"-monsters", "-items", "-o", "mud_map.png"}, &errs, &errs); status != 0 {
+		t.Fatalf("map failed with status %d: %s", status, errs.String())
 	}
-	
-	return []string{name}
-}
\ No newline at end of file
+	t.Logf("Map saved to mud_map.png")
+}
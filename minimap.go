@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	// mapRadius is how many rooms the map command shows in each
+	// direction; the minimap under look shows one.
+	mapRadius     = 3
+	minimapRadius = 1
+)
+
+const mapLegend = "@ you  P other players  ^ up  v down  # up and down  ? unexplored"
+
+// visit records that the player has been in a room, for the map.
+func (p *Player) visit(room *Room) {
+	if room == nil {
+		return
+	}
+	if p.visited == nil {
+		p.visited = make(map[string]bool)
+	}
+	p.visited[room.id] = true
+}
+
+// visitedRooms returns the ids of the rooms the player has been in, sorted.
+func (p *Player) visitedRooms() []string {
+	ids := make([]string, 0, len(p.visited))
+	for id := range p.visited {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// drawMap draws the rooms within radius steps of the player on the
+// player's level, as lines of text. Rooms the player has been in are
+// shown with what's in them; rooms next to those are shown as
+// unexplored; the rest stay hidden.
+func (g *Game) drawMap(p *Player, radius int) []string {
+	here, ok := g.layout[p.location.id]
+	if !ok {
+		return nil
+	}
+	byPos := make(map[mapPos]*Room)
+	for id, pos := range g.layout {
+		if pos.z == here.z {
+			byPos[pos] = g.rooms[id]
+		}
+	}
+	
+	known := func(room *Room) bool {
+		if room == nil {
+			return false
+		}
+		if room == p.location || p.visited[room.id] {
+			return true
+		}
+		for _, next := range room.exits {
+			if p.visited[next.id] || next == p.location {
+				return true
+			}
+		}
+		return false
+	}
+	linked := func(a, b *Room, direction string) bool {
+		return known(a) && known(b) && (a.exits[direction] == b || b.exits[reverseDirections[direction]] == a)
+	}
+	
+	var lines []string
+	for y := here.y - radius; y <= here.y+radius; y++ {
+		var rooms, links strings.Builder
+		for x := here.x - radius; x <= here.x+radius; x++ {
+			room := byPos[mapPos{x, y, here.z}]
+			if known(room) {
+				rooms.WriteString(g.mapCell(p, room))
+			} else {
+				rooms.WriteString("    ")
+			}
+			if linked(room, byPos[mapPos{x, y + 1, here.z}], "south") {
+				links.WriteString(" |  ")
+			} else {
+				links.WriteString("    ")
+			}
+			if x == here.x+radius {
+				break
+			}
+			if linked(room, byPos[mapPos{x + 1, y, here.z}], "east") {
+				rooms.WriteString("--")
+			} else {
+				rooms.WriteString("  ")
+			}
+			links.WriteString("  ")
+		}
+		lines = append(lines, strings.TrimRight(rooms.String(), " "))
+		if y < here.y+radius {
+			lines = append(lines, strings.TrimRight(links.String(), " "))
+		}
+	}
+	
+	for len(lines) > 0 && lines[0] == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	
+	// Drop the empty columns on the left.
+	indent := -1
+	for _, line := range lines {
+		if line != "" {
+			n := len(line) - len(strings.TrimLeft(line, " "))
+			if indent < 0 || n < indent {
+				indent = n
+			}
+		}
+	}
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = line[indent:]
+		}
+	}
+	return lines
+}
+
+// mapCell draws one room as four characters: brackets around who is there
+// and where it leads up or down.
+func (g *Game) mapCell(p *Player, room *Room) string {
+	if room != p.location && !p.visited[room.id] {
+		return Colorize("[? ]", ColorDim)
+	}
+	
+	who := " "
+	if room == p.location {
+		who = Colorize("@", ColorBold+ColorYellow)
+	} else {
+		for _, other := range room.players {
+			if other != p {
+				who = ColorPlayer("P")
+				break
+			}
+		}
+	}
+	
+	level := " "
+	up, down := room.exits["up"] != nil, room.exits["down"] != nil
+	switch {
+	case up && down:
+		level = ColorExit("#")
+	case up:
+		level = ColorExit("^")
+	case down:
+		level = ColorExit("v")
+	}
+	
+	if room == p.location {
+		return Colorize("[", ColorBold+ColorYellow) + who + level + Colorize("]", ColorBold+ColorYellow)
+	}
+	return "[" + who + level + "]"
+}
+
+// showMap sends the player the map around them with a heading and legend.
+func (g *Game) showMap(p *Player) {
+	lines := g.drawMap(p, mapRadius)
+	if lines == nil {
+		p.SendMessage(ColorWarning("You can't make out where you are."))
+		return
+	}
+	level := levelName(g.layout[p.location.id].z)
+	p.SendMessage(fmt.Sprintf("Map of %s around %s:", level, ColorRoomName(p.location.name)))
+	p.SendMessage(strings.Join(lines, "\n"))
+	p.SendMessage(ColorDim + mapLegend + ColorReset)
+}
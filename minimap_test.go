@@ -0,0 +1,93 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var ansiCodes = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+func plainMap(game *Game, player *Player, radius int) string {
+	return ansiCodes.ReplaceAllString(strings.Join(game.drawMap(player, radius), "\n"), "")
+}
+
+func TestDrawMapShowsExploredRooms(t *testing.T) {
+	game := NewGame()
+	player := createTestPlayer("Walker")
+	game.AddPlayer(player)
+	
+	want := strings.Join([]string{
+		"      [? ]",
+		"       |",
+		"[? ]--[@ ]--[? ]",
+		"       |",
+		"      [? ]",
+	}, "\n")
+	if got := plainMap(game, player, minimapRadius); got != want {
+		t.Errorf("Unexpected map in the town square:\n%s\nwant:\n%s", got, want)
+	}
+	
+	player.HandleCommand(game, "north")
+	player.HandleCommand(game, "south")
+	player.HandleCommand(game, "west")
+	if got := plainMap(game, player, minimapRadius); !strings.Contains(got, "[@#]--[  ]") || !strings.Contains(got, "[ ^]") {
+		t.Errorf("Expected the temple (up and down) next to the explored square, got:\n%s", got)
+	}
+	
+	// Rooms two steps from anywhere explored stay hidden.
+	if strings.Contains(plainMap(game, player, mapRadius), "Deep") {
+		t.Error("Map should not name rooms")
+	}
+	if strings.Count(plainMap(game, player, mapRadius), "[") != 5 {
+		t.Errorf("Expected 5 rooms on the map, got:\n%s", plainMap(game, player, mapRadius))
+	}
+}
+
+func TestDrawMapShowsOtherPlayers(t *testing.T) {
+	game := NewGame()
+	player := createTestPlayer("Walker")
+	friend := createTestPlayer("Friend")
+	game.AddPlayer(player)
+	game.AddPlayer(friend)
+	player.HandleCommand(game, "east")
+	player.HandleCommand(game, "west")
+	friend.HandleCommand(game, "east")
+	
+	if got := plainMap(game, player, minimapRadius); !strings.Contains(got, "[@ ]--[P ]") {
+		t.Errorf("Expected the friend in the marketplace, got:\n%s", got)
+	}
+}
+
+func TestMapCommands(t *testing.T) {
+	game := NewGame()
+	player := createMockPlayer("Walker")
+	game.AddPlayer(player)
+	
+	player.HandleCommand(game, "map")
+	output := strings.Join(getPlayerMessages(player), "\n")
+	if !strings.Contains(output, "Map of Level 0 around") || !strings.Contains(output, mapLegend) {
+		t.Errorf("Expected a map with heading and legend, got:\n%s", output)
+	}
+	
+	player.HandleCommand(game, "minimap")
+	player.HandleCommand(game, "look")
+	messages := getPlayerMessages(player)
+	if last := messages[len(messages)-1]; strings.Contains(last, "[@") {
+		t.Error("Minimap should come before the room contents")
+	}
+	found := false
+	for _, message := range messages {
+		if strings.Contains(ansiCodes.ReplaceAllString(message, ""), "[? ]--[@ ]--[? ]") {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Expected look to include the minimap, got:\n%s", strings.Join(messages, "\n"))
+	}
+	
+	snapshot := player.snapshot()
+	if !snapshot.Minimap || len(snapshot.Visited) != 1 || snapshot.Visited[0] != "town_square" {
+		t.Errorf("Expected minimap and visited rooms in the snapshot, got %+v", snapshot)
+	}
+}
@@ -1,5 +1,7 @@
 package main
 
+import "time"
+
 type Monster struct {
 	name        string
 	description string
@@ -9,6 +11,15 @@ type Monster struct {
 	location    *Room
 	aggressive  bool
 	alive       bool
+	killedAt    time.Time
+	
+	// proto is the id of the world file definition the monster was made
+	// from, if any.
+	proto string
+	
+	// respawn is how long the monster stays dead; 0 means the configured
+	// default.
+	respawn time.Duration
 }
 
 func NewMonster(name, description string, health, damage int, aggressive bool) *Monster {
@@ -28,6 +39,7 @@ func (m *Monster) TakeDamage(damage int) bool {
 	if m.health <= 0 {
 		m.health = 0
 		m.alive = false
+		m.killedAt = time.Now()
 		return true
 	}
 	return false
@@ -37,6 +49,7 @@ func (m *Monster) TakeDamage(damage int) bool {
 func (m *Monster) Respawn() {
 	m.health = m.maxHealth
 	m.alive = true
+	m.killedAt = time.Time{}
 }
 
 func (m *Monster) GetStatus() string {
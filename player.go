@@ -3,29 +3,219 @@ package main
 import (
 	"bufio"
 	"fmt"
+	"io"
+	"log"
 	"net"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// outputQueueSize is how many messages may be waiting for a client before
+	// it is considered too far behind and disconnected.
+	outputQueueSize = 256
+	
+	// writeTimeout bounds how long a single write to a client may block.
+	writeTimeout = 10 * time.Second
+	
+	// maxOutputBatch caps how much queued text is joined into one write.
+	maxOutputBatch = 16 * 1024
 )
 
 type Player struct {
-	conn      net.Conn
-	name      string
-	location  *Room
-	scanner   *bufio.Scanner
-	inventory []*Item
-	health    int
-	maxHealth int
-	damage    int
-	weapon    *Item
-	armor     *Item
+	conn       net.Conn
+	telnet     *TelnetConn
+	name       string
+	location   *Room
+	scanner    *bufio.Scanner
+	inventory  []*Item
+	health     int
+	maxHealth  int
+	damage     int
+	level      int
+	xp         int
+	gold       int
+	weapon     *Item
+	armor      *Item
+	width      int
+	target     *Monster
+	visited    map[string]bool
+	minimap    bool
+	gmcp       *gmcpSession
+	gmcpSent   map[string]string
+	output     chan outputFrame
+	writerDone chan struct{}
+	evictOnce  *sync.Once // per connection, as an old writer may still evict
 }
 
+// outputFrame is one entry in a player's outbound queue: either a line of
+// text or a telnet subnegotiation such as a GMCP message.
+type outputFrame struct {
+	text   string
+	option byte
+	data   []byte
+}
+
+// NewPlayer creates a player for a live connection, with its own writer
+// goroutine. Call stopOutput when the connection is finished.
+func NewPlayer(conn net.Conn, name string) *Player {
+	player := &Player{
+		conn:      conn,
+		name:      name,
+		inventory: make([]*Item, 0),
+		health:    30,
+		maxHealth: 30,
+		damage:    5,
+		level:     1,
+	}
+	if telnet, ok := conn.(*TelnetConn); ok {
+		player.telnet = telnet
+	}
+	player.startOutput()
+	return player
+}
+
+// SendMessage queues a line for the player, wrapped to the player's line
+// width. Players without an output queue (as in tests) are written to
+// directly.
 func (p *Player) SendMessage(message string) {
+	message = strings.Join(WrapText(message, p.lineWidth()), "\r\n")
+	if p.output != nil {
+		p.queue(outputFrame{text: message + "\r\n"})
+		return
+	}
 	if p.conn != nil {
 		fmt.Fprintf(p.conn, "%s\r\n", message)
 	}
 }
 
+// queue adds a frame to the outbound queue, disconnecting the client if the
+// queue is full.
+func (p *Player) queue(frame outputFrame) {
+	select {
+	case p.output <- frame:
+	default:
+		p.evict(p.conn, p.evictOnce, "output queue full")
+	}
+}
+
+// lineWidth is the width output is wrapped to: the player's own setting, or
+// else the window size their telnet client reported. Zero means no wrapping.
+func (p *Player) lineWidth() int {
+	if p.width > 0 {
+		return p.width
+	}
+	if p.telnet != nil {
+		width, _ := p.telnet.WindowSize()
+		if width >= minLineWidth {
+			return min(width, maxLineWidth)
+		}
+	}
+	return 0
+}
+
+// startOutput gives the player a bounded outbound queue drained by its own
+// writer goroutine, so a stalled client never blocks the game loop.
+func (p *Player) startOutput() {
+	p.output = make(chan outputFrame, outputQueueSize)
+	p.writerDone = make(chan struct{})
+	p.evictOnce = new(sync.Once)
+	go p.writeLoop(p.conn, p.output, p.writerDone, p.evictOnce)
+}
+
+// stopOutput closes the outbound queue and waits for the writer to flush it.
+// Nothing may send to the player afterwards.
+func (p *Player) stopOutput() {
+	close(p.output)
+	<-p.writerDone
+}
+
+func (p *Player) writeLoop(conn net.Conn, output <-chan outputFrame, done chan<- struct{}, evictOnce *sync.Once) {
+	defer close(done)
+	
+	telnet, _ := conn.(*TelnetConn)
+	var text strings.Builder
+	for frame := range output {
+		if frame.option == 0 {
+			// Text that is already waiting goes out in one write, which
+			// compresses far better than many small ones.
+			text.WriteString(frame.text)
+			if len(output) > 0 && text.Len() < maxOutputBatch {
+				continue
+			}
+		}
+		
+		conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+		var err error
+		if text.Len() > 0 {
+			_, err = io.WriteString(conn, text.String())
+			text.Reset()
+		}
+		if err == nil && frame.option != 0 && telnet != nil {
+			err = telnet.Subnegotiate(frame.option, frame.data)
+		}
+		if err != nil {
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				p.evict(conn, evictOnce, "write timed out")
+			} else {
+				conn.Close()
+			}
+			for range output {
+			}
+			return
+		}
+	}
+}
+
+// disconnect ends the player's session. Queued output is still delivered: the
+// reader is woken up so the connection handler can flush and close.
+func (p *Player) disconnect() {
+	if p.conn == nil {
+		return
+	}
+	if p.output != nil {
+		p.conn.SetReadDeadline(time.Now())
+		return
+	}
+	p.conn.Close()
+}
+
+// takeOver moves the player onto a new connection after a duplicate login,
+// closing the old one once its pending output is written. It runs on the
+// game loop, so it doesn't wait for the old writer: a stalled old client
+// would hold up the game for up to writeTimeout.
+func (p *Player) takeOver(conn net.Conn, gmcp *gmcpSession) {
+	old, oldDone := p.conn, p.writerDone
+	p.SendMessage(ColorWarning("Your character has been taken over by another connection."))
+	if p.output != nil {
+		close(p.output)
+		go func() {
+			<-oldDone
+			old.Close()
+		}()
+	} else {
+		old.Close()
+	}
+	
+	p.conn = conn
+	p.telnet, _ = conn.(*TelnetConn)
+	p.gmcp = gmcp
+	p.gmcpSent = nil
+	p.startOutput()
+}
+
+// evict disconnects a client that has fallen too far behind on its output.
+// once belongs to the connection, so it is only counted once.
+func (p *Player) evict(conn net.Conn, once *sync.Once, reason string) {
+	once.Do(func() {
+		GlobalTelemetry.IncrementSlowClientEvictions()
+		log.Printf("Disconnecting slow client %s: %s", p.name, reason)
+		conn.Close()
+	})
+}
+
 func (p *Player) TakeDamage(damage int) bool {
 	p.health -= damage
 	if p.health <= 0 {
@@ -52,7 +242,7 @@ func (p *Player) GetHealthStatus() string {
 }
 
 func (p *Player) HandleCommand(game *Game, command string) {
-	parts := strings.Fields(strings.TrimSpace(command))
+	parts := strings.Fields(stripControls(command))
 	if len(parts) == 0 {
 		return
 	}
@@ -65,6 +255,12 @@ func (p *Player) HandleCommand(game *Game, command string) {
 		p.SendMessage(fmt.Sprintf("=== %s ===", ColorRoomName(p.location.name)))
 		p.SendMessage(ColorDescription(p.location.description))
 		
+		if p.minimap {
+			if lines := game.drawMap(p, minimapRadius); lines != nil {
+				p.SendMessage(strings.Join(lines, "\n"))
+			}
+		}
+		
 		if len(p.location.items) > 0 {
 			p.SendMessage(fmt.Sprintf("\n%sItems here:%s", ColorBold, ColorReset))
 			for _, item := range p.location.items {
@@ -72,10 +268,14 @@ func (p *Player) HandleCommand(game *Game, command string) {
 			}
 		}
 		
+		if shop := p.location.shop; shop != nil {
+			p.SendMessage(fmt.Sprintf("\n%s is here, ready to trade (list, buy, sell, value).", ColorName(shop.def.keeper)))
+		}
+		
 		if len(p.location.exits) > 0 {
 			p.SendMessage(fmt.Sprintf("\n%sExits:%s", ColorBold, ColorReset))
 			for direction := range p.location.exits {
-				p.SendMessage(fmt.Sprintf("  %s", ColorExit(direction)))
+				p.SendMessage(fmt.Sprintf("  %s", p.location.describeExit(direction)))
 			}
 		}
 		
@@ -107,25 +307,17 @@ func (p *Player) HandleCommand(game *Game, command string) {
 			direction = strings.ToLower(parts[1])
 		}
 		
-		if direction == "n" {
-			direction = "north"
-		} else if direction == "s" {
-			direction = "south"
-		} else if direction == "e" {
-			direction = "east"
-		} else if direction == "w" {
-			direction = "west"
-		} else if direction == "u" {
-			direction = "up"
-		} else if direction == "d" {
-			direction = "down"
-		}
+		direction = expandDirection(direction)
 		
 		nextRoom, exists := p.location.exits[direction]
 		if !exists {
 			p.SendMessage(ColorError("You can't go that way."))
 			return
 		}
+		if door := p.location.doors[direction]; door != nil && door.closed {
+			p.SendMessage(ColorWarning(fmt.Sprintf("The door %s is closed.", direction)))
+			return
+		}
 		
 		p.location.Broadcast(fmt.Sprintf("%s leaves %s.", ColorName(p.name), ColorExit(direction)), p)
 		
@@ -138,6 +330,7 @@ func (p *Player) HandleCommand(game *Game, command string) {
 		
 		p.location = nextRoom
 		nextRoom.players = append(nextRoom.players, p)
+		p.visit(nextRoom)
 		
 		GlobalTelemetry.RecordRoomVisit(nextRoom.name)
 		
@@ -150,9 +343,17 @@ func (p *Player) HandleCommand(game *Game, command string) {
 			return
 		}
 		itemName := strings.ToLower(strings.Join(parts[1:], " "))
+		if what, from, ok := strings.Cut(itemName, " from "); ok {
+			game.lootCorpse(p, what, from)
+			return
+		}
 		
 		for i, item := range p.location.items {
 			if strings.ToLower(item.name) == itemName {
+				if item.itemType == "corpse" {
+					p.SendMessage(ColorWarning("You can't carry that. Try 'get all from corpse'."))
+					return
+				}
 				p.location.items = append(p.location.items[:i], p.location.items[i+1:]...)
 				p.inventory = append(p.inventory, item)
 				p.SendMessage(fmt.Sprintf("You take the %s.", ColorItem(item.name)))
@@ -189,6 +390,7 @@ func (p *Player) HandleCommand(game *Game, command string) {
 				p.SendMessage(fmt.Sprintf("  %s", ColorItem(item.name)))
 			}
 		}
+		p.SendMessage(fmt.Sprintf("You have %s.", goldCoins(p.gold)))
 		
 	case "examine", "ex":
 		if len(parts) < 2 {
@@ -196,6 +398,10 @@ func (p *Player) HandleCommand(game *Game, command string) {
 			return
 		}
 		itemName := strings.ToLower(strings.Join(parts[1:], " "))
+		if corpse := p.location.findCorpse(itemName); corpse != nil {
+			describeCorpse(p, corpse)
+			return
+		}
 		
 		for _, item := range p.location.items {
 			if strings.ToLower(item.name) == itemName {
@@ -205,6 +411,9 @@ func (p *Player) HandleCommand(game *Game, command string) {
 				} else if item.itemType == "armor" && item.defense > 0 {
 					description += fmt.Sprintf(" %s(Defense: +%d)%s", ColorEquipment(""), item.defense, ColorReset)
 				}
+				if game.isBuilder(p) {
+					description += Colorize(" ["+item.tag()+"]", ColorDim)
+				}
 				p.SendMessage(description)
 				return
 			}
@@ -212,7 +421,11 @@ func (p *Player) HandleCommand(game *Game, command string) {
 		
 		for _, item := range p.inventory {
 			if strings.ToLower(item.name) == itemName {
-				p.SendMessage(fmt.Sprintf("%s: %s", ColorItem(item.name), item.description))
+				description := fmt.Sprintf("%s: %s", ColorItem(item.name), item.description)
+				if game.isBuilder(p) {
+					description += Colorize(" ["+item.tag()+"]", ColorDim)
+				}
+				p.SendMessage(description)
 				return
 			}
 		}
@@ -221,7 +434,7 @@ func (p *Player) HandleCommand(game *Game, command string) {
 	case "who":
 		p.SendMessage(fmt.Sprintf("%sPlayers online:%s", ColorBold, ColorReset))
 		for _, player := range game.players {
-			p.SendMessage(fmt.Sprintf("  %s (%s)", ColorPlayer(player.name), ColorRoomName(player.location.name)))
+			p.SendMessage(fmt.Sprintf("  %s, level %d (%s)", ColorPlayer(player.name), max(player.level, 1), ColorRoomName(player.location.name)))
 		}
 		
 	case "attack", "kill", "fight":
@@ -233,6 +446,9 @@ func (p *Player) HandleCommand(game *Game, command string) {
 		GlobalTelemetry.IncrementCombatActions()
 		game.PlayerAttackMonster(p, targetName)
 		
+	case "score", "sc":
+		game.showScore(p)
+		
 	case "health", "hp":
 		healthColor := ColorHealing("")
 		if p.health < p.maxHealth/2 {
@@ -327,6 +543,9 @@ func (p *Player) HandleCommand(game *Game, command string) {
 		
 		for i, item := range p.inventory {
 			if strings.ToLower(item.name) == itemName {
+				if game.useKey(p, item) {
+					return
+				}
 				switch item.name {
 				case "tome of knowledge":
 					p.inventory = append(p.inventory[:i], p.inventory[i+1:]...)
@@ -394,14 +613,81 @@ func (p *Player) HandleCommand(game *Game, command string) {
 	case "status":
 		p.SendMessage(fmt.Sprintf("%sServer Status:%s", ColorBold+ColorBrightGreen, ColorReset))
 		p.SendMessage(GlobalTelemetry.GetSummary())
+		if p.telnet != nil {
+			options := p.telnet.Options()
+			if len(options) == 0 {
+				options = []string{"none"}
+			}
+			p.SendMessage(fmt.Sprintf("Telnet options: %s", strings.Join(options, ", ")))
+		}
+		if p.gmcpEnabled() {
+			if client := p.gmcp.clientName(); client != "" {
+				p.SendMessage(fmt.Sprintf("GMCP client: %s", client))
+			}
+		}
+		
+	case "width":
+		if len(parts) < 2 {
+			if width := p.lineWidth(); width > 0 {
+				p.SendMessage(fmt.Sprintf("Your line width is %d.", width))
+			} else {
+				p.SendMessage("Your output is not wrapped.")
+			}
+			return
+		}
+		if strings.ToLower(parts[1]) == "auto" {
+			p.width = 0
+			p.SendMessage(ColorSuccess("Line width will follow your client's window size."))
+			return
+		}
+		width, err := strconv.Atoi(parts[1])
+		if err != nil || width < minLineWidth || width > maxLineWidth {
+			p.SendMessage(ColorError(fmt.Sprintf("Width must be a number from %d to %d, or 'auto'.", minLineWidth, maxLineWidth)))
+			return
+		}
+		p.width = width
+		p.SendMessage(ColorSuccess(fmt.Sprintf("Line width set to %d.", width)))
+		
+	case "list", "buy", "sell", "value":
+		game.handleShop(p, cmd, parts[1:])
+		
+	case "open", "close", "lock", "unlock":
+		game.handleDoor(p, cmd, parts[1:])
+		
+	case "map":
+		game.showMap(p)
+		
+	case "minimap":
+		p.minimap = !p.minimap
+		if p.minimap {
+			p.SendMessage(ColorSuccess("Look will show a map of the rooms around you."))
+		} else {
+			p.SendMessage(ColorSuccess("Look will no longer show a map."))
+		}
+		
+	case "build":
+		game.handleBuild(p, parts[1:])
+		
+	case "copyover":
+		if !game.isAdmin(p) {
+			p.SendMessage(ColorError("Only admins can do that."))
+			return
+		}
+		if game.copyover == nil {
+			p.SendMessage(ColorError("Copyover is not available."))
+			return
+		}
+		if err := game.copyover(); err != nil {
+			log.Printf("Copyover by %s failed: %v", p.name, err)
+			p.SendMessage(ColorError(fmt.Sprintf("Copyover failed: %v", err)))
+			game.broadcastAll(ColorWarning("The restart was cancelled. Carry on!"), p)
+		}
 		
 	case "quit", "q":
 		p.SendMessage(ColorInfo("Goodbye!"))
-		if p.conn != nil {
-			p.conn.Close()
-		}
+		p.disconnect()
 		
 	default:
-		p.SendMessage(ColorError("Unknown command. Try: look, go <direction>, get <item>, drop <item>, inventory, examine <item>, equip <item>, equipment, attack <monster>, health, who, use <item>, rest, say, stats, status, quit"))
+		p.SendMessage(ColorError("Unknown command. Try: look, go <direction>, get <item>, get all from corpse, drop <item>, inventory, examine <item>, equip <item>, equipment, attack <monster>, list, buy/sell/value <item>, health, score, who, use <item>, open/close/lock/unlock <direction>, rest, say, stats, status, map, minimap, width, build, quit"))
 	}
 }
\ No newline at end of file
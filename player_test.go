@@ -1,6 +1,8 @@
 package main
 
 import (
+	"bufio"
+	"net"
 	"strings"
 	"testing"
 )
@@ -255,6 +257,24 @@ func TestSayCommand(t *testing.T) {
 	player1.HandleCommand(game, "say")
 }
 
+func TestSayStripsControls(t *testing.T) {
+	game := NewGame()
+	speaker := createMockPlayer("Speaker")
+	listener := createMockPlayer("Listener")
+	game.AddPlayer(speaker)
+	game.AddPlayer(listener)
+	
+	speaker.HandleCommand(game, "say \x1b]0;owned\x07hi\x1b[2J\tthere\r")
+	heard := lastMessage(listener)
+	if strings.Contains(heard, "\x1b]") || strings.Contains(heard, "\x1b[2J") || strings.ContainsAny(heard, "\x07\t\r") {
+		t.Errorf("Expected control characters to be stripped, got %q", heard)
+	}
+	heard = stripColors(heard)
+	if !strings.HasSuffix(heard, "says: ]0;ownedhi[2J there") {
+		t.Errorf("Expected the printable text to remain, got %q", heard)
+	}
+}
+
 func TestCaseInsensitiveCommands(t *testing.T) {
 	game := NewGame()
 	player := createTestPlayer("TestPlayer")
@@ -273,4 +293,55 @@ func TestCaseInsensitiveCommands(t *testing.T) {
 			player.HandleCommand(game, "south")
 		}
 	}
-}
\ No newline at end of file
+}
+
+func TestSlowClientEviction(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+	
+	before := GlobalTelemetry.GetSnapshot().SlowClientEvictions
+	
+	// Nobody reads from the client side, so the writer stalls on the first
+	// message and the queue fills up behind it.
+	player := NewPlayer(server, "Slowpoke")
+	for i := 0; i < outputQueueSize+10; i++ {
+		player.SendMessage("You hear a distant rumble.")
+	}
+	player.stopOutput()
+	
+	if _, err := server.Write([]byte("x")); err == nil {
+		t.Error("Expected slow client connection to be closed")
+	}
+	
+	after := GlobalTelemetry.GetSnapshot().SlowClientEvictions
+	if after != before+1 {
+		t.Errorf("Expected 1 slow client eviction, got %d", after-before)
+	}
+}
+
+func TestQueuedOutputDelivered(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+	
+	player := NewPlayer(server, "Reader")
+	player.SendMessage("first")
+	player.SendMessage("second")
+	
+	done := make(chan struct{})
+	go func() {
+		player.stopOutput()
+		close(done)
+	}()
+	
+	reader := bufio.NewReader(client)
+	for _, expected := range []string{"first", "second"} {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Failed to read message: %v", err)
+		}
+		if strings.TrimSpace(line) != expected {
+			t.Errorf("Expected %q, got %q", expected, strings.TrimSpace(line))
+		}
+	}
+	<-done
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// playerSaveVersion is the current save file format. When playerSnapshot
+// changes in a way old files cannot be read as, bump it and add a
+// migration from the previous version.
+const playerSaveVersion = 2
+
+// playerMigrations upgrade a decoded save file one version at a time: the
+// function at key n turns a version n document into version n+1.
+var playerMigrations = map[int]func(doc map[string]any) error{
+	1: addKeyProtos,
+}
+
+// version1Keys maps the names of the keys in the world when doors started
+// matching keys by prototype to those prototypes.
+var version1Keys = map[string]string{
+	"rusty key": "rusty_key",
+}
+
+// addKeyProtos fills in the prototype of keys saved without one, which no
+// door would open for otherwise.
+func addKeyProtos(doc map[string]any) error {
+	var fill func(v any)
+	fill = func(v any) {
+		item, ok := v.(map[string]any)
+		if !ok {
+			return
+		}
+		name, _ := item["name"].(string)
+		if proto, _ := item["proto"].(string); proto == "" && version1Keys[name] != "" {
+			item["proto"] = version1Keys[name]
+		}
+		contents, _ := item["contents"].([]any)
+		for _, content := range contents {
+			fill(content)
+		}
+	}
+	
+	player, _ := doc["player"].(map[string]any)
+	inventory, _ := player["inventory"].([]any)
+	for _, item := range inventory {
+		fill(item)
+	}
+	fill(player["weapon"])
+	fill(player["armor"])
+	return nil
+}
+
+var errNoSave = errors.New("no saved player")
+
+// playerSave is the on-disk format of a saved character.
+type playerSave struct {
+	Version int            `json:"version"`
+	Saved   time.Time      `json:"saved"`
+	Player  playerSnapshot `json:"player"`
+}
+
+// PlayerStore keeps one save file per character.
+type PlayerStore struct {
+	dir    string
+	writer *fileWriter
+}
+
+func NewPlayerStore(dir string) *PlayerStore {
+	return &PlayerStore{dir: dir, writer: newFileWriter()}
+}
+
+func (s *PlayerStore) path(name string) string {
+	return filepath.Join(s.dir, strings.ToLower(name)+".json")
+}
+
+// Save writes a snapshot, replacing the previous save only once the new one
+// is safely on disk.
+func (s *PlayerStore) Save(snapshot playerSnapshot) error {
+	return s.writer.write(s.path(snapshot.Name), encodePlayerSave(snapshot, time.Now()))
+}
+
+// SaveLater is Save in the background, for callers on the game loop.
+func (s *PlayerStore) SaveLater(snapshot playerSnapshot) {
+	s.writer.queue(s.path(snapshot.Name), encodePlayerSave(snapshot, time.Now()))
+}
+
+// Flush waits for the saves SaveLater has queued to be written.
+func (s *PlayerStore) Flush() {
+	s.writer.flush()
+}
+
+func encodePlayerSave(snapshot playerSnapshot, saved time.Time) func() ([]byte, error) {
+	return func() ([]byte, error) {
+		return json.MarshalIndent(playerSave{
+			Version: playerSaveVersion,
+			Saved:   saved,
+			Player:  snapshot,
+		}, "", "  ")
+	}
+}
+
+// Load reads a character's save, migrating it from older versions.
+func (s *PlayerStore) Load(name string) (playerSnapshot, error) {
+	s.writer.wait(s.path(name))
+	data, err := os.ReadFile(s.path(name))
+	if errors.Is(err, os.ErrNotExist) {
+		return playerSnapshot{}, errNoSave
+	}
+	if err != nil {
+		return playerSnapshot{}, err
+	}
+	save, err := decodePlayerSave(data)
+	if err != nil {
+		return playerSnapshot{}, fmt.Errorf("%s: %w", s.path(name), err)
+	}
+	return save.Player, nil
+}
+
+func decodePlayerSave(data []byte) (playerSave, error) {
+	var doc map[string]any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return playerSave{}, err
+	}
+	version, ok := doc["version"].(float64)
+	if !ok {
+		return playerSave{}, errors.New("missing version")
+	}
+	if int(version) > playerSaveVersion {
+		return playerSave{}, fmt.Errorf("version %d is newer than this server supports (%d)", int(version), playerSaveVersion)
+	}
+	
+	for v := int(version); v < playerSaveVersion; v++ {
+		migrate, ok := playerMigrations[v]
+		if !ok {
+			return playerSave{}, fmt.Errorf("no migration from version %d", v)
+		}
+		if err := migrate(doc); err != nil {
+			return playerSave{}, fmt.Errorf("migrating from version %d: %w", v, err)
+		}
+		doc["version"] = v + 1
+	}
+	
+	migrated, err := json.Marshal(doc)
+	if err != nil {
+		return playerSave{}, err
+	}
+	var save playerSave
+	if err := json.Unmarshal(migrated, &save); err != nil {
+		return playerSave{}, err
+	}
+	return save, nil
+}
+
+// writeFileAtomic writes data to a temporary file and renames it over path,
+// so a crash mid-write never leaves a truncated file.
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// fileWriter writes files on a goroutine of its own, so the game loop only
+// has to take the snapshot. Each path keeps just its latest contents: a
+// save queued while an older one waits replaces it.
+type fileWriter struct {
+	mu      sync.Mutex
+	done    *sync.Cond // signalled when a write finishes
+	pending map[string]func() ([]byte, error)
+	writing string
+	running bool
+}
+
+func newFileWriter() *fileWriter {
+	w := &fileWriter{pending: make(map[string]func() ([]byte, error))}
+	w.done = sync.NewCond(&w.mu)
+	return w
+}
+
+// queue has the data encode returns written to path in the background.
+func (w *fileWriter) queue(path string, encode func() ([]byte, error)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	
+	w.pending[path] = encode
+	if !w.running {
+		w.running = true
+		go w.run()
+	}
+}
+
+// run writes queued files until there are none left.
+func (w *fileWriter) run() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	
+	for len(w.pending) > 0 {
+		var path string
+		for path = range w.pending {
+			break
+		}
+		encode := w.pending[path]
+		delete(w.pending, path)
+		w.writing = path
+		w.mu.Unlock()
+		
+		if err := writeEncoded(path, encode); err != nil {
+			log.Printf("Failed to save %s: %v", path, err)
+		}
+		
+		w.mu.Lock()
+		w.writing = ""
+		w.done.Broadcast()
+	}
+	w.running = false
+	w.done.Broadcast()
+}
+
+// write writes path now, replacing any queued contents. It returns once
+// the file is on disk.
+func (w *fileWriter) write(path string, encode func() ([]byte, error)) error {
+	w.mu.Lock()
+	delete(w.pending, path)
+	for w.writing == path {
+		w.done.Wait()
+	}
+	w.mu.Unlock()
+	return writeEncoded(path, encode)
+}
+
+// wait returns once nothing is queued or being written for path, so that
+// reading it gives the latest save.
+func (w *fileWriter) wait(path string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for w.pending[path] != nil || w.writing == path {
+		w.done.Wait()
+	}
+}
+
+// flush waits for everything queued to be written.
+func (w *fileWriter) flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for w.running {
+		w.done.Wait()
+	}
+}
+
+func writeEncoded(path string, encode func() ([]byte, error)) error {
+	data, err := encode()
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data)
+}
+
+// savePlayer saves one player. It runs on the game loop, which only takes
+// the snapshot; the file is written in the background.
+func (g *Game) savePlayer(player *Player) {
+	g.saves.SaveLater(player.snapshot())
+}
+
+// saveAllPlayers saves every connected player in the background. It runs
+// on the game loop.
+func (g *Game) saveAllPlayers() {
+	for _, player := range g.players {
+		g.savePlayer(player)
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPlayerStoreRoundTrip(t *testing.T) {
+	store := NewPlayerStore(t.TempDir())
+	if _, err := store.Load("Nobody"); err != errNoSave {
+		t.Errorf("Expected errNoSave, got %v", err)
+	}
+	
+	saved := playerSnapshot{
+		Name:      "Frodo",
+		Room:      "tavern",
+		Health:    25,
+		MaxHealth: 40,
+		Damage:    7,
+		Inventory: []itemSnapshot{{Name: "wooden mug", Type: "misc"}},
+		Armor:     &itemSnapshot{Name: "mithril shirt", Type: "armor", Defense: 5},
+	}
+	if err := store.Save(saved); err != nil {
+		t.Fatalf("Failed to save: %v", err)
+	}
+	loaded, err := store.Load("frodo")
+	if err != nil {
+		t.Fatalf("Failed to load: %v", err)
+	}
+	if loaded.Name != "Frodo" || loaded.Room != "tavern" || loaded.MaxHealth != 40 || loaded.Damage != 7 {
+		t.Errorf("Unexpected save contents: %+v", loaded)
+	}
+	if len(loaded.Inventory) != 1 || loaded.Armor == nil || loaded.Armor.Defense != 5 {
+		t.Errorf("Expected inventory and armor to be saved: %+v", loaded)
+	}
+}
+
+func TestPlayerStoreSaveLater(t *testing.T) {
+	store := NewPlayerStore(t.TempDir())
+	store.SaveLater(playerSnapshot{Name: "Sam", Health: 10})
+	store.SaveLater(playerSnapshot{Name: "Sam", Health: 20})
+	
+	// Load waits for the queued saves, and only the latest counts.
+	loaded, err := store.Load("Sam")
+	if err != nil {
+		t.Fatalf("Failed to load: %v", err)
+	}
+	if loaded.Health != 20 {
+		t.Errorf("Expected the latest save with health 20, got %d", loaded.Health)
+	}
+	
+	// A save written now replaces one still waiting in the queue.
+	store.SaveLater(playerSnapshot{Name: "Sam", Health: 30})
+	if err := store.Save(playerSnapshot{Name: "Sam", Health: 40}); err != nil {
+		t.Fatalf("Failed to save: %v", err)
+	}
+	store.Flush()
+	if loaded, _ := store.Load("Sam"); loaded.Health != 40 {
+		t.Errorf("Expected health 40 from the direct save, got %d", loaded.Health)
+	}
+}
+
+func TestPlayerSaveMigration(t *testing.T) {
+	// Stand in for a future format change: version 0 files kept health
+	// under "hp".
+	playerMigrations[0] = func(doc map[string]any) error {
+		player := doc["player"].(map[string]any)
+		player["health"] = player["hp"]
+		delete(player, "hp")
+		return nil
+	}
+	defer delete(playerMigrations, 0)
+	
+	save, err := decodePlayerSave([]byte(`{"version": 0, "player": {"name": "Bilbo", "hp": 11}}`))
+	if err != nil {
+		t.Fatalf("Failed to migrate: %v", err)
+	}
+	if save.Version != playerSaveVersion || save.Player.Health != 11 {
+		t.Errorf("Expected migrated health 11 at version %d, got %+v", playerSaveVersion, save)
+	}
+	
+	if _, err := decodePlayerSave([]byte(`{"version": -1, "player": {}}`)); err == nil {
+		t.Error("Expected an error when no migration exists")
+	}
+	if _, err := decodePlayerSave([]byte(`{"version": 99, "player": {}}`)); err == nil {
+		t.Error("Expected an error for a save from a newer server")
+	}
+	if _, err := decodePlayerSave([]byte(`{"player": {}}`)); err == nil {
+		t.Error("Expected an error for a save without a version")
+	}
+}
+
+func TestKeyProtoMigration(t *testing.T) {
+	// A version 1 save whose key was picked up before items recorded their
+	// prototype.
+	save, err := decodePlayerSave([]byte(`{
+		"version": 1,
+		"player": {
+			"name": "Keyholder",
+			"room": "forest",
+			"inventory": [
+				{"id": 4, "name": "rusty key", "description": "An old iron key, corroded with age", "type": "misc"},
+				{"id": 5, "name": "leather pouch", "type": "container",
+					"contents": [{"id": 6, "name": "rusty key", "type": "misc"}]},
+				{"id": 7, "proto": "wooden_mug", "name": "wooden mug", "type": "misc"}
+			]
+		}
+	}`))
+	if err != nil {
+		t.Fatalf("Failed to migrate: %v", err)
+	}
+	
+	player := createTestPlayer("")
+	save.Player.restore(player, nil)
+	if !player.carriesProto("rusty_key") {
+		t.Errorf("Expected the key to be a rusty_key, got %q", player.inventory[0].proto)
+	}
+	if proto := player.inventory[1].contents[0].proto; proto != "rusty_key" {
+		t.Errorf("Expected the key in the pouch to be a rusty_key, got %q", proto)
+	}
+	if proto := player.inventory[1].proto; proto != "" {
+		t.Errorf("Expected the pouch to be left alone, got %q", proto)
+	}
+	if proto := player.inventory[2].proto; proto != "wooden_mug" {
+		t.Errorf("Expected the mug to keep its prototype, got %q", proto)
+	}
+}
+
+func TestPlayerRestoredOnLogin(t *testing.T) {
+	game := newTestGame(t, testConfig(t))
+	game.Start()
+	defer game.Stop()
+	
+	first := dialSession(t, game)
+	first.register("Rosie", "greendragon")
+	first.send("go north")
+	first.expect("Prancing Pony")
+	first.send("get wooden mug")
+	first.expect("You take the")
+	first.send("quit")
+	first.expectClosed()
+	
+	second := dialSession(t, game)
+	second.expect("What is your name?")
+	second.send("Rosie")
+	second.expect("Password:")
+	second.send("greendragon")
+	second.expect("Welcome back")
+	second.expect("Prancing Pony")
+	second.send("inventory")
+	second.expect("wooden mug")
+}
+
+func TestAutosave(t *testing.T) {
+	config := testConfig(t)
+	config.Saves.Autosave = Duration(10 * time.Millisecond)
+	game := newTestGame(t, config)
+	game.Start()
+	defer game.Stop()
+	
+	client := dialSession(t, game)
+	client.register("Hamfast", "gaffer")
+	
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		data, err := os.ReadFile(game.saves.path("Hamfast"))
+		if err == nil && strings.Contains(string(data), fmt.Sprintf(`"version": %d`, playerSaveVersion)) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected an autosave while the player is connected")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
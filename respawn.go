@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// respawnDelay is how long a monster stays dead.
+func (g *Game) respawnDelay(m *Monster) time.Duration {
+	if m.respawn > 0 {
+		return m.respawn
+	}
+	return time.Duration(g.config.World.Respawn)
+}
+
+// resetInterval is how often an area resets.
+func (g *Game) resetInterval(area *areaFile) time.Duration {
+	if area.reset > 0 {
+		return area.reset
+	}
+	return time.Duration(g.config.World.Reset)
+}
+
+// respawnMonsters brings back every monster that has been dead for its
+// respawn delay. Each spawn keeps its own timer, from the moment it was
+// killed, so the timers carry on across restarts with the world state.
+func (g *Game) respawnMonsters(now time.Time) {
+	for _, room := range g.rooms {
+		for _, monster := range room.monsters {
+			if monster.alive || now.Sub(monster.killedAt) < g.respawnDelay(monster) {
+				continue
+			}
+			monster.Respawn()
+			room.Broadcast(ColorWarning(fmt.Sprintf("The %s appears.", ColorMonster(monster.name))), nil)
+		}
+	}
+}
+
+// resetAreas resets the areas that are due. An area's first reset is one
+// interval after the game first looks at it.
+func (g *Game) resetAreas(now time.Time) {
+	for _, area := range g.world.areas {
+		next, scheduled := g.nextReset[area]
+		if scheduled && now.Before(next) {
+			continue
+		}
+		if scheduled {
+			g.resetArea(area)
+		}
+		g.nextReset[area] = now.Add(g.resetInterval(area))
+	}
+}
+
+// resetArea puts back the items an area's rooms start with that are no
+// longer there, and returns its doors to how they start. Monsters come back
+// on their own timers.
+func (g *Game) resetArea(area *areaFile) {
+	for _, def := range area.rooms {
+		if room := g.rooms[def.id]; room != nil && g.world.rooms[def.id] == def {
+			g.restockRoom(room, def)
+			resetDoors(room, def)
+		}
+	}
+}
+
+// restockRoom adds items until the room has as many of each as its
+// definition places. Items players have dropped there count too.
+func (g *Game) restockRoom(room *Room, def *roomDef) {
+	wanted := make(map[string]int)
+	var ids []string
+	for _, item := range def.items {
+		if wanted[item.id] == 0 {
+			ids = append(ids, item.id)
+		}
+		wanted[item.id]++
+	}
+	for _, id := range ids {
+		proto := g.world.items[id]
+		if proto == nil {
+			continue
+		}
+		have := 0
+		for _, item := range room.items {
+			if item.proto == id {
+				have++
+			}
+		}
+		for ; have < wanted[id]; have++ {
+			room.items = append(room.items, proto.newItem())
+		}
+	}
+}
+
+// resetDoors returns the doors a room defines to the state they start in,
+// telling both sides if one swings open or shut.
+func resetDoors(room *Room, def *roomDef) {
+	for _, doorDef := range def.doors {
+		door := room.doors[doorDef.direction]
+		if door == nil {
+			continue
+		}
+		closed := doorDef.state != "open"
+		door.locked = doorDef.state == "locked" && door.key != ""
+		if door.closed == closed {
+			continue
+		}
+		door.closed = closed
+		message := "The door %s swings open."
+		if closed {
+			message = "The door %s swings shut."
+		}
+		room.Broadcast(fmt.Sprintf(message, ColorExit(doorDef.direction)), nil)
+		back := reverseDirections[doorDef.direction]
+		if other := room.exits[doorDef.direction]; other != nil && other.doors[back] == door {
+			other.Broadcast(fmt.Sprintf(message, ColorExit(back)), nil)
+		}
+	}
+}
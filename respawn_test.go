@@ -0,0 +1,121 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestRespawnMonsters(t *testing.T) {
+	game := NewGame()
+	player := createMockPlayer("Hunter")
+	game.AddPlayer(player)
+	player.HandleCommand(game, "south")
+	
+	forest := game.rooms["forest"]
+	rat := forest.monsters[0]
+	rat.TakeDamage(rat.health)
+	killed := rat.killedAt
+	
+	game.respawnMonsters(killed.Add(4 * time.Minute))
+	if rat.alive {
+		t.Fatal("The rat should stay dead for the default five minutes")
+	}
+	game.respawnMonsters(killed.Add(5 * time.Minute))
+	if !rat.alive || rat.health != rat.maxHealth {
+		t.Fatal("Expected the rat to respawn at full health")
+	}
+	if !strings.Contains(lastMessage(player), "appears") {
+		t.Errorf("Expected the room to see the rat appear, got %q", lastMessage(player))
+	}
+	
+	// The dragon's area file gives it a longer respawn.
+	dragon := game.rooms["dragon_lair"].monsters[0]
+	dragon.TakeDamage(dragon.health)
+	game.respawnMonsters(dragon.killedAt.Add(10 * time.Minute))
+	if dragon.alive {
+		t.Error("The dragon should stay dead for 30 minutes")
+	}
+	game.respawnMonsters(dragon.killedAt.Add(30 * time.Minute))
+	if !dragon.alive {
+		t.Error("Expected the dragon to respawn after 30 minutes")
+	}
+}
+
+func TestAreaReset(t *testing.T) {
+	game := NewGame()
+	player := createMockPlayer("Looter")
+	game.AddPlayer(player)
+	for _, command := range []string{"south", "south", "get iron sword", "north", "down", "get rusty key", "unlock north", "open north"} {
+		player.HandleCommand(game, command)
+	}
+	deep, dungeon := game.rooms["deep_forest"], game.rooms["dungeon"]
+	if len(deep.items) != 0 || !player.carries("iron sword") {
+		t.Fatal("Expected the player to have taken the iron sword")
+	}
+	
+	var forest *areaFile
+	for _, area := range game.world.areas {
+		if area.id() == "forest" {
+			forest = area
+		}
+	}
+	start := time.Now()
+	game.resetAreas(start)
+	game.resetAreas(start.Add(14 * time.Minute))
+	if len(deep.items) != 0 {
+		t.Fatal("The forest should not reset before its interval")
+	}
+	
+	clearPlayerMessages(player)
+	game.resetAreas(start.Add(15 * time.Minute))
+	if len(deep.items) != 1 || deep.items[0].name != "iron sword" {
+		t.Errorf("Expected the iron sword to be restocked, got %v", deep.items)
+	}
+	if len(dungeon.items) != 1 || dungeon.items[0].name != "rusty key" {
+		t.Errorf("Expected the rusty key to be restocked, got %v", dungeon.items)
+	}
+	if door := dungeon.doors["north"]; !door.closed || !door.locked {
+		t.Error("Expected the dungeon door to be locked again")
+	}
+	if !strings.Contains(lastMessage(player), "swings shut") {
+		t.Errorf("Expected the player to see the door shut, got %q", lastMessage(player))
+	}
+	if next := game.nextReset[forest]; !next.Equal(start.Add(30 * time.Minute)) {
+		t.Errorf("Expected the next reset 15 minutes later, got %v", next.Sub(start))
+	}
+	
+	// A reset doesn't add to items that are still there.
+	game.resetArea(forest)
+	if len(deep.items) != 1 {
+		t.Errorf("Expected one iron sword after a second reset, got %d", len(deep.items))
+	}
+}
+
+func TestRespawnSettings(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a.area": {Data: []byte(`# settings
+reset 2m
+
+monster rat
+  name rat
+  health 3
+  respawn soon
+
+room hole
+  name Hole
+  spawn rat
+`)},
+	}
+	world, errs := readWorldData(fsys, "areas")
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), `areas/a.area:7: respawn must be a positive duration like 90s or 10m, got "soon"`) {
+		t.Errorf("Expected a bad respawn error, got %v", errs)
+	}
+	if world.areas[0].reset != 2*time.Minute {
+		t.Errorf("Expected the area to reset every 2m, got %v", world.areas[0].reset)
+	}
+	if got := string(world.areas[0].format()); !strings.HasPrefix(got, "# settings\nreset 2m\n") {
+		t.Errorf("Expected the reset to be written back, got:\n%s", got)
+	}
+}
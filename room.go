@@ -1,20 +1,24 @@
 package main
 
-type Item struct {
-	name        string
-	description string
-	itemType    string // "weapon", "armor", "misc"
-	damage      int    // for weapons
-	defense     int    // for armor
-}
-
 type Room struct {
+	id          string
+	area        string
 	name        string
 	description string
 	players     []*Player
 	items       []*Item
 	monsters    []*Monster
 	exits       map[string]*Room
+	doors       map[string]*Door // by direction, for the exits that have one
+	shop        *Shop            // the shop trading here, if any
+}
+
+// Door is a door in an exit. Both sides of a two-way exit share the same
+// door, so opening it from one side opens it from the other.
+type Door struct {
+	key    string // prototype id of the item that locks and unlocks it, or "" if it has no lock
+	closed bool
+	locked bool
 }
 
 func (r *Room) Broadcast(message string, except *Player) {
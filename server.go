@@ -0,0 +1,264 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// sessionDrainTimeout bounds how long shutdown waits for connections to
+// flush their last output before closing them outright.
+const sessionDrainTimeout = 5 * time.Second
+
+// Server owns the listeners and runs the shutdown and copyover sequences.
+type Server struct {
+	config    Config
+	game      *Game
+	listeners []net.Listener
+	web       *http.Server
+	
+	// raw holds the TCP listener beneath each role ("telnet", "tls",
+	// "web"), which is what a copyover hands to the next process.
+	raw       map[string]net.Listener
+	inherited map[string]*os.File
+}
+
+func NewServer(config Config, game *Game) *Server {
+	server := &Server{config: config, game: game, raw: make(map[string]net.Listener)}
+	game.copyover = server.copyover
+	return server
+}
+
+// listen opens the listener for a role, or takes over the one inherited
+// from a copyover.
+func (s *Server) listen(role, address string) (net.Listener, error) {
+	var listener net.Listener
+	var err error
+	if file := s.inherited[role]; file != nil {
+		delete(s.inherited, role)
+		listener, err = net.FileListener(file)
+		file.Close()
+	} else {
+		listener, err = net.Listen("tcp", address)
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.raw[role] = listener
+	return listener, nil
+}
+
+// Listen opens every configured listener, closing any already opened if one
+// fails.
+func (s *Server) Listen() error {
+	defer s.closeInherited()
+	
+	listener, err := s.listen("telnet", s.config.Telnet)
+	if err != nil {
+		return err
+	}
+	s.listeners = append(s.listeners, listener)
+	
+	if s.config.TLS.Address != "" {
+		tlsConfig, err := loadTLSConfig(s.config.TLS.Cert, s.config.TLS.Key, s.config.TLS.SelfSigned)
+		if err != nil {
+			s.closeListeners()
+			return fmt.Errorf("configuring TLS: %w", err)
+		}
+		listener, err := s.listen("tls", s.config.TLS.Address)
+		if err != nil {
+			s.closeListeners()
+			return err
+		}
+		s.listeners = append(s.listeners, tls.NewListener(listener, tlsConfig))
+	}
+	
+	if s.config.Web != "" {
+		listener, err := s.listen("web", s.config.Web)
+		if err != nil {
+			s.closeListeners()
+			return err
+		}
+		s.web = &http.Server{Handler: NewWebHandler(s.game)}
+		go func() {
+			if err := s.web.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Printf("Web client listener stopped: %v", err)
+			}
+		}()
+	}
+	return nil
+}
+
+// Serve accepts telnet connections on every listener.
+func (s *Server) Serve() {
+	for _, listener := range s.listeners {
+		go serve(listener, s.game)
+	}
+}
+
+// closeInherited closes listeners passed by a copyover that the current
+// configuration no longer uses.
+func (s *Server) closeInherited() {
+	for role, file := range s.inherited {
+		log.Printf("Closing inherited %s listener", role)
+		file.Close()
+	}
+	s.inherited = nil
+}
+
+func (s *Server) closeListeners() {
+	for _, listener := range s.listeners {
+		listener.Close()
+	}
+	if s.web != nil {
+		s.web.Close()
+	}
+}
+
+// Shutdown warns players over the countdown, then stops the game and closes
+// every connection. A value on hurry skips the rest of the countdown.
+func (s *Server) Shutdown(countdown time.Duration, hurry <-chan os.Signal) {
+	log.Printf("Shutting down in %v", countdown)
+	s.closeListeners()
+	
+	s.countdown(countdown, hurry)
+	
+	s.game.Do(func() {
+		if err := s.game.saveState(); err != nil {
+			log.Printf("Failed to save state: %v", err)
+		}
+		for _, player := range s.game.players {
+			player.SendMessage(ColorWarning("The server is shutting down now. Goodbye!"))
+			player.disconnect()
+		}
+	})
+	s.game.Stop()
+	
+	if !s.game.sessions.wait(sessionDrainTimeout) {
+		log.Printf("Closing connections that did not finish within %v", sessionDrainTimeout)
+		s.game.sessions.closeAll()
+		s.game.sessions.wait(sessionDrainTimeout)
+	}
+	
+	s.dumpTelemetry()
+	log.Printf("Shutdown complete")
+}
+
+// countdownWarnings are the remaining times at which players are warned.
+var countdownWarnings = []time.Duration{
+	5 * time.Minute, 2 * time.Minute, time.Minute,
+	30 * time.Second, 10 * time.Second, 5 * time.Second,
+	3 * time.Second, 2 * time.Second, time.Second,
+}
+
+func (s *Server) countdown(total time.Duration, hurry <-chan os.Signal) {
+	deadline := time.Now().Add(total)
+	announce := func(remaining time.Duration) {
+		message := ColorWarning(fmt.Sprintf("The server is shutting down in %s.", formatCountdown(remaining)))
+		s.game.Do(func() {
+			s.game.broadcastAll(message, nil)
+		})
+	}
+	
+	if total > 0 {
+		announce(total)
+	}
+	for _, warning := range countdownWarnings {
+		if warning >= total {
+			continue
+		}
+		select {
+		case <-time.After(time.Until(deadline.Add(-warning))):
+			announce(warning)
+		case <-hurry:
+			log.Printf("Skipping the rest of the shutdown countdown")
+			return
+		}
+	}
+	if total > 0 {
+		select {
+		case <-time.After(time.Until(deadline)):
+		case <-hurry:
+		}
+	}
+}
+
+func formatCountdown(d time.Duration) string {
+	switch {
+	case d >= time.Minute && d%time.Minute == 0:
+		return pluralize(int(d/time.Minute), "minute")
+	default:
+		return pluralize(int((d+time.Second-1)/time.Second), "second")
+	}
+}
+
+func pluralize(n int, unit string) string {
+	if n == 1 {
+		return fmt.Sprintf("1 %s", unit)
+	}
+	return fmt.Sprintf("%d %ss", n, unit)
+}
+
+func (s *Server) dumpTelemetry() {
+	GlobalTelemetry.LogStats()
+	if s.config.Telemetry.DumpFile == "" {
+		return
+	}
+	if err := GlobalTelemetry.WriteFile(s.config.Telemetry.DumpFile); err != nil {
+		log.Printf("Failed to write telemetry dump: %v", err)
+	}
+}
+
+// sessionSet tracks live connections so shutdown can wait for them to
+// finish and close any that do not.
+type sessionSet struct {
+	wg    sync.WaitGroup
+	mu    sync.Mutex
+	conns map[net.Conn]struct{}
+}
+
+func (s *sessionSet) add(conn net.Conn) {
+	s.wg.Add(1)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conns == nil {
+		s.conns = make(map[net.Conn]struct{})
+	}
+	s.conns[conn] = struct{}{}
+}
+
+func (s *sessionSet) done(conn net.Conn) {
+	s.mu.Lock()
+	delete(s.conns, conn)
+	s.mu.Unlock()
+	s.wg.Done()
+}
+
+func (s *sessionSet) closeAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+}
+
+// wait reports whether every session finished within timeout.
+func (s *sessionSet) wait(timeout time.Duration) bool {
+	finished := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestGracefulShutdown(t *testing.T) {
+	config := testConfig(t)
+	config.Telnet = "127.0.0.1:0"
+	config.Web = ""
+	config.Telemetry.DumpFile = filepath.Join(t.TempDir(), "telemetry.json")
+	
+	game := newTestGame(t, config)
+	game.Start()
+	
+	server := NewServer(config, game)
+	if err := server.Listen(); err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	server.Serve()
+	address := server.listeners[0].Addr().String()
+	
+	conn, err := net.Dial("tcp", address)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	reader := bufio.NewReader(conn)
+	if !readUntilText(reader, "What is your name?") {
+		t.Fatal("Expected name prompt")
+	}
+	conn.Write([]byte("Lingerer\r\n"))
+	readUntilText(reader, "Choose a password:")
+	conn.Write([]byte("notyet\r\n"))
+	readUntilText(reader, "Confirm password:")
+	conn.Write([]byte("notyet\r\n"))
+	if !readUntilText(reader, "Hello, ") {
+		t.Fatal("Expected greeting")
+	}
+	
+	done := make(chan struct{})
+	go func() {
+		server.Shutdown(2*time.Second, nil)
+		close(done)
+	}()
+	
+	if !readUntilText(reader, "shutting down in 2 seconds") {
+		t.Error("Expected countdown warning")
+	}
+	if !readUntilText(reader, "shutting down in 1 second.") {
+		t.Error("Expected final countdown warning")
+	}
+	if !readUntilText(reader, "Goodbye!") {
+		t.Error("Expected goodbye message")
+	}
+	if _, err := io.ReadAll(reader); err != nil {
+		t.Errorf("Expected connection to close cleanly, got %v", err)
+	}
+	
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("Shutdown did not finish")
+	}
+	
+	if _, err := net.DialTimeout("tcp", address, time.Second); err == nil {
+		t.Error("Expected listener to be closed")
+	}
+	if game.Do(func() {}) {
+		t.Error("Expected game loop to be stopped")
+	}
+	if _, err := os.Stat(config.Telemetry.DumpFile); err != nil {
+		t.Errorf("Expected telemetry dump: %v", err)
+	}
+	if _, err := os.Stat(config.World.StateFile); err != nil {
+		t.Errorf("Expected world state to be saved: %v", err)
+	}
+	if _, err := os.Stat(game.saves.path("Lingerer")); err != nil {
+		t.Errorf("Expected player to be saved: %v", err)
+	}
+}
+
+func TestShutdownHurry(t *testing.T) {
+	config := testConfig(t)
+	config.Telnet = "127.0.0.1:0"
+	config.Web = ""
+	
+	game, err := NewGameWithConfig(config)
+	if err != nil {
+		t.Fatalf("Failed to create game: %v", err)
+	}
+	game.Start()
+	server := NewServer(config, game)
+	if err := server.Listen(); err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	
+	hurry := make(chan os.Signal, 1)
+	hurry <- os.Interrupt
+	start := time.Now()
+	server.Shutdown(time.Minute, hurry)
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected a second signal to skip the countdown, took %v", elapsed)
+	}
+}
+
+func TestFormatCountdown(t *testing.T) {
+	tests := map[time.Duration]string{
+		time.Second:            "1 second",
+		10 * time.Second:       "10 seconds",
+		1500 * time.Millisecond: "2 seconds",
+		time.Minute:            "1 minute",
+		5 * time.Minute:        "5 minutes",
+		90 * time.Second:       "90 seconds",
+	}
+	for d, expected := range tests {
+		if got := formatCountdown(d); got != expected {
+			t.Errorf("formatCountdown(%v) = %q, expected %q", d, got, expected)
+		}
+	}
+}
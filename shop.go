@@ -0,0 +1,230 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Shop is a shopkeeper trading in a room. Players buy from what the shop
+// has for sale, and what they sell to it goes on sale too.
+type Shop struct {
+	def       *shopDef
+	items     []*Item
+	restocked time.Time // zero until the game first looks at the shop
+}
+
+// newShop creates a shop with its full stock.
+func (w *worldData) newShop(def *shopDef) *Shop {
+	shop := &Shop{def: def}
+	for _, stock := range def.stock {
+		if proto := w.items[stock.item]; proto != nil {
+			for range stock.count {
+				shop.items = append(shop.items, proto.newItem())
+			}
+		}
+	}
+	return shop
+}
+
+// goldCoins writes an amount of gold, "1 gold coin" or "5 gold coins".
+func goldCoins(n int) string {
+	if n == 1 {
+		return ColorGold("1 gold coin")
+	}
+	return ColorGold(fmt.Sprintf("%d gold coins", n))
+}
+
+// isGold reports whether a name a player typed means coins.
+func isGold(name string) bool {
+	return name == "gold" || name == "coins" || name == "gold coin" || name == "gold coins"
+}
+
+// buyPrice is what a player pays the shop for an item: its value with the
+// shop's markup, and never nothing.
+func (g *Game) buyPrice(shop *Shop, item *Item) int {
+	return max(g.itemValue(item)*shop.def.markup/100, 1)
+}
+
+// sellPrice is what the shop pays a player for an item. The shop won't buy
+// an item it would pay nothing for.
+func (g *Game) sellPrice(shop *Shop, item *Item) int {
+	return g.itemValue(item) * shop.def.offer / 100
+}
+
+// handleShop runs list, buy, sell and value.
+func (g *Game) handleShop(p *Player, cmd string, args []string) {
+	shop := p.location.shop
+	if shop == nil {
+		p.SendMessage(ColorError("There is no shop here."))
+		return
+	}
+	if cmd == "list" {
+		g.listShop(p, shop)
+		return
+	}
+	if len(args) == 0 {
+		p.SendMessage(ColorWarning(capitalize(cmd) + " what?"))
+		return
+	}
+	
+	itemName := strings.ToLower(strings.Join(args, " "))
+	switch cmd {
+	case "buy":
+		g.buyItem(p, shop, itemName)
+	case "sell":
+		g.sellItem(p, shop, itemName)
+	case "value":
+		g.valueItem(p, shop, itemName)
+	}
+}
+
+// listShop shows what the shop has for sale, each kind of item once with
+// its price and how many are left.
+func (g *Game) listShop(p *Player, shop *Shop) {
+	keeper := ColorName(shop.def.keeper)
+	if len(shop.items) == 0 {
+		p.SendMessage(ColorInfo(fmt.Sprintf("%s has nothing for sale right now.", keeper)))
+		return
+	}
+	
+	var names []string
+	first := make(map[string]*Item)
+	count := make(map[string]int)
+	for _, item := range shop.items {
+		if first[item.name] == nil {
+			names = append(names, item.name)
+			first[item.name] = item
+		}
+		count[item.name]++
+	}
+	p.SendMessage(fmt.Sprintf("%s%s has for sale:%s", ColorBold, keeper, ColorReset))
+	for _, name := range names {
+		price := fmt.Sprintf("%d gold", g.buyPrice(shop, first[name]))
+		p.SendMessage(fmt.Sprintf("  %s %s  (%d left)", ColorItem(fmt.Sprintf("%-24s", name)), ColorGold(fmt.Sprintf("%9s", price)), count[name]))
+	}
+	p.SendMessage(fmt.Sprintf("You have %s.", goldCoins(p.gold)))
+}
+
+// buyItem sells the player the first item of that name the shop has.
+func (g *Game) buyItem(p *Player, shop *Shop, itemName string) {
+	keeper := ColorName(shop.def.keeper)
+	for i, item := range shop.items {
+		if strings.ToLower(item.name) != itemName {
+			continue
+		}
+		price := g.buyPrice(shop, item)
+		if p.gold < price {
+			p.SendMessage(ColorError(fmt.Sprintf("The %s costs %s, and you only have %s.", ColorItem(item.name), goldCoins(price), goldCoins(p.gold))))
+			return
+		}
+		shop.items = append(shop.items[:i], shop.items[i+1:]...)
+		p.inventory = append(p.inventory, item)
+		p.gold -= price
+		p.SendMessage(ColorSuccess(fmt.Sprintf("You buy the %s from %s for %s.", ColorItem(item.name), keeper, goldCoins(price))))
+		p.location.Broadcast(fmt.Sprintf("%s buys the %s from %s.", ColorName(p.name), ColorItem(item.name), keeper), p)
+		return
+	}
+	p.SendMessage(ColorError(fmt.Sprintf("%s has no %s for sale.", keeper, itemName)))
+}
+
+// sellItem sells the shop an item the player carries. Equipped items have
+// to be removed first.
+func (g *Game) sellItem(p *Player, shop *Shop, itemName string) {
+	keeper := ColorName(shop.def.keeper)
+	for i, item := range p.inventory {
+		if strings.ToLower(item.name) != itemName {
+			continue
+		}
+		price := g.sellPrice(shop, item)
+		if price == 0 {
+			p.SendMessage(ColorWarning(fmt.Sprintf("%s isn't interested in the %s.", keeper, ColorItem(item.name))))
+			return
+		}
+		p.inventory = append(p.inventory[:i], p.inventory[i+1:]...)
+		shop.items = append(shop.items, item)
+		p.gold += price
+		p.SendMessage(ColorSuccess(fmt.Sprintf("You sell the %s to %s for %s.", ColorItem(item.name), keeper, goldCoins(price))))
+		p.location.Broadcast(fmt.Sprintf("%s sells the %s to %s.", ColorName(p.name), ColorItem(item.name), keeper), p)
+		return
+	}
+	p.SendMessage(ColorError("You don't have that item."))
+}
+
+// valueItem tells the player what the shop would pay for an item they
+// carry, or what it asks for one it sells.
+func (g *Game) valueItem(p *Player, shop *Shop, itemName string) {
+	keeper := ColorName(shop.def.keeper)
+	for _, item := range p.inventory {
+		if strings.ToLower(item.name) != itemName {
+			continue
+		}
+		if price := g.sellPrice(shop, item); price > 0 {
+			p.SendMessage(ColorInfo(fmt.Sprintf("%s would pay %s for the %s.", keeper, goldCoins(price), ColorItem(item.name))))
+		} else {
+			p.SendMessage(ColorInfo(fmt.Sprintf("%s isn't interested in the %s.", keeper, ColorItem(item.name))))
+		}
+		return
+	}
+	for _, item := range shop.items {
+		if strings.ToLower(item.name) == itemName {
+			p.SendMessage(ColorInfo(fmt.Sprintf("%s sells the %s for %s.", keeper, ColorItem(item.name), goldCoins(g.buyPrice(shop, item)))))
+			return
+		}
+	}
+	p.SendMessage(ColorError("You don't have that item."))
+}
+
+// restockInterval is how often a shop restocks.
+func (g *Game) restockInterval(shop *Shop) time.Duration {
+	if shop.def.restock > 0 {
+		return shop.def.restock
+	}
+	return time.Duration(g.config.World.Restock)
+}
+
+// restockShops restocks the shops that are due. Like an area reset, a
+// shop's first restock is one interval after the game first looks at it.
+func (g *Game) restockShops(now time.Time) {
+	for _, room := range g.rooms {
+		shop := room.shop
+		if shop == nil {
+			continue
+		}
+		if shop.restocked.IsZero() {
+			shop.restocked = now
+			continue
+		}
+		if now.Sub(shop.restocked) < g.restockInterval(shop) {
+			continue
+		}
+		shop.restocked = now
+		if g.restockShop(shop) {
+			room.Broadcast(fmt.Sprintf("%s puts out some fresh stock.", ColorName(shop.def.keeper)), nil)
+		}
+	}
+}
+
+// restockShop puts one more of each item the shop stocks on sale, up to
+// the number it keeps. Items players sold to it count too. It reports
+// whether anything was added.
+func (g *Game) restockShop(shop *Shop) bool {
+	added := false
+	for _, stock := range shop.def.stock {
+		proto := g.world.items[stock.item]
+		if proto == nil {
+			continue
+		}
+		have := 0
+		for _, item := range shop.items {
+			if item.proto == stock.item {
+				have++
+			}
+		}
+		if have < stock.count {
+			shop.items = append(shop.items, proto.newItem())
+			added = true
+		}
+	}
+	return added
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestShopDefinitions(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a.area": {Data: []byte(`item mug
+  name mug
+  value 2
+
+item pebble
+  name pebble
+
+room hall
+  name Hall
+
+shop stall
+  at hall
+  stock mug 0
+  stock cup 1
+  stock pebble 1
+
+shop greedy
+  keeper Greedy Gus
+  at hall
+  markup 50
+  offer 80
+
+shop lost
+  keeper Lost Lou
+  at nowhere
+`)},
+	}
+	_, err := loadWorldData(fsys, "areas")
+	if err == nil {
+		t.Fatal("Expected errors")
+	}
+	for _, want := range []string{
+		`areas/a.area:11: shop stall has no keeper`,
+		`areas/a.area:13: stock needs an item and how many to keep`,
+		`areas/a.area:14: shop stall stocks unknown item "cup"`,
+		`areas/a.area:15: shop stall stocks item pebble, which has no value`,
+		`areas/a.area:17: shop greedy offers more than it charges (offer 80, markup 50)`,
+		`areas/a.area:19: room hall already has shop stall`,
+		`areas/a.area:25: shop lost is in unknown room "nowhere"`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected error %q in:\n%v", want, err)
+		}
+	}
+}
+
+func TestShopTrade(t *testing.T) {
+	game := NewGame()
+	player := createMockPlayer("Trader")
+	game.AddPlayer(player)
+	player.HandleCommand(game, "east")
+	if !strings.Contains(strings.Join(getPlayerMessages(player), "\n"), "Marta the merchant") {
+		t.Fatal("Expected the merchant to be in the Marketplace")
+	}
+	shop := game.rooms["market"].shop
+	
+	clearPlayerMessages(player)
+	player.HandleCommand(game, "list")
+	got := ansiCodes.ReplaceAllString(strings.Join(getPlayerMessages(player), "\n"), "")
+	for _, want := range []string{"wooden mug", "3 gold  (3 left)", "iron sword", "45 gold  (1 left)"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Expected %q in the list:\n%s", want, got)
+		}
+	}
+	
+	player.HandleCommand(game, "buy iron sword")
+	if player.carries("iron sword") || !strings.Contains(lastMessage(player), "only have") {
+		t.Fatalf("Expected to be unable to afford the sword, got %q", lastMessage(player))
+	}
+	player.gold = 50
+	player.HandleCommand(game, "buy iron sword")
+	if !player.carries("iron sword") || player.gold != 5 || len(shop.items) != 6 {
+		t.Fatalf("Expected to buy the sword for 45 gold, got %d gold left and %q", player.gold, lastMessage(player))
+	}
+	player.HandleCommand(game, "buy iron sword")
+	if !strings.Contains(lastMessage(player), "no iron sword for sale") {
+		t.Errorf("Expected the sword to be sold out, got %q", lastMessage(player))
+	}
+	
+	player.HandleCommand(game, "value iron sword")
+	if !strings.Contains(ansiCodes.ReplaceAllString(lastMessage(player), ""), "would pay 15 gold coins") {
+		t.Errorf("Expected the sword to be worth 15 gold to the shop, got %q", lastMessage(player))
+	}
+	player.HandleCommand(game, "sell iron sword")
+	if player.carries("iron sword") || player.gold != 20 || len(shop.items) != 7 {
+		t.Errorf("Expected to sell the sword for 15 gold, got %d gold and %q", player.gold, lastMessage(player))
+	}
+	
+	player.inventory = append(player.inventory, &Item{name: "pocket lint", itemType: "misc"})
+	player.HandleCommand(game, "sell pocket lint")
+	if !player.carries("pocket lint") || !strings.Contains(lastMessage(player), "isn't interested") {
+		t.Errorf("Expected the merchant to refuse worthless items, got %q", lastMessage(player))
+	}
+	
+	player.HandleCommand(game, "west")
+	player.HandleCommand(game, "list")
+	if !strings.Contains(lastMessage(player), "no shop here") {
+		t.Errorf("Expected no shop in the square, got %q", lastMessage(player))
+	}
+}
+
+func TestShopRestock(t *testing.T) {
+	game := NewGame()
+	shop := game.rooms["market"].shop
+	shop.items = shop.items[:0]
+	
+	now := time.Now()
+	game.restockShops(now)
+	game.restockShops(now.Add(9 * time.Minute))
+	if len(shop.items) != 0 {
+		t.Fatalf("Expected no restock before the interval, got %d items", len(shop.items))
+	}
+	game.restockShops(now.Add(10 * time.Minute))
+	if len(shop.items) != 4 {
+		t.Fatalf("Expected one of each item back, got %d", len(shop.items))
+	}
+	for i := 2; i <= 4; i++ {
+		game.restockShops(now.Add(time.Duration(i*10) * time.Minute))
+	}
+	// Three mugs, two suits of leather armor, a sword and a prayer book.
+	if len(shop.items) != 7 {
+		t.Errorf("Expected the shop to stop at its full stock, got %d items", len(shop.items))
+	}
+	
+	restored := NewGame()
+	restored.restoreWorld(game.snapshotWorld())
+	if got := restored.rooms["market"].shop.items; len(got) != 7 || got[0].id != shop.items[0].id {
+		t.Errorf("Expected the stock to survive a restart, got %d items", len(got))
+	}
+}
+
+func TestCoinDrops(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "den.area"), []byte(`monster thief
+  name thief
+  health 1
+  gold 7
+
+room den
+  name Den
+  spawn thief
+`), 0644)
+	config := testConfig(t)
+	config.World.Dir = dir
+	config.Player.StartRoom = "den"
+	config.Player.RespawnRoom = "den"
+	game := newTestGame(t, config)
+	player := createMockPlayer("Hunter")
+	game.AddPlayer(player)
+	
+	player.HandleCommand(game, "attack thief")
+	corpse := game.rooms["den"].findCorpse("corpse")
+	if corpse == nil || corpse.gold != 7 {
+		t.Fatalf("Expected a corpse with 7 gold, got %+v", corpse)
+	}
+	player.HandleCommand(game, "get gold from corpse")
+	if player.gold != 7 || corpse.gold != 0 {
+		t.Errorf("Expected to take the gold, got %d and %q", player.gold, lastMessage(player))
+	}
+	player.HandleCommand(game, "get all from corpse")
+	if !strings.Contains(lastMessage(player), "empty") {
+		t.Errorf("Expected the corpse to be empty, got %q", lastMessage(player))
+	}
+	
+	saved := createTestPlayer("")
+	player.snapshot().restore(saved, nil)
+	if saved.gold != 7 {
+		t.Errorf("Expected gold to be saved, got %d", saved.gold)
+	}
+}
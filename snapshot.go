@@ -0,0 +1,310 @@
+package main
+
+import "time"
+
+// Snapshots are plain, JSON-friendly copies of game state. They carry
+// players and the world across a copyover and into save files.
+
+type itemSnapshot struct {
+	ID          uint64 `json:"id,omitempty"`
+	Proto       string `json:"proto,omitempty"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Type        string `json:"type"`
+	Damage      int    `json:"damage,omitempty"`
+	Defense     int    `json:"defense,omitempty"`
+	
+	Contents []itemSnapshot `json:"contents,omitempty"`
+	Gold     int            `json:"gold,omitempty"`
+	Decays   time.Time      `json:"decays,omitzero"`
+}
+
+type playerSnapshot struct {
+	Name      string         `json:"name"`
+	Room      string         `json:"room"`
+	Health    int            `json:"health"`
+	MaxHealth int            `json:"max_health"`
+	Damage    int            `json:"damage"`
+	Level     int            `json:"level,omitempty"`
+	XP        int            `json:"xp,omitempty"`
+	Gold      int            `json:"gold,omitempty"`
+	Inventory []itemSnapshot `json:"inventory"`
+	Weapon    *itemSnapshot  `json:"weapon,omitempty"`
+	Armor     *itemSnapshot  `json:"armor,omitempty"`
+	Width     int            `json:"width,omitempty"`
+	Visited   []string       `json:"visited,omitempty"`
+	Minimap   bool           `json:"minimap,omitempty"`
+}
+
+// monsterSnapshot records a monster by its room and position in that room,
+// which are fixed when the world is built. Proto guards against the world
+// files having changed since.
+type monsterSnapshot struct {
+	Room     string    `json:"room"`
+	Index    int       `json:"index"`
+	Proto    string    `json:"proto,omitempty"`
+	Health   int       `json:"health"`
+	Alive    bool      `json:"alive"`
+	KilledAt time.Time `json:"killed_at,omitzero"`
+}
+
+// doorSnapshot records a door by a room it is in and its direction from
+// there.
+type doorSnapshot struct {
+	Room      string `json:"room"`
+	Direction string `json:"direction"`
+	Closed    bool   `json:"closed,omitempty"`
+	Locked    bool   `json:"locked,omitempty"`
+}
+
+type worldSnapshot struct {
+	RoomItems map[string][]itemSnapshot `json:"room_items"`
+	Monsters  []monsterSnapshot         `json:"monsters"`
+	Doors     []doorSnapshot            `json:"doors,omitempty"`
+	
+	// Shops holds what each shop has for sale, by shop id.
+	Shops map[string][]itemSnapshot `json:"shops,omitempty"`
+	
+	// LastItemID is the last item id handed out.
+	LastItemID uint64 `json:"last_item_id,omitempty"`
+}
+
+func (i *Item) snapshot() itemSnapshot {
+	return itemSnapshot{
+		ID:          i.id,
+		Proto:       i.proto,
+		Name:        i.name,
+		Description: i.description,
+		Type:        i.itemType,
+		Damage:      i.damage,
+		Defense:     i.defense,
+		Contents:    snapshotContents(i.contents),
+		Gold:        i.gold,
+		Decays:      i.decays,
+	}
+}
+
+// snapshotContents is snapshotItems for what is inside an item, which is
+// usually nothing.
+func snapshotContents(items []*Item) []itemSnapshot {
+	if len(items) == 0 {
+		return nil
+	}
+	return snapshotItems(items)
+}
+
+// restore makes the item again with its id. It gets a new id if it was
+// saved before items had them, or if its id is in taken, which restore adds
+// it to. taken may be nil when nothing else can hold the id.
+func (s itemSnapshot) restore(taken map[uint64]bool) *Item {
+	id := s.ID
+	if id == 0 || taken[id] {
+		id = itemIDs.next()
+	} else {
+		itemIDs.reserve(id)
+	}
+	if taken != nil {
+		taken[id] = true
+	}
+	return &Item{
+		id:          id,
+		proto:       s.Proto,
+		name:        s.Name,
+		description: s.Description,
+		itemType:    s.Type,
+		damage:      s.Damage,
+		defense:     s.Defense,
+		contents:    restoreItems(s.Contents, taken),
+		gold:        s.Gold,
+		decays:      s.Decays,
+	}
+}
+
+func snapshotItems(items []*Item) []itemSnapshot {
+	snapshots := make([]itemSnapshot, 0, len(items))
+	for _, item := range items {
+		snapshots = append(snapshots, item.snapshot())
+	}
+	return snapshots
+}
+
+func restoreItems(snapshots []itemSnapshot, taken map[uint64]bool) []*Item {
+	items := make([]*Item, 0, len(snapshots))
+	for _, snapshot := range snapshots {
+		items = append(items, snapshot.restore(taken))
+	}
+	return items
+}
+
+func snapshotOptionalItem(item *Item) *itemSnapshot {
+	if item == nil {
+		return nil
+	}
+	snapshot := item.snapshot()
+	return &snapshot
+}
+
+func restoreOptionalItem(snapshot *itemSnapshot, taken map[uint64]bool) *Item {
+	if snapshot == nil {
+		return nil
+	}
+	return snapshot.restore(taken)
+}
+
+func (p *Player) snapshot() playerSnapshot {
+	snapshot := playerSnapshot{
+		Name:      p.name,
+		Health:    p.health,
+		MaxHealth: p.maxHealth,
+		Damage:    p.damage,
+		Level:     p.level,
+		XP:        p.xp,
+		Gold:      p.gold,
+		Inventory: snapshotItems(p.inventory),
+		Weapon:    snapshotOptionalItem(p.weapon),
+		Armor:     snapshotOptionalItem(p.armor),
+		Width:     p.width,
+		Visited:   p.visitedRooms(),
+		Minimap:   p.minimap,
+	}
+	if p.location != nil {
+		snapshot.Room = p.location.id
+	}
+	return snapshot
+}
+
+// restore copies the snapshot's stats and belongings onto p. The room is
+// left to the caller, which has to add the player to it. Items whose ids
+// are in taken get new ones; see Game.itemsInUse.
+func (s playerSnapshot) restore(p *Player, taken map[uint64]bool) {
+	p.name = s.Name
+	p.health = s.Health
+	p.maxHealth = s.MaxHealth
+	p.damage = s.Damage
+	p.level = max(s.Level, 1) // saves from before levels are level 1
+	p.xp = s.XP
+	p.gold = s.Gold
+	p.inventory = restoreItems(s.Inventory, taken)
+	p.weapon = restoreOptionalItem(s.Weapon, taken)
+	p.armor = restoreOptionalItem(s.Armor, taken)
+	p.width = s.Width
+	p.visited = make(map[string]bool)
+	for _, id := range s.Visited {
+		p.visited[id] = true
+	}
+	p.minimap = s.Minimap
+}
+
+// itemsInUse returns the ids of every item in the world. A save can hold an
+// id the world has handed out since, for instance after a start without the
+// world state, and restoring it must not make a second item with that id.
+func (g *Game) itemsInUse() map[uint64]bool {
+	ids := make(map[uint64]bool)
+	var add func(items []*Item)
+	add = func(items []*Item) {
+		for _, item := range items {
+			if item != nil {
+				ids[item.id] = true
+				add(item.contents)
+			}
+		}
+	}
+	for _, room := range g.rooms {
+		add(room.items)
+		if room.shop != nil {
+			add(room.shop.items)
+		}
+	}
+	for _, player := range g.players {
+		add(player.inventory)
+		add([]*Item{player.weapon, player.armor})
+	}
+	return ids
+}
+
+func (g *Game) snapshotWorld() worldSnapshot {
+	world := worldSnapshot{
+		RoomItems:  make(map[string][]itemSnapshot),
+		LastItemID: itemIDs.last.Load(),
+	}
+	for id, room := range g.rooms {
+		world.RoomItems[id] = snapshotItems(room.items)
+		for i, monster := range room.monsters {
+			world.Monsters = append(world.Monsters, monsterSnapshot{
+				Room:     id,
+				Index:    i,
+				Proto:    monster.proto,
+				Health:   monster.health,
+				Alive:    monster.alive,
+				KilledAt: monster.killedAt,
+			})
+		}
+		if room.shop != nil {
+			if world.Shops == nil {
+				world.Shops = make(map[string][]itemSnapshot)
+			}
+			world.Shops[room.shop.def.id] = snapshotItems(room.shop.items)
+		}
+		for direction, door := range room.doors {
+			world.Doors = append(world.Doors, doorSnapshot{
+				Room:      id,
+				Direction: direction,
+				Closed:    door.closed,
+				Locked:    door.locked,
+			})
+		}
+	}
+	return world
+}
+
+// restoreWorld applies a snapshot to a freshly built world. Rooms and
+// monsters the snapshot does not mention, or that the world files now
+// define differently, keep their starting state.
+func (g *Game) restoreWorld(world worldSnapshot) {
+	itemIDs.reserve(world.LastItemID)
+	taken := make(map[uint64]bool)
+	for id, room := range g.rooms {
+		if items, ok := world.RoomItems[id]; ok {
+			room.items = restoreItems(items, taken)
+			continue
+		}
+		// The items of a room the snapshot doesn't know were made before
+		// the saved ids were reserved, so their ids may be taken.
+		for _, item := range room.items {
+			item.id = itemIDs.next()
+		}
+	}
+	for _, room := range g.rooms {
+		if room.shop == nil {
+			continue
+		}
+		if items, ok := world.Shops[room.shop.def.id]; ok {
+			room.shop.items = restoreItems(items, taken)
+			continue
+		}
+		for _, item := range room.shop.items {
+			item.id = itemIDs.next()
+		}
+	}
+	for _, saved := range world.Monsters {
+		room := g.rooms[saved.Room]
+		if room == nil || saved.Index < 0 || saved.Index >= len(room.monsters) {
+			continue
+		}
+		monster := room.monsters[saved.Index]
+		if saved.Proto != "" && saved.Proto != monster.proto {
+			continue
+		}
+		monster.health = saved.Health
+		monster.alive = saved.Alive
+		monster.killedAt = saved.KilledAt
+	}
+	for _, saved := range world.Doors {
+		if room := g.rooms[saved.Room]; room != nil {
+			if door := room.doors[saved.Direction]; door != nil {
+				door.closed = saved.Closed
+				door.locked = saved.Locked && door.key != ""
+			}
+		}
+	}
+}
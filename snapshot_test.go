@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	game := NewGame()
+	player := createTestPlayer("Keeper")
+	game.AddPlayer(player)
+	player.HandleCommand(game, "go north")
+	player.HandleCommand(game, "get wooden mug")
+	player.health = 17
+	player.maxHealth = 40
+	player.damage = 9
+	player.width = 100
+	player.weapon = &Item{name: "rusty sword", itemType: "weapon", damage: 3}
+	
+	rat := game.rooms["forest"].monsters[0]
+	rat.health = 4
+	
+	data, err := json.Marshal(struct {
+		Player playerSnapshot
+		World  worldSnapshot
+	}{player.snapshot(), game.snapshotWorld()})
+	if err != nil {
+		t.Fatalf("Failed to encode snapshot: %v", err)
+	}
+	var saved struct {
+		Player playerSnapshot
+		World  worldSnapshot
+	}
+	if err := json.Unmarshal(data, &saved); err != nil {
+		t.Fatalf("Failed to decode snapshot: %v", err)
+	}
+	
+	restored := NewGame()
+	restored.restoreWorld(saved.World)
+	if len(restored.rooms["tavern"].items) != 0 {
+		t.Error("Expected the mug to stay gone from the tavern")
+	}
+	if monster := restored.rooms["forest"].monsters[0]; monster.health != 4 {
+		t.Errorf("Expected monster health 4, got %d", monster.health)
+	}
+	
+	loaded := createTestPlayer("")
+	saved.Player.restore(loaded, nil)
+	if saved.Player.Room != "tavern" {
+		t.Errorf("Expected room tavern, got %q", saved.Player.Room)
+	}
+	if loaded.name != "Keeper" || loaded.health != 17 || loaded.maxHealth != 40 || loaded.damage != 9 || loaded.width != 100 {
+		t.Errorf("Stats not restored: %+v", loaded)
+	}
+	if len(loaded.inventory) != 1 || loaded.inventory[0].name != "wooden mug" {
+		t.Errorf("Expected inventory [wooden mug], got %v", loaded.inventory)
+	}
+	if loaded.weapon == nil || loaded.weapon.name != "rusty sword" || loaded.weapon.damage != 3 {
+		t.Errorf("Expected rusty sword equipped, got %v", loaded.weapon)
+	}
+	if loaded.armor != nil {
+		t.Errorf("Expected no armor, got %v", loaded.armor)
+	}
+}
+
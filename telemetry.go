@@ -3,13 +3,13 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"sync"
 	"time"
 )
 
 type TelemetryData struct {
-	mu                    sync.RWMutex
 	StartTime             time.Time            `json:"start_time"`
 	TotalConnections      int64                `json:"total_connections"`
 	ActiveConnections     int64                `json:"active_connections"`
@@ -18,12 +18,17 @@ type TelemetryData struct {
 	CombatActions         int64                `json:"combat_actions"`
 	MonsterKills          int64                `json:"monster_kills"`
 	PlayerDeaths          int64                `json:"player_deaths"`
+	SlowClientEvictions   int64                `json:"slow_client_evictions"`
+	CompressedBytesIn     int64                `json:"compressed_bytes_in"`
+	CompressedBytesOut    int64                `json:"compressed_bytes_out"`
+	CompressionRatio      float64              `json:"compression_ratio"`
 	RoomVisits            map[string]int64     `json:"room_visits"`
 	CommandCounts         map[string]int64     `json:"command_counts"`
 	LastUpdate            time.Time            `json:"last_update"`
 }
 
 type Telemetry struct {
+	mu     sync.RWMutex
 	data   *TelemetryData
 	logger *log.Logger
 }
@@ -41,16 +46,16 @@ func NewTelemetry() *Telemetry {
 }
 
 func (t *Telemetry) IncrementConnections() {
-	t.data.mu.Lock()
-	defer t.data.mu.Unlock()
+	t.mu.Lock()
+	defer t.mu.Unlock()
 	t.data.TotalConnections++
 	t.data.ActiveConnections++
 	t.data.LastUpdate = time.Now()
 }
 
 func (t *Telemetry) DecrementActiveConnections() {
-	t.data.mu.Lock()
-	defer t.data.mu.Unlock()
+	t.mu.Lock()
+	defer t.mu.Unlock()
 	if t.data.ActiveConnections > 0 {
 		t.data.ActiveConnections--
 	}
@@ -58,64 +63,88 @@ func (t *Telemetry) DecrementActiveConnections() {
 }
 
 func (t *Telemetry) IncrementPlayersCreated() {
-	t.data.mu.Lock()
-	defer t.data.mu.Unlock()
+	t.mu.Lock()
+	defer t.mu.Unlock()
 	t.data.PlayersCreated++
 	t.data.LastUpdate = time.Now()
 }
 
 func (t *Telemetry) IncrementCommandsExecuted(command string) {
-	t.data.mu.Lock()
-	defer t.data.mu.Unlock()
+	t.mu.Lock()
+	defer t.mu.Unlock()
 	t.data.CommandsExecuted++
 	t.data.CommandCounts[command]++
 	t.data.LastUpdate = time.Now()
 }
 
 func (t *Telemetry) IncrementCombatActions() {
-	t.data.mu.Lock()
-	defer t.data.mu.Unlock()
+	t.mu.Lock()
+	defer t.mu.Unlock()
 	t.data.CombatActions++
 	t.data.LastUpdate = time.Now()
 }
 
 func (t *Telemetry) IncrementMonsterKills() {
-	t.data.mu.Lock()
-	defer t.data.mu.Unlock()
+	t.mu.Lock()
+	defer t.mu.Unlock()
 	t.data.MonsterKills++
 	t.data.LastUpdate = time.Now()
 }
 
 func (t *Telemetry) IncrementPlayerDeaths() {
-	t.data.mu.Lock()
-	defer t.data.mu.Unlock()
+	t.mu.Lock()
+	defer t.mu.Unlock()
 	t.data.PlayerDeaths++
 	t.data.LastUpdate = time.Now()
 }
 
+func (t *Telemetry) IncrementSlowClientEvictions() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.data.SlowClientEvictions++
+	t.data.LastUpdate = time.Now()
+}
+
+// RecordCompression counts MCCP2 traffic: bytes before and after
+// compression.
+func (t *Telemetry) RecordCompression(uncompressed, compressed int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.data.CompressedBytesIn += int64(uncompressed)
+	t.data.CompressedBytesOut += int64(compressed)
+	t.data.LastUpdate = time.Now()
+}
+
 func (t *Telemetry) RecordRoomVisit(roomName string) {
-	t.data.mu.Lock()
-	defer t.data.mu.Unlock()
+	t.mu.Lock()
+	defer t.mu.Unlock()
 	t.data.RoomVisits[roomName]++
 	t.data.LastUpdate = time.Now()
 }
 
 func (t *Telemetry) GetSnapshot() TelemetryData {
-	t.data.mu.RLock()
-	defer t.data.mu.RUnlock()
+	t.mu.RLock()
+	defer t.mu.RUnlock()
 	
 	snapshot := TelemetryData{
-		StartTime:         t.data.StartTime,
-		TotalConnections:  t.data.TotalConnections,
-		ActiveConnections: t.data.ActiveConnections,
-		PlayersCreated:    t.data.PlayersCreated,
-		CommandsExecuted:  t.data.CommandsExecuted,
-		CombatActions:     t.data.CombatActions,
-		MonsterKills:      t.data.MonsterKills,
-		PlayerDeaths:      t.data.PlayerDeaths,
-		RoomVisits:        make(map[string]int64),
-		CommandCounts:     make(map[string]int64),
-		LastUpdate:        t.data.LastUpdate,
+		StartTime:           t.data.StartTime,
+		TotalConnections:    t.data.TotalConnections,
+		ActiveConnections:   t.data.ActiveConnections,
+		PlayersCreated:      t.data.PlayersCreated,
+		CommandsExecuted:    t.data.CommandsExecuted,
+		CombatActions:       t.data.CombatActions,
+		MonsterKills:        t.data.MonsterKills,
+		PlayerDeaths:        t.data.PlayerDeaths,
+		SlowClientEvictions: t.data.SlowClientEvictions,
+		CompressedBytesIn:   t.data.CompressedBytesIn,
+		CompressedBytesOut:  t.data.CompressedBytesOut,
+		RoomVisits:          make(map[string]int64),
+		CommandCounts:       make(map[string]int64),
+		LastUpdate:          t.data.LastUpdate,
+	}
+	
+	if snapshot.CompressedBytesIn > 0 {
+		snapshot.CompressionRatio = float64(snapshot.CompressedBytesOut) / float64(snapshot.CompressedBytesIn)
 	}
 	
 	for k, v := range t.data.RoomVisits {
@@ -147,6 +176,11 @@ func (t *Telemetry) LogStats() {
 	t.logger.Printf("Combat Actions: %d", snapshot.CombatActions)
 	t.logger.Printf("Monster Kills: %d", snapshot.MonsterKills)
 	t.logger.Printf("Player Deaths: %d", snapshot.PlayerDeaths)
+	t.logger.Printf("Slow Client Evictions: %d", snapshot.SlowClientEvictions)
+	if snapshot.CompressedBytesIn > 0 {
+		t.logger.Printf("MCCP2 Compression: %d -> %d bytes (ratio %.2f)",
+			snapshot.CompressedBytesIn, snapshot.CompressedBytesOut, snapshot.CompressionRatio)
+	}
 	
 	if len(snapshot.RoomVisits) > 0 {
 		t.logger.Printf("Most Popular Rooms:")
@@ -168,6 +202,34 @@ func (t *Telemetry) LogStats() {
 	t.logger.Printf("============================")
 }
 
+// SetOutput redirects telemetry reports, for example to the server log file.
+func (t *Telemetry) SetOutput(w io.Writer) {
+	t.logger.SetOutput(w)
+}
+
+// WriteFile saves the statistics as JSON, replacing the file atomically so
+// tools reading it never see half a file.
+func (t *Telemetry) WriteFile(path string) error {
+	data, err := t.GetJSON()
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data)
+}
+
+// StartPeriodicDump keeps a JSON copy of the statistics up to date, for
+// tools like the map's visit heat.
+func (t *Telemetry) StartPeriodicDump(path string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		for range ticker.C {
+			if err := t.WriteFile(path); err != nil {
+				t.logger.Printf("Failed to write telemetry dump: %v", err)
+			}
+		}
+	}()
+}
+
 func (t *Telemetry) StartPeriodicLogging(interval time.Duration) {
 	ticker := time.NewTicker(interval)
 	go func() {
@@ -0,0 +1,599 @@
+package main
+
+import (
+	"bufio"
+	"compress/zlib"
+	"io"
+	"net"
+	"sync"
+)
+
+// Telnet commands (RFC 854).
+const (
+	telnetSE   = 240
+	telnetSB   = 250
+	telnetWILL = 251
+	telnetWONT = 252
+	telnetDO   = 253
+	telnetDONT = 254
+	telnetIAC  = 255
+)
+
+// Telnet options we know how to negotiate.
+const (
+	TelnetOptionEcho  = 1
+	TelnetOptionSGA   = 3
+	TelnetOptionNAWS  = 31
+	TelnetOptionMCCP2 = 86
+	TelnetOptionGMCP  = 201
+)
+
+// telnetLocalOptions are the options the server agrees to perform when a
+// client sends DO. telnetRemoteOptions are the options the server accepts
+// when a client sends WILL. ECHO is not among them: the server never echoes
+// input, and only offers ECHO itself to hide passwords (see EchoOff).
+var (
+	telnetLocalOptions = map[byte]bool{
+		TelnetOptionSGA:   true,
+		TelnetOptionMCCP2: true,
+		TelnetOptionGMCP:  true,
+	}
+	telnetRemoteOptions = map[byte]bool{
+		TelnetOptionSGA:  true,
+		TelnetOptionNAWS: true,
+	}
+)
+
+var telnetOptionNames = map[byte]string{
+	TelnetOptionEcho:  "ECHO",
+	TelnetOptionSGA:   "SGA",
+	TelnetOptionNAWS:  "NAWS",
+	TelnetOptionMCCP2: "MCCP2",
+	TelnetOptionGMCP:  "GMCP",
+}
+
+// Maximum subnegotiation payload we buffer before discarding the rest.
+const telnetMaxSubnegotiation = 8192
+
+const (
+	telnetStateData = iota
+	telnetStateIAC
+	telnetStateOption
+	telnetStateSBOption
+	telnetStateSBData
+	telnetStateSBIAC
+)
+
+// telnetOption tracks one option on each side of the connection. Pending
+// marks a request we sent that the client has not answered yet, so that the
+// answer is not treated as a new request (RFC 1143).
+type telnetOption struct {
+	local         bool
+	remote        bool
+	localPending  bool
+	remotePending bool
+}
+
+// TelnetConn wraps a connection with the telnet protocol. Reads return the
+// data stream with IAC sequences removed and answered; writes escape IAC
+// bytes in the data.
+type TelnetConn struct {
+	net.Conn
+	reader *bufio.Reader
+	
+	// Parser state, only touched by the reading goroutine.
+	state    int
+	verb     byte
+	sbOption byte
+	sbData   []byte
+	lastCR   bool
+	handlers map[byte]func(data []byte)
+	
+	// writeMu serialises writes and guards the output stream. It is held
+	// for as long as a write blocks.
+	writeMu    sync.Mutex
+	writer     io.Writer
+	compressor *compressWriter
+	
+	// mu guards the negotiated state. It is never held during I/O, so the
+	// game loop can look at a connection whose client has stopped reading.
+	// Where both are needed, writeMu is taken first.
+	mu          sync.Mutex
+	options     map[byte]*telnetOption
+	compressing bool
+	width       int
+	height      int
+}
+
+func NewTelnetConn(conn net.Conn) *TelnetConn {
+	return &TelnetConn{
+		Conn:     conn,
+		reader:   bufio.NewReader(conn),
+		writer:   conn,
+		options:  make(map[byte]*telnetOption),
+		handlers: make(map[byte]func(data []byte)),
+	}
+}
+
+// Handle registers fn to receive subnegotiation payloads for an option. It
+// is called on the reading goroutine and must be set up before reading.
+func (t *TelnetConn) Handle(opt byte, fn func(data []byte)) {
+	t.handlers[opt] = fn
+}
+
+// Negotiate sends the options the server would like the client to enable.
+// Clients that do not speak telnet ignore them.
+func (t *TelnetConn) Negotiate() {
+	t.requestRemote(TelnetOptionNAWS, true)
+	t.requestLocal(TelnetOptionGMCP, true)
+	t.requestLocal(TelnetOptionMCCP2, true)
+}
+
+// Read returns data bytes from the client, handling any telnet commands
+// embedded in the stream.
+func (t *TelnetConn) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		if n > 0 && t.reader.Buffered() == 0 {
+			break
+		}
+		b, err := t.reader.ReadByte()
+		if err != nil {
+			if n > 0 {
+				return n, nil
+			}
+			return 0, err
+		}
+		if c, ok := t.receive(b); ok {
+			p[n] = c
+			n++
+		}
+	}
+	return n, nil
+}
+
+// receive feeds one byte through the protocol parser and reports whether it
+// is a data byte.
+func (t *TelnetConn) receive(b byte) (byte, bool) {
+	switch t.state {
+	case telnetStateData:
+		if b == telnetIAC {
+			t.state = telnetStateIAC
+			return 0, false
+		}
+		// CR NUL is a bare carriage return.
+		if t.lastCR && b == 0 {
+			t.lastCR = false
+			return 0, false
+		}
+		t.lastCR = b == '\r'
+		return b, true
+		
+	case telnetStateIAC:
+		switch b {
+		case telnetIAC:
+			t.state = telnetStateData
+			return telnetIAC, true
+		case telnetWILL, telnetWONT, telnetDO, telnetDONT:
+			t.verb = b
+			t.state = telnetStateOption
+		case telnetSB:
+			t.state = telnetStateSBOption
+		default:
+			t.state = telnetStateData
+		}
+		
+	case telnetStateOption:
+		t.negotiate(t.verb, b)
+		t.state = telnetStateData
+		
+	case telnetStateSBOption:
+		t.sbOption = b
+		t.sbData = t.sbData[:0]
+		t.state = telnetStateSBData
+		
+	case telnetStateSBData:
+		if b == telnetIAC {
+			t.state = telnetStateSBIAC
+		} else if len(t.sbData) < telnetMaxSubnegotiation {
+			t.sbData = append(t.sbData, b)
+		}
+		
+	case telnetStateSBIAC:
+		switch b {
+		case telnetSE:
+			t.subnegotiation(t.sbOption, t.sbData)
+			t.state = telnetStateData
+		case telnetIAC:
+			if len(t.sbData) < telnetMaxSubnegotiation {
+				t.sbData = append(t.sbData, telnetIAC)
+			}
+			t.state = telnetStateSBData
+		default:
+			t.state = telnetStateSBData
+		}
+	}
+	return 0, false
+}
+
+// option returns the state of an option. The caller must hold t.mu.
+func (t *TelnetConn) option(opt byte) *telnetOption {
+	state, ok := t.options[opt]
+	if !ok {
+		state = &telnetOption{}
+		t.options[opt] = state
+	}
+	return state
+}
+
+// negotiate handles a WILL, WONT, DO or DONT from the client.
+func (t *TelnetConn) negotiate(verb, opt byte) {
+	t.writeMu.Lock()
+	defer t.writeMu.Unlock()
+	
+	reply, local := t.answer(verb, opt)
+	if reply != 0 {
+		t.sendCommand(reply, opt)
+	}
+	if opt == TelnetOptionMCCP2 {
+		if local {
+			t.startCompression()
+		} else {
+			t.stopCompression()
+		}
+	}
+}
+
+// answer updates an option for a WILL, WONT, DO or DONT from the client.
+// It returns the verb to reply with, or 0 for none, and whether the
+// server side of the option is now active.
+func (t *TelnetConn) answer(verb, opt byte) (reply byte, local bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	
+	state := t.option(opt)
+	switch verb {
+	case telnetDO:
+		if state.localPending {
+			state.localPending = false
+			state.local = true
+		} else if !state.local {
+			if !telnetLocalOptions[opt] {
+				return telnetWONT, false
+			}
+			state.local = true
+			reply = telnetWILL
+		}
+		
+	case telnetDONT:
+		if state.localPending {
+			state.localPending = false
+			state.local = false
+		} else if state.local {
+			state.local = false
+			reply = telnetWONT
+		}
+		
+	case telnetWILL:
+		if state.remotePending {
+			state.remotePending = false
+			state.remote = true
+		} else if !state.remote {
+			if !telnetRemoteOptions[opt] {
+				return telnetDONT, state.local
+			}
+			state.remote = true
+			reply = telnetDO
+		}
+		
+	case telnetWONT:
+		if state.remotePending {
+			state.remotePending = false
+			state.remote = false
+		} else if state.remote {
+			state.remote = false
+			reply = telnetDONT
+		}
+	}
+	return reply, state.local
+}
+
+// startCompression begins the MCCP2 compressed stream. Everything the server
+// sends after IAC SB MCCP2 IAC SE is zlib compressed. The caller must hold
+// t.writeMu.
+func (t *TelnetConn) startCompression() {
+	if t.compressor != nil {
+		return
+	}
+	if _, err := t.writer.Write([]byte{telnetIAC, telnetSB, TelnetOptionMCCP2, telnetIAC, telnetSE}); err != nil {
+		return
+	}
+	t.compressor = newCompressWriter(t.Conn)
+	t.writer = t.compressor
+	t.setCompressing(true)
+}
+
+// stopCompression ends the compressed stream and goes back to sending plain
+// data. The caller must hold t.writeMu.
+func (t *TelnetConn) stopCompression() {
+	if t.compressor == nil {
+		return
+	}
+	t.compressor.Close()
+	t.compressor = nil
+	t.writer = t.Conn
+	t.setCompressing(false)
+}
+
+func (t *TelnetConn) setCompressing(on bool) {
+	t.mu.Lock()
+	t.compressing = on
+	t.mu.Unlock()
+}
+
+// Compressing reports whether output is currently MCCP2 compressed.
+func (t *TelnetConn) Compressing() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.compressing
+}
+
+// compressWriter is the MCCP2 output stream. Each write is flushed so the
+// client sees it straight away, and the bytes saved are reported to
+// telemetry.
+type compressWriter struct {
+	zlib *zlib.Writer
+	out  *countingWriter
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += n
+	return n, err
+}
+
+func newCompressWriter(w io.Writer) *compressWriter {
+	out := &countingWriter{w: w}
+	return &compressWriter{zlib: zlib.NewWriter(out), out: out}
+}
+
+func (c *compressWriter) Write(p []byte) (int, error) {
+	if _, err := c.zlib.Write(p); err != nil {
+		return 0, err
+	}
+	err := c.zlib.Flush()
+	GlobalTelemetry.RecordCompression(len(p), c.out.n)
+	c.out.n = 0
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (c *compressWriter) Close() error {
+	return c.zlib.Close()
+}
+
+// subnegotiation handles a complete IAC SB <option> ... IAC SE sequence.
+func (t *TelnetConn) subnegotiation(opt byte, data []byte) {
+	switch opt {
+	case TelnetOptionNAWS:
+		if len(data) != 4 {
+			return
+		}
+		t.mu.Lock()
+		t.width = int(data[0])<<8 | int(data[1])
+		t.height = int(data[2])<<8 | int(data[3])
+		t.mu.Unlock()
+	default:
+		if handler, ok := t.handlers[opt]; ok {
+			handler(append([]byte(nil), data...))
+		}
+	}
+}
+
+// requestLocal asks the client to let us enable or disable an option on our
+// side. It is a no-op if the option is already in that state.
+func (t *TelnetConn) requestLocal(opt byte, enable bool) {
+	t.writeMu.Lock()
+	defer t.writeMu.Unlock()
+	
+	t.mu.Lock()
+	state := t.option(opt)
+	if state.local == enable && !state.localPending {
+		t.mu.Unlock()
+		return
+	}
+	state.localPending = true
+	verb := byte(telnetWILL)
+	if !enable {
+		state.local = false
+		verb = telnetWONT
+	}
+	t.mu.Unlock()
+	t.sendCommand(verb, opt)
+}
+
+// requestRemote asks the client to enable or disable an option on its side.
+func (t *TelnetConn) requestRemote(opt byte, enable bool) {
+	t.writeMu.Lock()
+	defer t.writeMu.Unlock()
+	
+	t.mu.Lock()
+	state := t.option(opt)
+	if state.remote == enable && !state.remotePending {
+		t.mu.Unlock()
+		return
+	}
+	state.remotePending = true
+	verb := byte(telnetDO)
+	if !enable {
+		state.remote = false
+		verb = telnetDONT
+	}
+	t.mu.Unlock()
+	t.sendCommand(verb, opt)
+}
+
+// sendCommand writes IAC <verb> <opt>. The caller must hold t.writeMu.
+func (t *TelnetConn) sendCommand(verb, opt byte) {
+	t.writer.Write([]byte{telnetIAC, verb, opt})
+}
+
+// Write sends data to the client, doubling any IAC bytes.
+func (t *TelnetConn) Write(p []byte) (int, error) {
+	t.writeMu.Lock()
+	defer t.writeMu.Unlock()
+	
+	if _, err := t.writer.Write(telnetEscape(p)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Subnegotiate sends IAC SB <opt> <data> IAC SE.
+func (t *TelnetConn) Subnegotiate(opt byte, data []byte) error {
+	t.writeMu.Lock()
+	defer t.writeMu.Unlock()
+	
+	frame := make([]byte, 0, len(data)+5)
+	frame = append(frame, telnetIAC, telnetSB, opt)
+	frame = append(frame, telnetEscape(data)...)
+	frame = append(frame, telnetIAC, telnetSE)
+	_, err := t.writer.Write(frame)
+	return err
+}
+
+// telnetEscape doubles IAC bytes so they are read as data.
+func telnetEscape(p []byte) []byte {
+	for i, b := range p {
+		if b == telnetIAC {
+			escaped := make([]byte, 0, len(p)+1)
+			escaped = append(escaped, p[:i]...)
+			for _, b := range p[i:] {
+				if b == telnetIAC {
+					escaped = append(escaped, telnetIAC)
+				}
+				escaped = append(escaped, b)
+			}
+			return escaped
+		}
+	}
+	return p
+}
+
+// LocalEnabled reports whether the server side of an option is active.
+func (t *TelnetConn) LocalEnabled(opt byte) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	state, ok := t.options[opt]
+	return ok && state.local
+}
+
+// RemoteEnabled reports whether the client side of an option is active.
+func (t *TelnetConn) RemoteEnabled(opt byte) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	state, ok := t.options[opt]
+	return ok && state.remote
+}
+
+// WindowSize returns the terminal size reported through NAWS, or zeros if
+// the client has not sent one.
+func (t *TelnetConn) WindowSize() (width, height int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.width, t.height
+}
+
+// Options lists the names of the options currently enabled on either side.
+func (t *TelnetConn) Options() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	
+	var names []string
+	for opt := 0; opt < 256; opt++ {
+		state, ok := t.options[byte(opt)]
+		if !ok || !(state.local || state.remote) {
+			continue
+		}
+		name, known := telnetOptionNames[byte(opt)]
+		if !known {
+			continue
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// EchoOff tells the client the server will handle echo, so its local echo
+// stops. Used while reading passwords.
+func (t *TelnetConn) EchoOff() {
+	t.requestLocal(TelnetOptionEcho, true)
+}
+
+// EchoOn hands echo back to the client.
+func (t *TelnetConn) EchoOn() {
+	t.requestLocal(TelnetOptionEcho, false)
+}
+
+// telnetState is the negotiated state of a connection, carried across a
+// copyover so the new process does not have to negotiate again.
+type telnetState struct {
+	Local  []int `json:"local"`
+	Remote []int `json:"remote"`
+	Width  int   `json:"width,omitempty"`
+	Height int   `json:"height,omitempty"`
+}
+
+// suspend ends any compressed stream, so the client is reading plain telnet
+// again, and returns the negotiated options.
+func (t *TelnetConn) suspend() telnetState {
+	t.writeMu.Lock()
+	defer t.writeMu.Unlock()
+	t.stopCompression()
+	
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	state := telnetState{Width: t.width, Height: t.height}
+	for opt := 0; opt < 256; opt++ {
+		option, ok := t.options[byte(opt)]
+		if !ok {
+			continue
+		}
+		if option.local {
+			state.Local = append(state.Local, opt)
+		}
+		if option.remote {
+			state.Remote = append(state.Remote, opt)
+		}
+	}
+	return state
+}
+
+// resume takes on options negotiated before a copyover, restarting MCCP2 if
+// it was in use.
+func (t *TelnetConn) resume(state telnetState) {
+	t.writeMu.Lock()
+	defer t.writeMu.Unlock()
+	
+	t.mu.Lock()
+	for _, opt := range state.Local {
+		t.option(byte(opt)).local = true
+	}
+	for _, opt := range state.Remote {
+		t.option(byte(opt)).remote = true
+	}
+	t.width = state.Width
+	t.height = state.Height
+	compress := t.option(TelnetOptionMCCP2).local
+	t.mu.Unlock()
+	if compress {
+		t.startCompression()
+	}
+}
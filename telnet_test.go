@@ -0,0 +1,262 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// telnetPipe returns a TelnetConn for the server side and the raw client end.
+func telnetPipe(t *testing.T) (*TelnetConn, net.Conn) {
+	server, client := net.Pipe()
+	t.Cleanup(func() {
+		server.Close()
+		client.Close()
+	})
+	return NewTelnetConn(server), client
+}
+
+// readLine reads one line of data from the server side in the background.
+func readLine(conn net.Conn) <-chan string {
+	lines := make(chan string, 1)
+	go func() {
+		scanner := bufio.NewScanner(conn)
+		if scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		close(lines)
+	}()
+	return lines
+}
+
+func expectBytes(t *testing.T, conn net.Conn, expected []byte) {
+	t.Helper()
+	buf := make([]byte, len(expected))
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatalf("Failed to read %v: %v", expected, err)
+	}
+	if !bytes.Equal(buf, expected) {
+		t.Errorf("Expected %v, got %v", expected, buf)
+	}
+}
+
+func TestTelnetStripsNegotiation(t *testing.T) {
+	server, client := telnetPipe(t)
+	lines := readLine(server)
+	
+	go client.Write([]byte{
+		telnetIAC, telnetDO, TelnetOptionSGA,
+		'B', 'o', 'b',
+		telnetIAC, telnetSB, 24, 1, telnetIAC, telnetSE,
+		'\r', '\n',
+	})
+	
+	expectBytes(t, client, []byte{telnetIAC, telnetWILL, TelnetOptionSGA})
+	
+	if line := <-lines; line != "Bob" {
+		t.Errorf("Expected name 'Bob', got %q", line)
+	}
+	if !server.LocalEnabled(TelnetOptionSGA) {
+		t.Error("SGA should be enabled after DO SGA")
+	}
+}
+
+func TestTelnetRefusesUnknownOptions(t *testing.T) {
+	server, client := telnetPipe(t)
+	lines := readLine(server)
+	
+	go client.Write([]byte{
+		telnetIAC, telnetDO, 99,
+		telnetIAC, telnetWILL, 98,
+		telnetIAC, telnetDO, TelnetOptionEcho,
+		'x', '\n',
+	})
+	
+	expectBytes(t, client, []byte{telnetIAC, telnetWONT, 99})
+	expectBytes(t, client, []byte{telnetIAC, telnetDONT, 98})
+	expectBytes(t, client, []byte{telnetIAC, telnetWONT, TelnetOptionEcho})
+	<-lines
+	
+	if server.LocalEnabled(99) || server.RemoteEnabled(98) || server.LocalEnabled(TelnetOptionEcho) {
+		t.Error("Unknown options should not be enabled")
+	}
+}
+
+func TestTelnetEscapedIAC(t *testing.T) {
+	server, client := telnetPipe(t)
+	
+	go client.Write([]byte{'a', telnetIAC, telnetIAC, 'b'})
+	
+	buf := make([]byte, 3)
+	if _, err := io.ReadFull(server, buf); err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if !bytes.Equal(buf, []byte{'a', telnetIAC, 'b'}) {
+		t.Errorf("Expected escaped IAC to be unescaped, got %v", buf)
+	}
+	
+	go server.Write([]byte{'c', telnetIAC})
+	expectBytes(t, client, []byte{'c', telnetIAC, telnetIAC})
+}
+
+func TestTelnetEchoSuppression(t *testing.T) {
+	server, client := telnetPipe(t)
+	
+	go server.EchoOff()
+	expectBytes(t, client, []byte{telnetIAC, telnetWILL, TelnetOptionEcho})
+	
+	// The client's agreement must not be answered again.
+	lines := readLine(server)
+	go client.Write([]byte{telnetIAC, telnetDO, TelnetOptionEcho, 's', 'e', 'c', 'r', 'e', 't', '\n'})
+	if line := <-lines; line != "secret" {
+		t.Errorf("Expected password line, got %q", line)
+	}
+	if !server.LocalEnabled(TelnetOptionEcho) {
+		t.Error("Echo should be enabled on the server side after DO ECHO")
+	}
+	
+	go server.EchoOn()
+	expectBytes(t, client, []byte{telnetIAC, telnetWONT, TelnetOptionEcho})
+	if server.LocalEnabled(TelnetOptionEcho) {
+		t.Error("Echo should be handed back to the client")
+	}
+}
+
+func TestTelnetNAWS(t *testing.T) {
+	server, client := telnetPipe(t)
+	
+	go server.Negotiate()
+	expectBytes(t, client, []byte{telnetIAC, telnetDO, TelnetOptionNAWS})
+	expectBytes(t, client, []byte{telnetIAC, telnetWILL, TelnetOptionGMCP})
+	expectBytes(t, client, []byte{telnetIAC, telnetWILL, TelnetOptionMCCP2})
+	
+	lines := readLine(server)
+	go client.Write([]byte{
+		telnetIAC, telnetWILL, TelnetOptionNAWS,
+		telnetIAC, telnetSB, TelnetOptionNAWS, 0, 100, 0, 40, telnetIAC, telnetSE,
+		'\n',
+	})
+	<-lines
+	
+	width, height := server.WindowSize()
+	if width != 100 || height != 40 {
+		t.Errorf("Expected window size 100x40, got %dx%d", width, height)
+	}
+	
+	player := &Player{conn: server, telnet: server}
+	if player.lineWidth() != 100 {
+		t.Errorf("Expected line width to follow NAWS, got %d", player.lineWidth())
+	}
+}
+
+func TestTelnetMCCP2(t *testing.T) {
+	server, client := telnetPipe(t)
+	before := GlobalTelemetry.GetSnapshot()
+	
+	lines := readLine(server)
+	go client.Write([]byte{telnetIAC, telnetDO, TelnetOptionMCCP2, '\n'})
+	
+	expectBytes(t, client, []byte{telnetIAC, telnetWILL, TelnetOptionMCCP2})
+	expectBytes(t, client, []byte{telnetIAC, telnetSB, TelnetOptionMCCP2, telnetIAC, telnetSE})
+	<-lines
+	
+	if !server.Compressing() {
+		t.Fatal("Expected output to be compressed after DO MCCP2")
+	}
+	
+	message := strings.Repeat("The dragon roars! ", 20) + "\r\n"
+	written := make(chan struct{})
+	go func() {
+		server.Write([]byte(message))
+		close(written)
+	}()
+	
+	client.SetReadDeadline(time.Now().Add(time.Second))
+	reader, err := zlib.NewReader(client)
+	if err != nil {
+		t.Fatalf("Failed to start decompressing: %v", err)
+	}
+	line, err := bufio.NewReader(reader).ReadString('\n')
+	if err != nil {
+		t.Fatalf("Failed to read compressed line: %v", err)
+	}
+	if line != message {
+		t.Errorf("Expected %q, got %q", message, line)
+	}
+	
+	<-written
+	after := GlobalTelemetry.GetSnapshot()
+	in := after.CompressedBytesIn - before.CompressedBytesIn
+	out := after.CompressedBytesOut - before.CompressedBytesOut
+	if in != int64(len(message)) {
+		t.Errorf("Expected %d uncompressed bytes recorded, got %d", len(message), in)
+	}
+	if out <= 0 || out >= in {
+		t.Errorf("Expected repetitive text to compress, got %d -> %d bytes", in, out)
+	}
+}
+
+func TestTelnetSuspendResume(t *testing.T) {
+	server, client := telnetPipe(t)
+	go io.Copy(io.Discard, client)
+	
+	server.mu.Lock()
+	server.option(TelnetOptionMCCP2).local = true
+	server.option(TelnetOptionNAWS).remote = true
+	server.width = 120
+	server.mu.Unlock()
+	server.writeMu.Lock()
+	server.startCompression()
+	server.writeMu.Unlock()
+	
+	state := server.suspend()
+	if server.Compressing() {
+		t.Error("Expected compression to stop when suspended")
+	}
+	if state.Width != 120 || len(state.Local) != 1 || len(state.Remote) != 1 {
+		t.Errorf("Unexpected suspended state %+v", state)
+	}
+	
+	fresh := NewTelnetConn(server.Conn)
+	fresh.resume(state)
+	if !fresh.Compressing() {
+		t.Error("Expected compression to restart on resume")
+	}
+	if !fresh.RemoteEnabled(TelnetOptionNAWS) || !fresh.LocalEnabled(TelnetOptionMCCP2) {
+		t.Errorf("Expected options restored, got %v", fresh.Options())
+	}
+	if width, _ := fresh.WindowSize(); width != 120 {
+		t.Errorf("Expected width 120, got %d", width)
+	}
+}
+
+func TestTelnetStalledWriterDoesNotBlockState(t *testing.T) {
+	server, _ := telnetPipe(t)
+	server.mu.Lock()
+	server.option(TelnetOptionNAWS).remote = true
+	server.width = 100
+	server.mu.Unlock()
+	
+	// Nothing reads from the client side, so the first write never finishes.
+	player := NewPlayer(server, "Stalled")
+	player.startOutput()
+	player.SendMessage("This write blocks.")
+	time.Sleep(50 * time.Millisecond)
+	
+	done := make(chan struct{})
+	go func() {
+		player.SendMessage("This one only needs the window size.")
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("SendMessage blocked behind a stalled write")
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"time"
+)
+
+// selfSignedValidity is how long a generated development certificate lasts.
+const selfSignedValidity = 365 * 24 * time.Hour
+
+// loadTLSConfig builds the TLS listener's configuration. With selfSigned
+// set, a missing certificate is generated: written to certFile and keyFile
+// if they are given, otherwise kept only in memory for this run.
+func loadTLSConfig(certFile, keyFile string, selfSigned bool) (*tls.Config, error) {
+	var cert tls.Certificate
+	var err error
+	
+	switch {
+	case certFile == "" && keyFile == "":
+		if !selfSigned {
+			return nil, errors.New("TLS needs a certificate and key (or self-signed mode)")
+		}
+		cert, err = generateSelfSignedCert("localhost")
+	case certFile == "" || keyFile == "":
+		return nil, errors.New("TLS certificate and key must be given together")
+	default:
+		if selfSigned && !fileExists(certFile) && !fileExists(keyFile) {
+			if err := writeSelfSignedCert(certFile, keyFile, "localhost"); err != nil {
+				return nil, err
+			}
+		}
+		cert, err = tls.LoadX509KeyPair(certFile, keyFile)
+	}
+	if err != nil {
+		return nil, err
+	}
+	
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// generateSelfSignedCert creates a certificate for development use. Clients
+// will warn that it is untrusted.
+func generateSelfSignedCert(hosts ...string) (tls.Certificate, error) {
+	certPEM, keyPEM, err := selfSignedPEM(hosts)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.X509KeyPair(certPEM, keyPEM)
+}
+
+// writeSelfSignedCert generates a certificate and saves it as PEM files.
+func writeSelfSignedCert(certFile, keyFile string, hosts ...string) error {
+	certPEM, keyPEM, err := selfSignedPEM(hosts)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(certFile, certPEM, 0644); err != nil {
+		return fmt.Errorf("writing certificate: %w", err)
+	}
+	if err := os.WriteFile(keyFile, keyPEM, 0600); err != nil {
+		return fmt.Errorf("writing key: %w", err)
+	}
+	return nil
+}
+
+func selfSignedPEM(hosts []string) ([]byte, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+	
+	now := time.Now()
+	template := x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"MUD development"}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(selfSignedValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+	template.IPAddresses = append(template.IPAddresses, net.IPv4(127, 0, 0, 1), net.IPv6loopback)
+	
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return certPEM, keyPEM, nil
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSelfSignedCertFiles(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	
+	if _, err := loadTLSConfig(certFile, keyFile, false); err == nil {
+		t.Error("Expected an error loading missing certificate files")
+	}
+	
+	config, err := loadTLSConfig(certFile, keyFile, true)
+	if err != nil {
+		t.Fatalf("Failed to generate certificate: %v", err)
+	}
+	if len(config.Certificates) != 1 {
+		t.Fatalf("Expected one certificate, got %d", len(config.Certificates))
+	}
+	if !fileExists(certFile) || !fileExists(keyFile) {
+		t.Error("Expected certificate and key files to be written")
+	}
+	
+	// A second load reuses the files rather than generating new ones.
+	if _, err := loadTLSConfig(certFile, keyFile, false); err != nil {
+		t.Errorf("Failed to load generated files: %v", err)
+	}
+	
+	if _, err := loadTLSConfig(certFile, "", true); err == nil {
+		t.Error("Expected an error for a certificate without a key")
+	}
+}
+
+func TestTLSConnection(t *testing.T) {
+	config, err := loadTLSConfig("", "", true)
+	if err != nil {
+		t.Fatalf("Failed to create TLS config: %v", err)
+	}
+	
+	game := newTestGame(t, testConfig(t))
+	game.Start()
+	defer game.Stop()
+	
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", config)
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+	go serve(listener, game)
+	
+	conn, err := tls.Dial("tcp", listener.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	
+	reader := bufio.NewReader(conn)
+	if !readUntilText(reader, "What is your name?") {
+		t.Fatal("Expected name prompt over TLS")
+	}
+	conn.Write([]byte("Secure\r\n"))
+	readUntilText(reader, "Choose a password:")
+	conn.Write([]byte("hushhush\r\n"))
+	readUntilText(reader, "Confirm password:")
+	conn.Write([]byte("hushhush\r\n"))
+	if !readUntilText(reader, "Hello, ") {
+		t.Error("Expected greeting over TLS")
+	}
+}
+
+// readUntilText reads until want appears, ignoring telnet negotiation bytes.
+func readUntilText(reader *bufio.Reader, want string) bool {
+	var seen strings.Builder
+	for !strings.Contains(seen.String(), want) {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return false
+		}
+		seen.WriteByte(b)
+	}
+	return true
+}
+
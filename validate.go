@@ -0,0 +1,253 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// balanceFactor is how far a monster's health or damage may stray from the
+// median of its level before the validator calls it unbalanced.
+const balanceFactor = 3
+
+// minBalanceSample is the fewest monsters a level needs before its median
+// means anything.
+const minBalanceSample = 3
+
+// problem is something the validator found wrong with a world. Warnings
+// are things that may be intended, like a trapdoor with no way back.
+type problem struct {
+	pos     filePos
+	warning bool
+	message string
+}
+
+func (p problem) String() string {
+	kind := ""
+	if p.warning {
+		kind = "warning: "
+	}
+	if p.pos.file == "" {
+		return kind + p.message
+	}
+	return fmt.Sprintf("%s: %s%s", p.pos, kind, p.message)
+}
+
+var reverseDirections = map[string]string{
+	"north": "south",
+	"south": "north",
+	"east":  "west",
+	"west":  "east",
+	"up":    "down",
+	"down":  "up",
+}
+
+// validateCommand runs "mud validate": it checks a directory of area files
+// (the built-in world if none is given) and reports what is wrong with it.
+// The result is the process exit status: 1 if there were errors, or
+// warnings with -strict.
+func validateCommand(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("validate", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	start := fs.String("start", DefaultConfig().Player.StartRoom, "room players start in; every room must be reachable from it")
+	strict := fs.Bool("strict", false, "fail on warnings as well as errors")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: mud validate [-start room] [-strict] [worlddir]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() > 1 {
+		fs.Usage()
+		return 2
+	}
+	
+	fsys, dir := worldFS(fs.Arg(0))
+	world, errs := readWorldData(fsys, dir)
+	for _, err := range errs {
+		fmt.Fprintln(stdout, err)
+	}
+	if world == nil {
+		return 1
+	}
+	
+	problems := checkWorld(world, *start)
+	warnings := 0
+	for _, p := range problems {
+		fmt.Fprintln(stdout, p)
+		if p.warning {
+			warnings++
+		}
+	}
+	failed := len(errs) + len(problems) - warnings
+	
+	fmt.Fprintf(stdout, "%s: %s, %s, %s, %s\n", dir,
+		pluralize(len(world.rooms), "room"), pluralize(len(world.monsters), "monster"),
+		pluralize(failed, "error"), pluralize(warnings, "warning"))
+	if failed > 0 || *strict && warnings > 0 {
+		return 1
+	}
+	return 0
+}
+
+// checkWorld looks for problems that loading a world doesn't catch: rooms
+// players can't get to, exits with no way back and monsters far stronger
+// or weaker than others on their level.
+func checkWorld(world *worldData, start string) []problem {
+	var problems []problem
+	report := func(pos filePos, warning bool, format string, args ...any) {
+		problems = append(problems, problem{pos, warning, fmt.Sprintf(format, args...)})
+	}
+	
+	if world.rooms[start] == nil {
+		report(filePos{}, false, "start room %q is not defined", start)
+	} else {
+		levels := roomLevels(world, start)
+		for _, room := range world.sortedRooms() {
+			if _, ok := levels[room.id]; !ok {
+				report(room.pos, false, "room %s cannot be reached from %s", room.id, start)
+			}
+		}
+		checkBalance(world, levels, report)
+	}
+	
+	for _, room := range world.sortedRooms() {
+		for _, exit := range room.exits {
+			target := world.rooms[exit.target]
+			if target == nil {
+				continue
+			}
+			back := reverseDirections[exit.direction]
+			switch other := target.exit(back); {
+			case other == nil:
+				report(exit.pos, true, "one-way exit: %s leads %s to %s, which has no exit %s", room.id, exit.direction, target.id, back)
+			case other.target != room.id:
+				report(exit.pos, true, "one-way exit: %s leads %s to %s, whose exit %s leads to %s", room.id, exit.direction, target.id, back, other.target)
+			}
+		}
+	}
+	
+	sort.SliceStable(problems, func(i, j int) bool {
+		a, b := problems[i].pos, problems[j].pos
+		if a.file != b.file {
+			return a.file < b.file
+		}
+		return a.line < b.line
+	})
+	return problems
+}
+
+// checkBalance compares each monster's health and damage with the median
+// of the monsters on the same level.
+func checkBalance(world *worldData, levels map[string]int, report func(filePos, bool, string, ...any)) {
+	type spawn struct {
+		ref
+		monster *monsterProto
+	}
+	byLevel := make(map[int][]spawn)
+	for _, room := range world.sortedRooms() {
+		level, ok := levels[room.id]
+		if !ok {
+			continue
+		}
+		for _, s := range room.spawns {
+			if monster := world.monsters[s.id]; monster != nil {
+				byLevel[level] = append(byLevel[level], spawn{s, monster})
+			}
+		}
+	}
+	
+	for level, spawns := range byLevel {
+		if len(spawns) < minBalanceSample {
+			continue
+		}
+		var health, damage []int
+		for _, s := range spawns {
+			health = append(health, s.monster.health)
+			damage = append(damage, s.monster.damage)
+		}
+		medianHealth, medianDamage := median(health), median(damage)
+		for _, s := range spawns {
+			if why := imbalance("health", s.monster.health, medianHealth); why != "" {
+				report(s.pos, true, "unbalanced monster: %s on level %d has %s", s.monster.id, level, why)
+			}
+			if why := imbalance("damage", s.monster.damage, medianDamage); why != "" {
+				report(s.pos, true, "unbalanced monster: %s on level %d has %s", s.monster.id, level, why)
+			}
+		}
+	}
+}
+
+// imbalance describes how a stat is out of line with its median, or
+// returns "" if it isn't.
+func imbalance(stat string, value, median int) string {
+	switch {
+	case value > median*balanceFactor:
+		return fmt.Sprintf("%s %d, over %d times the level's median of %d", stat, value, balanceFactor, median)
+	case value*balanceFactor < median:
+		return fmt.Sprintf("%s %d, under 1/%d of the level's median of %d", stat, value, balanceFactor, median)
+	}
+	return ""
+}
+
+func median(values []int) int {
+	sorted := append([]int(nil), values...)
+	sort.Ints(sorted)
+	return sorted[len(sorted)/2]
+}
+
+// roomLevels finds the rooms reachable from start and the level each is
+// on: going up from a room leads one level higher, down one lower. A room
+// gets the level of the shortest route to it.
+func roomLevels(world *worldData, start string) map[string]int {
+	levels := map[string]int{start: 0}
+	queue := []string{start}
+	for len(queue) > 0 {
+		room := world.rooms[queue[0]]
+		queue = queue[1:]
+		for _, direction := range directions {
+			exit := room.exit(direction)
+			if exit == nil || world.rooms[exit.target] == nil {
+				continue
+			}
+			if _, seen := levels[exit.target]; seen {
+				continue
+			}
+			level := levels[room.id]
+			switch direction {
+			case "up":
+				level++
+			case "down":
+				level--
+			}
+			levels[exit.target] = level
+			queue = append(queue, exit.target)
+		}
+	}
+	return levels
+}
+
+// exit returns the room's exit in a direction, or nil.
+func (r *roomDef) exit(direction string) *exitDef {
+	for i := range r.exits {
+		if r.exits[i].direction == direction {
+			return &r.exits[i]
+		}
+	}
+	return nil
+}
+
+// sortedRooms returns the rooms in file order.
+func (w *worldData) sortedRooms() []*roomDef {
+	var rooms []*roomDef
+	for _, area := range w.areas {
+		for _, room := range area.rooms {
+			if w.rooms[room.id] == room {
+				rooms = append(rooms, room)
+			}
+		}
+	}
+	return rooms
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+const validateTestArea = `room gate
+  name Gate
+  exit north yard
+  exit down cellar
+  spawn rat
+  spawn rat
+
+room yard
+  name Yard
+  exit south gate
+  exit east shed
+  spawn dragon
+
+room shed
+  name Shed
+  spawn rat
+
+room cellar
+  name Cellar
+  exit up gate
+
+room attic
+  name Attic
+  exit down yard
+
+monster rat
+  name rat
+  health 10
+  damage 2
+
+monster dragon
+  name dragon
+  health 100
+  damage 3
+`
+
+func TestCheckWorld(t *testing.T) {
+	world, errs := readWorldData(fstest.MapFS{"keep.area": {Data: []byte(validateTestArea)}}, "w")
+	if len(errs) > 0 {
+		t.Fatalf("Unexpected load errors: %v", errs)
+	}
+	
+	var lines []string
+	for _, p := range checkWorld(world, "gate") {
+		lines = append(lines, p.String())
+	}
+	got := strings.Join(lines, "\n")
+	want := strings.Join([]string{
+		"w/keep.area:11: warning: one-way exit: yard leads east to shed, which has no exit west",
+		"w/keep.area:12: warning: unbalanced monster: dragon on level 0 has health 100, over 3 times the level's median of 10",
+		"w/keep.area:22: room attic cannot be reached from gate",
+		"w/keep.area:24: warning: one-way exit: attic leads down to yard, which has no exit up",
+	}, "\n")
+	if got != want {
+		t.Errorf("Unexpected problems:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestRoomLevels(t *testing.T) {
+	world, _ := loadWorldFiles("")
+	levels := roomLevels(world, "town_square")
+	if len(levels) != len(world.rooms) {
+		t.Errorf("Expected every room to be reachable, got %d of %d", len(levels), len(world.rooms))
+	}
+	for room, want := range map[string]int{"town_square": 0, "armory": 1, "dungeon": -1, "ice_fortress": 2} {
+		if levels[room] != want {
+			t.Errorf("Expected %s on level %d, got %d", room, want, levels[room])
+		}
+	}
+}
+
+func TestValidateCommand(t *testing.T) {
+	var out bytes.Buffer
+	if status := validateCommand(nil, &out, &out); status != 0 {
+		t.Errorf("Expected the built-in world to pass, got status %d:\n%s", status, out.String())
+	}
+	if !strings.Contains(out.String(), "world: 20 rooms") {
+		t.Errorf("Expected a summary, got:\n%s", out.String())
+	}
+	
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "keep.area"), []byte(validateTestArea), 0644)
+	out.Reset()
+	if status := validateCommand([]string{"-start", "gate", dir}, &out, &out); status != 1 {
+		t.Errorf("Expected an unreachable room to fail, got status %d", status)
+	}
+	if !strings.Contains(out.String(), "1 error, 3 warnings") {
+		t.Errorf("Unexpected summary:\n%s", out.String())
+	}
+	
+	os.WriteFile(filepath.Join(dir, "later.area"), []byte("room gate\n  name Again\n  spawn ghost\n"), 0644)
+	out.Reset()
+	validateCommand([]string{"-start", "gate", dir}, &out, &out)
+	for _, want := range []string{"later.area:1: room gate is already defined", `later.area:3: unknown monster "ghost"`} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Expected %q in:\n%s", want, out.String())
+		}
+	}
+	
+	if status := validateCommand([]string{"-strict"}, &out, &out); status != 1 {
+		t.Errorf("Expected warnings to fail with -strict, got status %d", status)
+	}
+	if status := validateCommand([]string{"a", "b"}, &out, &out); status != 2 {
+		t.Errorf("Expected a usage error, got status %d", status)
+	}
+}
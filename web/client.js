@@ -0,0 +1,157 @@
+// Browser client for the MUD. Server output arrives as text messages
+// containing ANSI colour codes, which are turned into styled spans.
+(function () {
+  "use strict";
+
+  var output = document.getElementById("output");
+  var form = document.getElementById("input-form");
+  var input = document.getElementById("input");
+  var history = [];
+  var historyIndex = 0;
+  var maxLines = 2000;
+
+  // Current SGR state, carried across messages like a terminal would.
+  var style = { bold: false, dim: false, underline: false, fg: null, bg: null };
+
+  function resetStyle() {
+    style = { bold: false, dim: false, underline: false, fg: null, bg: null };
+  }
+
+  function applySGR(params) {
+    var codes = params === "" ? [0] : params.split(";").map(Number);
+    codes.forEach(function (code) {
+      if (code === 0) {
+        resetStyle();
+      } else if (code === 1) {
+        style.bold = true;
+      } else if (code === 2) {
+        style.dim = true;
+      } else if (code === 4) {
+        style.underline = true;
+      } else if (code === 22) {
+        style.bold = false;
+        style.dim = false;
+      } else if (code === 24) {
+        style.underline = false;
+      } else if ((code >= 30 && code <= 37) || (code >= 90 && code <= 97)) {
+        style.fg = code;
+      } else if (code === 39) {
+        style.fg = null;
+      } else if (code >= 40 && code <= 47) {
+        style.bg = code;
+      } else if (code === 49) {
+        style.bg = null;
+      }
+    });
+  }
+
+  function classes() {
+    var list = [];
+    if (style.bold) list.push("bold");
+    if (style.dim) list.push("dim");
+    if (style.underline) list.push("underline");
+    if (style.fg !== null) list.push("fg-" + style.fg);
+    if (style.bg !== null) list.push("bg-" + style.bg);
+    return list.join(" ");
+  }
+
+  // Text is added with textContent, so server output can never inject HTML.
+  function appendText(parent, text) {
+    if (text === "") return;
+    var span = document.createElement("span");
+    var names = classes();
+    if (names) span.className = names;
+    span.textContent = text;
+    parent.appendChild(span);
+  }
+
+  // The server asks for password mode with OSC "mud;echo=off"/"on".
+  function handleControls(message) {
+    return message.replace(/\x1b\]mud;([^\x07]*)\x07/g, function (_, control) {
+      if (control === "echo=off") {
+        input.type = "password";
+      } else if (control === "echo=on") {
+        input.type = "text";
+      }
+      return "";
+    });
+  }
+
+  function render(message) {
+    var fragment = document.createDocumentFragment();
+    var text = handleControls(message).replace(/\r/g, "");
+    var pattern = /\x1b\[([0-9;]*)([A-Za-z])/g;
+    var last = 0;
+    var match;
+    while ((match = pattern.exec(text)) !== null) {
+      appendText(fragment, text.slice(last, match.index));
+      if (match[2] === "m") applySGR(match[1]);
+      last = pattern.lastIndex;
+    }
+    appendText(fragment, text.slice(last));
+    return fragment;
+  }
+
+  function atBottom() {
+    return output.scrollHeight - output.scrollTop - output.clientHeight < 4;
+  }
+
+  function append(node) {
+    var follow = atBottom();
+    output.appendChild(node);
+    while (output.childNodes.length > maxLines) {
+      output.removeChild(output.firstChild);
+    }
+    if (follow) output.scrollTop = output.scrollHeight;
+  }
+
+  function note(text, className) {
+    var span = document.createElement("span");
+    span.className = className;
+    span.textContent = text + "\n";
+    append(span);
+  }
+
+  var url = (location.protocol === "https:" ? "wss://" : "ws://") + location.host + "/ws";
+  var socket = new WebSocket(url);
+
+  socket.onmessage = function (event) {
+    append(render(event.data));
+  };
+  socket.onclose = function () {
+    note("Connection closed.", "system");
+    input.disabled = true;
+  };
+  socket.onerror = function () {
+    note("Could not connect to the server.", "system");
+  };
+
+  form.addEventListener("submit", function (event) {
+    event.preventDefault();
+    var line = input.value;
+    if (socket.readyState !== WebSocket.OPEN) return;
+    socket.send(line);
+    if (input.type !== "password") {
+      note(line, "echo");
+      if (line !== "") history.push(line);
+    }
+    historyIndex = history.length;
+    input.value = "";
+  });
+
+  input.addEventListener("keydown", function (event) {
+    if (event.key === "ArrowUp" && historyIndex > 0) {
+      historyIndex--;
+      input.value = history[historyIndex];
+      event.preventDefault();
+    } else if (event.key === "ArrowDown" && historyIndex < history.length) {
+      historyIndex++;
+      input.value = historyIndex < history.length ? history[historyIndex] : "";
+      event.preventDefault();
+    }
+  });
+
+  document.addEventListener("click", function () {
+    if (window.getSelection().toString() === "") input.focus();
+  });
+})();
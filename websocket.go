@@ -0,0 +1,329 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"embed"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/fs"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+//go:embed web
+var webFiles embed.FS
+
+// WebSocket opcodes (RFC 6455).
+const (
+	wsOpContinuation = 0x0
+	wsOpText         = 0x1
+	wsOpBinary       = 0x2
+	wsOpClose        = 0x8
+	wsOpPing         = 0x9
+	wsOpPong         = 0xa
+)
+
+const (
+	wsAcceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+	
+	// wsMaxMessage bounds a single message from the browser. Commands are
+	// short, so anything bigger is a misbehaving client.
+	wsMaxMessage = 64 * 1024
+	
+	// wsCloseTimeout bounds how long Close spends on the close frame. The
+	// frame is a courtesy, so a client that cannot take four bytes promptly
+	// goes without.
+	wsCloseTimeout = 200 * time.Millisecond
+)
+
+// The browser client has no telnet, so echo control for password prompts
+// travels in-band as OSC sequences it recognises.
+const (
+	wsEchoOff = "\x1b]mud;echo=off\x07"
+	wsEchoOn  = "\x1b]mud;echo=on\x07"
+)
+
+var errWebSocketClosed = errors.New("websocket closed")
+
+// NewWebHandler serves the bundled browser client and its WebSocket
+// endpoint, which joins the game the same way a telnet connection does.
+func NewWebHandler(game *Game) http.Handler {
+	static, err := fs.Sub(webFiles, "web")
+	if err != nil {
+		panic(err)
+	}
+	
+	mux := http.NewServeMux()
+	mux.Handle("/", http.FileServer(http.FS(static)))
+	mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgradeWebSocket(w, r)
+		if err != nil {
+			log.Printf("WebSocket upgrade from %s failed: %v", r.RemoteAddr, err)
+			return
+		}
+		runSession(conn, game, nil)
+	})
+	return mux
+}
+
+// upgradeWebSocket performs the server side of the opening handshake and
+// takes over the HTTP connection.
+func upgradeWebSocket(w http.ResponseWriter, r *http.Request) (*wsConn, error) {
+	if r.Method != http.MethodGet ||
+		!headerContains(r.Header, "Connection", "upgrade") ||
+		!headerContains(r.Header, "Upgrade", "websocket") {
+		http.Error(w, "Expected a WebSocket upgrade", http.StatusBadRequest)
+		return nil, errors.New("not a websocket upgrade request")
+	}
+	if !sameOrigin(r) {
+		http.Error(w, "Cross-origin WebSocket requests are not allowed", http.StatusForbidden)
+		return nil, errors.New("cross-origin request from " + r.Header.Get("Origin"))
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "Unsupported WebSocket version", http.StatusUpgradeRequired)
+		return nil, errors.New("unsupported websocket version")
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" {
+		http.Error(w, "Missing Sec-WebSocket-Key", http.StatusBadRequest)
+		return nil, errors.New("missing websocket key")
+	}
+	
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "WebSocket not supported", http.StatusInternalServerError)
+		return nil, errors.New("response writer cannot be hijacked")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+	
+	response := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + webSocketAccept(key) + "\r\n\r\n"
+	if _, err := conn.Write([]byte(response)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return newWSConn(conn, rw.Reader), nil
+}
+
+// sameOrigin reports whether the request comes from a page served by this
+// server, so other web sites can't open game sessions from their visitors'
+// browsers. Browsers always send Origin; clients that aren't browsers
+// don't have to.
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+func webSocketAccept(key string) string {
+	sum := sha1.Sum([]byte(key + wsAcceptGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func headerContains(header http.Header, name, value string) bool {
+	for _, field := range header.Values(name) {
+		for _, part := range strings.Split(field, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// wsConn presents a server-side WebSocket as a net.Conn. Each message from
+// the browser reads as one line of input; each write is sent as one text
+// message.
+type wsConn struct {
+	net.Conn
+	reader *bufio.Reader
+	
+	// pending holds the rest of the message currently being read.
+	pending []byte
+	
+	mu     sync.Mutex
+	closed bool
+}
+
+func newWSConn(conn net.Conn, reader *bufio.Reader) *wsConn {
+	return &wsConn{Conn: conn, reader: reader}
+}
+
+func (c *wsConn) Read(p []byte) (int, error) {
+	for len(c.pending) == 0 {
+		message, err := c.readMessage()
+		if err != nil {
+			return 0, err
+		}
+		c.pending = append(message, '\n')
+	}
+	n := copy(p, c.pending)
+	c.pending = c.pending[n:]
+	return n, nil
+}
+
+// readMessage returns the next data message, answering pings and close
+// frames along the way.
+func (c *wsConn) readMessage() ([]byte, error) {
+	var message []byte
+	for {
+		fin, opcode, payload, err := c.readFrame()
+		if err != nil {
+			return nil, err
+		}
+		
+		switch opcode {
+		case wsOpPing:
+			if err := c.writeFrame(wsOpPong, payload); err != nil {
+				return nil, err
+			}
+		case wsOpPong:
+		case wsOpClose:
+			c.writeFrame(wsOpClose, payload)
+			return nil, io.EOF
+		case wsOpText, wsOpBinary, wsOpContinuation:
+			if len(message)+len(payload) > wsMaxMessage {
+				c.writeFrame(wsOpClose, closePayload(1009))
+				return nil, errors.New("websocket message too large")
+			}
+			message = append(message, payload...)
+			if fin {
+				return message, nil
+			}
+		default:
+			c.writeFrame(wsOpClose, closePayload(1002))
+			return nil, errors.New("unknown websocket opcode")
+		}
+	}
+}
+
+func (c *wsConn) readFrame() (fin bool, opcode byte, payload []byte, err error) {
+	var header [2]byte
+	if _, err = io.ReadFull(c.reader, header[:]); err != nil {
+		return
+	}
+	fin = header[0]&0x80 != 0
+	opcode = header[0] & 0x0f
+	masked := header[1]&0x80 != 0
+	length := uint64(header[1] & 0x7f)
+	
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err = io.ReadFull(c.reader, ext[:]); err != nil {
+			return
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err = io.ReadFull(c.reader, ext[:]); err != nil {
+			return
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	if !masked {
+		err = errors.New("unmasked websocket frame from client")
+		return
+	}
+	if length > wsMaxMessage {
+		err = errors.New("websocket frame too large")
+		return
+	}
+	
+	var mask [4]byte
+	if _, err = io.ReadFull(c.reader, mask[:]); err != nil {
+		return
+	}
+	payload = make([]byte, length)
+	if _, err = io.ReadFull(c.reader, payload); err != nil {
+		return
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return
+}
+
+// Write sends p as a single text message.
+func (c *wsConn) Write(p []byte) (int, error) {
+	if err := c.writeFrame(wsOpText, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (c *wsConn) writeFrame(opcode byte, payload []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.sendFrame(opcode, payload)
+}
+
+// sendFrame writes one unfragmented frame. The caller must hold c.mu.
+func (c *wsConn) sendFrame(opcode byte, payload []byte) error {
+	if c.closed {
+		return errWebSocketClosed
+	}
+	if opcode == wsOpClose {
+		c.closed = true
+	}
+	
+	frame := make([]byte, 0, len(payload)+10)
+	frame = append(frame, 0x80|opcode)
+	switch {
+	case len(payload) < 126:
+		frame = append(frame, byte(len(payload)))
+	case len(payload) <= 0xffff:
+		frame = append(frame, 126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(len(payload)))
+	default:
+		frame = append(frame, 127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(len(payload)))
+	}
+	frame = append(frame, payload...)
+	_, err := c.Conn.Write(frame)
+	return err
+}
+
+// EchoOff switches the browser's input line to password mode.
+func (c *wsConn) EchoOff() {
+	c.Write([]byte(wsEchoOff))
+}
+
+// EchoOn switches the browser's input line back to plain text.
+func (c *wsConn) EchoOn() {
+	c.Write([]byte(wsEchoOn))
+}
+
+// Close sends a close frame if one has not been sent, then closes the
+// connection. The frame is skipped while another write is in progress: that
+// write may be stalled on a client that stopped reading, and Close must not
+// wait for it.
+func (c *wsConn) Close() error {
+	if c.mu.TryLock() {
+		c.Conn.SetWriteDeadline(time.Now().Add(wsCloseTimeout))
+		c.sendFrame(wsOpClose, closePayload(1000))
+		c.mu.Unlock()
+	}
+	return c.Conn.Close()
+}
+
+func closePayload(code uint16) []byte {
+	return binary.BigEndian.AppendUint16(nil, code)
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// dialWebSocket performs the client handshake against a test server.
+func dialWebSocket(t *testing.T, server *httptest.Server) (net.Conn, *bufio.Reader) {
+	t.Helper()
+	conn, err := net.Dial("tcp", strings.TrimPrefix(server.URL, "http://"))
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	
+	key := "dGhlIHNhbXBsZSBub25jZQ=="
+	request := "GET /ws HTTP/1.1\r\n" +
+		"Host: localhost\r\n" +
+		"Origin: http://localhost\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Key: " + key + "\r\n" +
+		"Sec-WebSocket-Version: 13\r\n\r\n"
+	if _, err := conn.Write([]byte(request)); err != nil {
+		t.Fatalf("Failed to send handshake: %v", err)
+	}
+	
+	reader := bufio.NewReader(conn)
+	response, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatalf("Failed to read handshake response: %v", err)
+	}
+	if response.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("Expected 101, got %d", response.StatusCode)
+	}
+	if accept := response.Header.Get("Sec-WebSocket-Accept"); accept != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("Unexpected Sec-WebSocket-Accept %q", accept)
+	}
+	return conn, reader
+}
+
+// sendClientFrame writes a masked frame, as browsers must.
+func sendClientFrame(t *testing.T, conn net.Conn, opcode byte, payload string) {
+	t.Helper()
+	mask := []byte{0x12, 0x34, 0x56, 0x78}
+	frame := []byte{0x80 | opcode, 0x80 | byte(len(payload))}
+	frame = append(frame, mask...)
+	for i := 0; i < len(payload); i++ {
+		frame = append(frame, payload[i]^mask[i%4])
+	}
+	if _, err := conn.Write(frame); err != nil {
+		t.Fatalf("Failed to send frame: %v", err)
+	}
+}
+
+func readServerFrame(t *testing.T, reader *bufio.Reader) (byte, string) {
+	t.Helper()
+	var header [2]byte
+	if _, err := io.ReadFull(reader, header[:]); err != nil {
+		t.Fatalf("Failed to read frame: %v", err)
+	}
+	if header[1]&0x80 != 0 {
+		t.Fatal("Server frames must not be masked")
+	}
+	length := int(header[1] & 0x7f)
+	switch length {
+	case 126:
+		var ext [2]byte
+		io.ReadFull(reader, ext[:])
+		length = int(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		io.ReadFull(reader, ext[:])
+		length = int(binary.BigEndian.Uint64(ext[:]))
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(reader, payload); err != nil {
+		t.Fatalf("Failed to read payload: %v", err)
+	}
+	return header[0] & 0x0f, string(payload)
+}
+
+// readUntil collects text messages until one contains want.
+func readUntil(t *testing.T, reader *bufio.Reader, want string) string {
+	t.Helper()
+	var text strings.Builder
+	for !strings.Contains(text.String(), want) {
+		opcode, payload := readServerFrame(t, reader)
+		if opcode != wsOpText {
+			continue
+		}
+		text.WriteString(payload)
+	}
+	return text.String()
+}
+
+func TestWebSocketSession(t *testing.T) {
+	game := newTestGame(t, testConfig(t))
+	game.Start()
+	defer game.Stop()
+	
+	server := httptest.NewServer(NewWebHandler(game))
+	defer server.Close()
+	
+	conn, reader := dialWebSocket(t, server)
+	readUntil(t, reader, "What is your name?")
+	
+	sendClientFrame(t, conn, wsOpText, "Webby")
+	readUntil(t, reader, "Choose a password:")
+	readUntil(t, reader, wsEchoOff)
+	sendClientFrame(t, conn, wsOpText, "cobwebs")
+	readUntil(t, reader, "Confirm password:")
+	sendClientFrame(t, conn, wsOpText, "cobwebs")
+	text := readUntil(t, reader, "Town Square")
+	if !strings.Contains(text, "Hello, ") {
+		t.Errorf("Expected greeting, got %q", text)
+	}
+	
+	sendClientFrame(t, conn, wsOpPing, "hi")
+	sendClientFrame(t, conn, wsOpText, "say hello")
+	sawPong := false
+	for {
+		opcode, payload := readServerFrame(t, reader)
+		if opcode == wsOpPong {
+			if payload != "hi" {
+				t.Errorf("Expected pong payload 'hi', got %q", payload)
+			}
+			sawPong = true
+		}
+		if opcode == wsOpText && strings.Contains(payload, "hello") {
+			break
+		}
+	}
+	if !sawPong {
+		t.Error("Expected a pong before the say output")
+	}
+	
+	sendClientFrame(t, conn, wsOpClose, "")
+	for {
+		opcode, _ := readServerFrame(t, reader)
+		if opcode == wsOpClose {
+			break
+		}
+	}
+}
+
+func TestWebSocketRejectsOtherOrigins(t *testing.T) {
+	game := newTestGame(t, testConfig(t))
+	server := httptest.NewServer(NewWebHandler(game))
+	defer server.Close()
+	
+	request, err := http.NewRequest(http.MethodGet, server.URL+"/ws", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.Header.Set("Origin", "http://evil.example")
+	request.Header.Set("Connection", "Upgrade")
+	request.Header.Set("Upgrade", "websocket")
+	request.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	request.Header.Set("Sec-WebSocket-Version", "13")
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected a cross-origin upgrade to be refused, got %d", response.StatusCode)
+	}
+}
+
+func TestWebClientServed(t *testing.T) {
+	server := httptest.NewServer(NewWebHandler(NewGame()))
+	defer server.Close()
+	
+	for _, path := range []string{"/", "/client.js", "/style.css"} {
+		response, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatalf("GET %s failed: %v", path, err)
+		}
+		response.Body.Close()
+		if response.StatusCode != http.StatusOK {
+			t.Errorf("GET %s: expected 200, got %d", path, response.StatusCode)
+		}
+	}
+	
+	response, err := http.Get(server.URL + "/ws")
+	if err != nil {
+		t.Fatalf("GET /ws failed: %v", err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusBadRequest {
+		t.Errorf("Plain GET /ws: expected 400, got %d", response.StatusCode)
+	}
+}
+
+func TestWebSocketSlowClientEviction(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+	
+	before := GlobalTelemetry.GetSnapshot().SlowClientEvictions
+	
+	// Nobody reads from the client side, so the writer stalls holding the
+	// frame lock. Evicting the player must not wait for it.
+	player := NewPlayer(newWSConn(server, bufio.NewReader(server)), "Slowpoke")
+	player.SendMessage("This write blocks.")
+	time.Sleep(50 * time.Millisecond)
+	
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < outputQueueSize+10; i++ {
+			player.SendMessage("You hear a distant rumble.")
+		}
+		player.stopOutput()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Eviction blocked behind a stalled write")
+	}
+	
+	after := GlobalTelemetry.GetSnapshot().SlowClientEvictions
+	if after != before+1 {
+		t.Errorf("Expected 1 slow client eviction, got %d", after-before)
+	}
+}
@@ -0,0 +1,708 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"html"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+// mapPos is a room's place on the map: x grows east, y south and z up.
+type mapPos struct {
+	x, y, z int
+}
+
+func (p mapPos) add(q mapPos) mapPos {
+	return mapPos{p.x + q.x, p.y + q.y, p.z + q.z}
+}
+
+var directionOffsets = map[string]mapPos{
+	"north": {0, -1, 0},
+	"south": {0, 1, 0},
+	"east":  {1, 0, 0},
+	"west":  {-1, 0, 0},
+	"up":    {0, 0, 1},
+	"down":  {0, 0, -1},
+}
+
+// layoutRooms places rooms on a grid, one grid per level, by walking the
+// exits out from the start room: each room goes one step in the exit's
+// direction from the room it was first reached from. Worlds aren't always
+// that tidy, so a room whose spot is taken goes in the nearest free one.
+// Rooms that can't be reached from start are laid out separately to the
+// east.
+func layoutRooms(rooms map[string]*Room, start string) map[string]mapPos {
+	positions := make(map[string]mapPos)
+	occupied := make(map[mapPos]bool)
+	place := func(id string, want mapPos) {
+		pos := nearestFree(occupied, want)
+		positions[id] = pos
+		occupied[pos] = true
+	}
+	
+	ids := make([]string, 0, len(rooms))
+	for id := range rooms {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	if rooms[start] != nil {
+		ids = append([]string{start}, ids...)
+	}
+	
+	for _, root := range ids {
+		if _, placed := positions[root]; placed {
+			continue
+		}
+		origin := mapPos{}
+		for pos := range occupied {
+			origin.x = max(origin.x, pos.x+2)
+		}
+		place(root, origin)
+		queue := []*Room{rooms[root]}
+		for len(queue) > 0 {
+			room := queue[0]
+			queue = queue[1:]
+			for _, direction := range directions {
+				next := room.exits[direction]
+				if next == nil {
+					continue
+				}
+				if _, placed := positions[next.id]; placed {
+					continue
+				}
+				place(next.id, positions[room.id].add(directionOffsets[direction]))
+				queue = append(queue, next)
+			}
+		}
+	}
+	return positions
+}
+
+// nearestFree returns want if it is free, or else the closest free spot
+// on the same level, searching outwards ring by ring.
+func nearestFree(occupied map[mapPos]bool, want mapPos) mapPos {
+	for r := 0; ; r++ {
+		for dy := -r; dy <= r; dy++ {
+			for dx := -r; dx <= r; dx++ {
+				if max(abs(dx), abs(dy)) != r {
+					continue
+				}
+				pos := mapPos{want.x + dx, want.y + dy, want.z}
+				if !occupied[pos] {
+					return pos
+				}
+			}
+		}
+	}
+}
+
+// mapOptions chooses what a map shows besides rooms and exits.
+type mapOptions struct {
+	monsters bool
+	items    bool
+	
+	// visits colors rooms by how often players entered them, keyed by
+	// room name as telemetry records it. Nil means no heat.
+	visits map[string]int64
+}
+
+// mapRoom is a room as drawn: where it goes, what it says and which way
+// its exits lead.
+type mapRoom struct {
+	id     string
+	area   string
+	name   string
+	pos    mapPos
+	exits  map[string]string
+	notes  []mapNote
+	visits int64
+}
+
+type mapNote struct {
+	text string
+	kind string // "monster" or "item"
+}
+
+// worldMap is a laid out world ready to be drawn in any format.
+type worldMap struct {
+	rooms     []*mapRoom
+	byID      map[string]*mapRoom
+	levels    []int // top level first
+	width     int
+	rows      map[int][2]int // first and last row used on each level
+	areas     []string
+	heat      bool
+	maxVisits int64
+}
+
+func newWorldMap(rooms map[string]*Room, start string, options mapOptions) *worldMap {
+	positions := layoutRooms(rooms, start)
+	m := &worldMap{
+		byID: make(map[string]*mapRoom),
+		rows: make(map[int][2]int),
+		heat: options.visits != nil,
+	}
+	
+	minX, minY := 0, 0
+	first := true
+	for _, pos := range positions {
+		if first || pos.x < minX {
+			minX = pos.x
+		}
+		if first || pos.y < minY {
+			minY = pos.y
+		}
+		first = false
+	}
+	
+	levels := make(map[int]bool)
+	areas := make(map[string]bool)
+	for id, room := range rooms {
+		pos := positions[id]
+		pos.x -= minX
+		pos.y -= minY
+		drawn := &mapRoom{
+			id:    id,
+			area:  room.area,
+			name:  room.name,
+			pos:   pos,
+			exits: make(map[string]string),
+		}
+		for direction, next := range room.exits {
+			drawn.exits[direction] = next.id
+		}
+		if options.monsters {
+			for _, monster := range room.monsters {
+				drawn.notes = append(drawn.notes, mapNote{monster.name, "monster"})
+			}
+		}
+		if options.items {
+			for _, item := range room.items {
+				drawn.notes = append(drawn.notes, mapNote{item.name, "item"})
+			}
+		}
+		if m.heat {
+			drawn.visits = options.visits[room.name]
+			m.maxVisits = max(m.maxVisits, drawn.visits)
+		}
+		m.rooms = append(m.rooms, drawn)
+		m.byID[id] = drawn
+		m.width = max(m.width, pos.x+1)
+		if rows, ok := m.rows[pos.z]; ok {
+			m.rows[pos.z] = [2]int{min(rows[0], pos.y), max(rows[1], pos.y)}
+		} else {
+			m.rows[pos.z] = [2]int{pos.y, pos.y}
+		}
+		levels[pos.z] = true
+		areas[room.area] = true
+	}
+	
+	sort.Slice(m.rooms, func(i, j int) bool {
+		a, b := m.rooms[i].pos, m.rooms[j].pos
+		if a.z != b.z {
+			return a.z > b.z
+		}
+		if a.y != b.y {
+			return a.y < b.y
+		}
+		return a.x < b.x
+	})
+	for level := range levels {
+		m.levels = append(m.levels, level)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(m.levels)))
+	for area := range areas {
+		m.areas = append(m.areas, area)
+	}
+	sort.Strings(m.areas)
+	return m
+}
+
+// areaPalette colors rooms by area when there is no heat to show.
+var areaPalette = []color.RGBA{
+	{141, 211, 199, 255},
+	{255, 255, 179, 255},
+	{190, 186, 218, 255},
+	{251, 128, 114, 255},
+	{128, 177, 211, 255},
+	{253, 180, 98, 255},
+	{179, 222, 105, 255},
+	{252, 205, 229, 255},
+}
+
+// fill is the background color of a room.
+func (m *worldMap) fill(room *mapRoom) color.RGBA {
+	if m.heat {
+		// From pale yellow for rooms nobody visits to red for the busiest.
+		t := 0.0
+		if m.maxVisits > 0 {
+			t = float64(room.visits) / float64(m.maxVisits)
+		}
+		return color.RGBA{255, uint8(255 - 200*t), uint8(200 - 200*t), 255}
+	}
+	i := sort.SearchStrings(m.areas, room.area)
+	return areaPalette[i%len(areaPalette)]
+}
+
+// levelName describes a level; the start room is on level 0.
+func levelName(level int) string {
+	switch {
+	case level > 0:
+		return fmt.Sprintf("Level %d (above)", level)
+	case level < 0:
+		return fmt.Sprintf("Level %d (below)", level)
+	}
+	return "Level 0"
+}
+
+// levelLinks returns the up and down markers for a room.
+func (r *mapRoom) levelLinks() (up, down bool) {
+	_, up = r.exits["up"]
+	_, down = r.exits["down"]
+	return up, down
+}
+
+// Map drawing geometry, in pixels, shared by PNG and SVG.
+const (
+	mapCellWidth  = 170
+	mapCellHeight = 110
+	mapBoxWidth   = 150
+	mapBoxHeight  = 90
+	mapMargin     = 40
+	mapLevelGap   = 40
+	mapLineHeight = 13
+	mapTextChars  = 20 // characters of 7x13 text that fit in a box
+)
+
+func (m *worldMap) canvasSize() (int, int) {
+	width := m.width*mapCellWidth + 2*mapMargin
+	return width, m.levelTop(len(m.levels)) + mapMargin
+}
+
+// boxOrigin returns the top left corner of a room's box.
+func (m *worldMap) boxOrigin(room *mapRoom) (int, int) {
+	level := 0
+	for i, z := range m.levels {
+		if z == room.pos.z {
+			level = i
+		}
+	}
+	x := mapMargin + room.pos.x*mapCellWidth
+	y := m.levelTop(level) + mapLevelGap/2 + (room.pos.y-m.rows[room.pos.z][0])*mapCellHeight
+	return x, y
+}
+
+// levelTop returns where the i'th level from the top starts. Each level is
+// only as tall as the rows it uses.
+func (m *worldMap) levelTop(i int) int {
+	top := mapMargin
+	for _, z := range m.levels[:i] {
+		rows := m.rows[z]
+		top += (rows[1]-rows[0]+1)*mapCellHeight + mapLevelGap
+	}
+	return top
+}
+
+// links returns the exits to draw on a level's grid, once for each pair of
+// rooms.
+func (m *worldMap) links() [][2]*mapRoom {
+	var links [][2]*mapRoom
+	seen := make(map[[2]string]bool)
+	for _, room := range m.rooms {
+		for _, direction := range directions[:4] {
+			next := m.byID[room.exits[direction]]
+			if next == nil || next.pos.z != room.pos.z {
+				continue
+			}
+			key := [2]string{min(room.id, next.id), max(room.id, next.id)}
+			if !seen[key] {
+				seen[key] = true
+				links = append(links, [2]*mapRoom{room, next})
+			}
+		}
+	}
+	return links
+}
+
+// boxLines is the text inside a room's box: its name, then notes and
+// visits as space allows.
+func (m *worldMap) boxLines(room *mapRoom) []mapNote {
+	var lines []mapNote
+	for _, line := range splitRoomName(room.name) {
+		lines = append(lines, mapNote{truncate(line, mapTextChars), "name"})
+	}
+	maxLines := (mapBoxHeight - 8) / mapLineHeight
+	notes := room.notes
+	if m.heat {
+		notes = append([]mapNote{{pluralize(int(room.visits), "visit"), "visits"}}, notes...)
+	}
+	for i, note := range notes {
+		if len(lines) == maxLines-1 && i < len(notes)-1 {
+			lines = append(lines, mapNote{fmt.Sprintf("+%d more", len(notes)-i), note.kind})
+			break
+		}
+		lines = append(lines, mapNote{truncate(note.text, mapTextChars), note.kind})
+	}
+	return lines
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n-1] + "~"
+}
+
+var mapTextColors = map[string]color.RGBA{
+	"name":    {0, 0, 0, 255},
+	"monster": {180, 0, 0, 255},
+	"item":    {0, 0, 170, 255},
+	"visits":  {90, 60, 0, 255},
+}
+
+// writePNG draws the map as a PNG image.
+func (m *worldMap) writePNG(w io.Writer) error {
+	width, height := m.canvasSize()
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), &image.Uniform{color.RGBA{240, 240, 240, 255}}, image.Point{}, draw.Src)
+	
+	black := color.RGBA{0, 0, 0, 255}
+	for i, level := range m.levels {
+		drawText(img, levelName(level), mapMargin, m.levelTop(i)+mapLevelGap/2-6, black)
+	}
+	for _, link := range m.links() {
+		x1, y1 := m.boxOrigin(link[0])
+		x2, y2 := m.boxOrigin(link[1])
+		drawLine(img, x1+mapBoxWidth/2, y1+mapBoxHeight/2, x2+mapBoxWidth/2, y2+mapBoxHeight/2, color.RGBA{90, 90, 90, 255})
+	}
+	for _, room := range m.rooms {
+		x, y := m.boxOrigin(room)
+		drawRect(img, x, y, mapBoxWidth, mapBoxHeight, m.fill(room))
+		for i, line := range m.boxLines(room) {
+			drawText(img, line.text, x+5, y+15+i*mapLineHeight, mapTextColors[line.kind])
+		}
+		up, down := room.levelLinks()
+		if up {
+			drawText(img, "U", x+mapBoxWidth-12, y+15, black)
+		}
+		if down {
+			drawText(img, "D", x+mapBoxWidth-12, y+mapBoxHeight-6, black)
+		}
+	}
+	return png.Encode(w, img)
+}
+
+// writeSVG draws the map as an SVG document.
+func (m *worldMap) writeSVG(w io.Writer) error {
+	width, height := m.canvasSize()
+	var b strings.Builder
+	fmt.Fprintf(&b, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%d\" height=\"%d\" font-family=\"monospace\" font-size=\"11\">\n", width, height)
+	fmt.Fprintf(&b, "<rect width=\"%d\" height=\"%d\" fill=\"#f0f0f0\"/>\n", width, height)
+	for i, level := range m.levels {
+		fmt.Fprintf(&b, "<text x=\"%d\" y=\"%d\" font-weight=\"bold\">%s</text>\n", mapMargin, m.levelTop(i)+mapLevelGap/2-6, levelName(level))
+	}
+	for _, link := range m.links() {
+		x1, y1 := m.boxOrigin(link[0])
+		x2, y2 := m.boxOrigin(link[1])
+		fmt.Fprintf(&b, "<line x1=\"%d\" y1=\"%d\" x2=\"%d\" y2=\"%d\" stroke=\"#5a5a5a\"/>\n",
+			x1+mapBoxWidth/2, y1+mapBoxHeight/2, x2+mapBoxWidth/2, y2+mapBoxHeight/2)
+	}
+	for _, room := range m.rooms {
+		x, y := m.boxOrigin(room)
+		fmt.Fprintf(&b, "<g id=\"%[1]s\">\n<title>%[1]s</title>\n", html.EscapeString(room.id))
+		fmt.Fprintf(&b, "<rect x=\"%d\" y=\"%d\" width=\"%d\" height=\"%d\" fill=\"%s\" stroke=\"black\"/>\n",
+			x, y, mapBoxWidth, mapBoxHeight, hexColor(m.fill(room)))
+		for i, line := range m.boxLines(room) {
+			fmt.Fprintf(&b, "<text x=\"%d\" y=\"%d\" fill=\"%s\">%s</text>\n",
+				x+5, y+15+i*mapLineHeight, hexColor(mapTextColors[line.kind]), html.EscapeString(line.text))
+		}
+		up, down := room.levelLinks()
+		if up {
+			fmt.Fprintf(&b, "<text x=\"%d\" y=\"%d\">&#9650;</text>\n", x+mapBoxWidth-14, y+15)
+		}
+		if down {
+			fmt.Fprintf(&b, "<text x=\"%d\" y=\"%d\">&#9660;</text>\n", x+mapBoxWidth-14, y+mapBoxHeight-6)
+		}
+		b.WriteString("</g>\n")
+	}
+	b.WriteString("</svg>\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func hexColor(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+// writeDOT writes the map as a Graphviz graph with a cluster per level.
+// Nodes carry the computed layout as pos, which neato -n honors; dot lays
+// the graph out itself.
+func (m *worldMap) writeDOT(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("digraph world {\n")
+	b.WriteString("\tnode [shape=box, style=filled, fontname=\"Helvetica\"];\n")
+	for i, level := range m.levels {
+		fmt.Fprintf(&b, "\tsubgraph cluster_level_%d {\n", i)
+		fmt.Fprintf(&b, "\t\tlabel=%q;\n", levelName(level))
+		for _, room := range m.rooms {
+			if room.pos.z != level {
+				continue
+			}
+			label := room.name
+			if m.heat {
+				label += "\\n" + pluralize(int(room.visits), "visit")
+			}
+			for _, note := range room.notes {
+				label += "\\n" + note.kind + ": " + note.text
+			}
+			x, y := m.boxOrigin(room)
+			fmt.Fprintf(&b, "\t\t%s [label=%s, fillcolor=%q, pos=\"%d,%d!\"];\n",
+				dotID(room.id), dotString(label), hexColor(m.fill(room)), x, -y)
+		}
+		b.WriteString("\t}\n")
+	}
+	
+	seen := make(map[[2]string]bool)
+	for _, room := range m.rooms {
+		for _, direction := range directions {
+			target := room.exits[direction]
+			if target == "" || seen[[2]string{target, room.id}] {
+				continue
+			}
+			seen[[2]string{room.id, target}] = true
+			attributes := fmt.Sprintf("label=%q", direction)
+			next := m.byID[target]
+			if next != nil && next.exits[reverseDirections[direction]] == room.id {
+				attributes += ", dir=both"
+			}
+			if direction == "up" || direction == "down" {
+				attributes += ", style=dashed"
+			}
+			fmt.Fprintf(&b, "\t%s -> %s [%s];\n", dotID(room.id), dotID(target), attributes)
+		}
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func dotID(id string) string {
+	return fmt.Sprintf("%q", id)
+}
+
+// dotString quotes a label, keeping the \n line breaks Graphviz expects.
+func dotString(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
+
+// readRoomVisits reads the room visit counts from a telemetry dump.
+func readRoomVisits(path string) (map[string]int64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var telemetry TelemetryData
+	if err := json.Unmarshal(data, &telemetry); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if telemetry.RoomVisits == nil {
+		telemetry.RoomVisits = make(map[string]int64)
+	}
+	return telemetry.RoomVisits, nil
+}
+
+// mapCommand runs "mud map": it lays out a world's rooms and writes the
+// map as PNG, SVG or Graphviz DOT. The result is the process exit status.
+func mapCommand(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("map", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	output := fs.String("o", "", "file to write; the format follows its extension (default DOT on standard output)")
+	format := fs.String("format", "", "png, svg or dot, overriding the output file's extension")
+	start := fs.String("start", DefaultConfig().Player.StartRoom, "room at the center of level 0")
+	monsters := fs.Bool("monsters", false, "list the monsters in each room")
+	items := fs.Bool("items", false, "list the items in each room")
+	heat := fs.String("heat", "", "color rooms by visits from this telemetry dump (see -telemetry-dump)")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: mud map [-o file] [-format png|svg|dot] [-monsters] [-items] [-heat telemetry.json] [worlddir]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() > 1 {
+		fs.Usage()
+		return 2
+	}
+	
+	if *format == "" {
+		*format = strings.TrimPrefix(filepath.Ext(*output), ".")
+	}
+	if *format == "" {
+		*format = "dot"
+	}
+	if *format != "png" && *format != "svg" && *format != "dot" {
+		fmt.Fprintf(stderr, "unknown map format %q (use png, svg or dot)\n", *format)
+		return 2
+	}
+	
+	world, err := loadWorldFiles(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	options := mapOptions{monsters: *monsters, items: *items}
+	if *heat != "" {
+		if options.visits, err = readRoomVisits(*heat); err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+	}
+	m := newWorldMap(world.build(), *start, options)
+	
+	w := stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		defer file.Close()
+		w = file
+	}
+	switch *format {
+	case "png":
+		err = m.writePNG(w)
+	case "svg":
+		err = m.writeSVG(w)
+	default:
+		err = m.writeDOT(w)
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	return 0
+}
+
+func drawRect(img *image.RGBA, x, y, width, height int, c color.RGBA) {
+	for dy := 0; dy < height; dy++ {
+		for dx := 0; dx < width; dx++ {
+			if x+dx < img.Bounds().Max.X && y+dy < img.Bounds().Max.Y {
+				img.Set(x+dx, y+dy, c)
+			}
+		}
+	}
+	
+	// Draw border
+	borderColor := color.RGBA{0, 0, 0, 255}
+	for dx := 0; dx < width; dx++ {
+		if x+dx < img.Bounds().Max.X {
+			if y < img.Bounds().Max.Y {
+				img.Set(x+dx, y, borderColor)
+			}
+			if y+height-1 < img.Bounds().Max.Y {
+				img.Set(x+dx, y+height-1, borderColor)
+			}
+		}
+	}
+	for dy := 0; dy < height; dy++ {
+		if y+dy < img.Bounds().Max.Y {
+			if x < img.Bounds().Max.X {
+				img.Set(x, y+dy, borderColor)
+			}
+			if x+width-1 < img.Bounds().Max.X {
+				img.Set(x+width-1, y+dy, borderColor)
+			}
+		}
+	}
+}
+
+func drawLine(img *image.RGBA, x1, y1, x2, y2 int, c color.RGBA) {
+	dx := abs(x2 - x1)
+	dy := abs(y2 - y1)
+	
+	var sx, sy int
+	if x1 < x2 {
+		sx = 1
+	} else {
+		sx = -1
+	}
+	if y1 < y2 {
+		sy = 1
+	} else {
+		sy = -1
+	}
+	
+	err := dx - dy
+	x, y := x1, y1
+	
+	for {
+		if x >= 0 && x < img.Bounds().Max.X && y >= 0 && y < img.Bounds().Max.Y {
+			img.Set(x, y, c)
+		}
+		
+		if x == x2 && y == y2 {
+			break
+		}
+		
+		e2 := 2 * err
+		if e2 > -dy {
+			err -= dy
+			x += sx
+		}
+		if e2 < dx {
+			err += dx
+			y += sy
+		}
+	}
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+func drawText(img *image.RGBA, text string, x, y int, c color.RGBA) {
+	face := basicfont.Face7x13
+	
+	drawer := &font.Drawer{
+		Dst:  img,
+		Src:  &image.Uniform{c},
+		Face: face,
+		Dot:  fixed.Point26_6{X: fixed.Int26_6(x * 64), Y: fixed.Int26_6(y * 64)},
+	}
+	
+	drawer.DrawString(text)
+}
+
+func splitRoomName(name string) []string {
+	words := strings.Fields(name)
+	if len(words) <= 2 {
+		return []string{name}
+	}
+	
+	// Split long names into multiple lines
+	if len(name) > 15 {
+		mid := len(words) / 2
+		line1 := strings.Join(words[:mid], " ")
+		line2 := strings.Join(words[mid:], " ")
+		return []string{line1, line2}
+	}
+	
+	return []string{name}
+}
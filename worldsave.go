@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// worldSaveVersion is the current world state file format.
+const worldSaveVersion = 1
+
+// worldSave is the on-disk format of the world state: what has changed
+// since the world was built, so a restart carries on where it left off.
+type worldSave struct {
+	Version int           `json:"version"`
+	Saved   time.Time     `json:"saved"`
+	World   worldSnapshot `json:"world"`
+}
+
+// saveWorld writes the world state file and returns once it is on disk. It
+// runs on the game loop.
+func (g *Game) saveWorld() error {
+	return g.worldWriter.write(g.config.World.StateFile, encodeWorldSave(g.snapshotWorld(), time.Now()))
+}
+
+// saveWorldLater saves the world state in the background. It runs on the
+// game loop, which only takes the snapshot.
+func (g *Game) saveWorldLater() {
+	g.worldWriter.queue(g.config.World.StateFile, encodeWorldSave(g.snapshotWorld(), time.Now()))
+}
+
+func encodeWorldSave(world worldSnapshot, saved time.Time) func() ([]byte, error) {
+	return func() ([]byte, error) {
+		return json.MarshalIndent(worldSave{
+			Version: worldSaveVersion,
+			Saved:   saved,
+			World:   world,
+		}, "", "  ")
+	}
+}
+
+// loadWorld restores the world from its state file, if there is one. It
+// must be called before the game loop starts.
+func (g *Game) loadWorld() error {
+	data, err := os.ReadFile(g.config.World.StateFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	
+	var save worldSave
+	if err := json.Unmarshal(data, &save); err != nil {
+		return fmt.Errorf("%s: %w", g.config.World.StateFile, err)
+	}
+	if save.Version != worldSaveVersion {
+		return fmt.Errorf("%s: unsupported version %d", g.config.World.StateFile, save.Version)
+	}
+	g.restoreWorld(save.World)
+	log.Printf("Restored world state saved at %s", save.Saved.Format(time.RFC3339))
+	return nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestWorldStateRoundTrip(t *testing.T) {
+	config := testConfig(t)
+	game := newTestGame(t, config)
+	
+	player := createTestPlayer("Tidy")
+	game.AddPlayer(player)
+	player.HandleCommand(game, "go north")
+	player.HandleCommand(game, "get wooden mug")
+	player.HandleCommand(game, "go south")
+	player.HandleCommand(game, "drop wooden mug")
+	
+	rat := game.rooms["forest"].monsters[0]
+	rat.TakeDamage(rat.health)
+	
+	if err := game.saveWorld(); err != nil {
+		t.Fatalf("Failed to save world: %v", err)
+	}
+	
+	restored := newTestGame(t, config)
+	if err := restored.loadWorld(); err != nil {
+		t.Fatalf("Failed to load world: %v", err)
+	}
+	if len(restored.rooms["tavern"].items) != 0 {
+		t.Error("Expected the mug to be gone from the tavern")
+	}
+	square := restored.rooms["town_square"].items
+	if len(square) != 1 || square[0].name != "wooden mug" {
+		t.Errorf("Expected the mug on the town square floor, got %v", square)
+	}
+	dead := restored.rooms["forest"].monsters[0]
+	if dead.alive || dead.killedAt.IsZero() {
+		t.Errorf("Expected the rat to stay dead with its death time, got alive=%v killedAt=%v", dead.alive, dead.killedAt)
+	}
+	if !restored.rooms["forest"].monsters[1].alive {
+		t.Error("Expected other monsters to be untouched")
+	}
+}
+
+func TestWorldStateMissingOrBad(t *testing.T) {
+	config := testConfig(t)
+	game := newTestGame(t, config)
+	if err := game.loadWorld(); err != nil {
+		t.Errorf("A missing state file should not be an error: %v", err)
+	}
+	
+	os.WriteFile(config.World.StateFile, []byte(`{"version": 42}`), 0644)
+	if err := game.loadWorld(); err == nil {
+		t.Error("Expected an error for an unsupported version")
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	minLineWidth = 20
+	maxLineWidth = 250
+)
+
+// WrapText breaks text into lines of at most width visible characters,
+// breaking at spaces where possible. ANSI escape sequences take up no room
+// and are never split. Existing newlines are kept. A width of zero or less
+// only splits on the existing newlines.
+func WrapText(text string, width int) []string {
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		if width <= 0 {
+			lines = append(lines, line)
+			continue
+		}
+		lines = append(lines, wrapLine(line, width)...)
+	}
+	return lines
+}
+
+// wrapWord is a run of non-space characters and the spaces before it.
+type wrapWord struct {
+	spaces string
+	text   string
+	width  int
+}
+
+func wrapLine(line string, width int) []string {
+	var lines []string
+	var b strings.Builder
+	lineWidth := 0
+	
+	for _, word := range splitWords(line) {
+		if lineWidth > 0 && word.width > 0 && lineWidth+len(word.spaces)+word.width > width {
+			lines = append(lines, b.String())
+			b.Reset()
+			lineWidth = 0
+		} else {
+			b.WriteString(word.spaces)
+			lineWidth += len(word.spaces)
+		}
+		
+		if lineWidth+word.width <= width {
+			b.WriteString(word.text)
+			lineWidth += word.width
+			continue
+		}
+		
+		// The word is wider than a whole line, so break it up.
+		for i := 0; i < len(word.text); {
+			if n := escapeLength(word.text[i:]); n > 0 {
+				b.WriteString(word.text[i : i+n])
+				i += n
+				continue
+			}
+			if lineWidth >= width {
+				lines = append(lines, b.String())
+				b.Reset()
+				lineWidth = 0
+			}
+			_, size := utf8.DecodeRuneInString(word.text[i:])
+			b.WriteString(word.text[i : i+size])
+			lineWidth++
+			i += size
+		}
+	}
+	
+	return append(lines, b.String())
+}
+
+func splitWords(line string) []wrapWord {
+	var words []wrapWord
+	var current wrapWord
+	inWord := false
+	start := 0
+	
+	for i := 0; i < len(line); {
+		if n := escapeLength(line[i:]); n > 0 {
+			if !inWord {
+				current.spaces = line[start:i]
+				start = i
+				inWord = true
+			}
+			i += n
+			continue
+		}
+		
+		r, size := utf8.DecodeRuneInString(line[i:])
+		if r == ' ' {
+			if inWord {
+				current.text = line[start:i]
+				words = append(words, current)
+				current = wrapWord{}
+				start = i
+				inWord = false
+			}
+		} else {
+			if !inWord {
+				current.spaces = line[start:i]
+				start = i
+				inWord = true
+			}
+			current.width++
+		}
+		i += size
+	}
+	
+	if inWord {
+		current.text = line[start:]
+	} else {
+		current.spaces = line[start:]
+	}
+	if current.text != "" || current.spaces != "" {
+		words = append(words, current)
+	}
+	return words
+}
+
+// escapeLength returns the length of the ANSI escape sequence at the start
+// of s, or zero if s does not start with one.
+func escapeLength(s string) int {
+	if len(s) < 2 || s[0] != '\033' || s[1] != '[' {
+		return 0
+	}
+	for i := 2; i < len(s); i++ {
+		if s[i] >= 0x40 && s[i] <= 0x7e {
+			return i + 1
+		}
+	}
+	return len(s)
+}
+
+// stripControls removes the control characters from text a player typed,
+// so that it cannot carry escape sequences or other terminal controls to
+// the players it is shown to. Tabs and other spacing become spaces.
+func stripControls(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case unicode.IsSpace(r):
+			return ' '
+		case unicode.IsControl(r):
+			return -1
+		}
+		return r
+	}, s)
+}
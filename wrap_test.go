@@ -0,0 +1,115 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWrapTextPlain(t *testing.T) {
+	lines := WrapText("the quick brown fox jumps over the lazy dog", 15)
+	expected := []string{"the quick brown", "fox jumps over", "the lazy dog"}
+	
+	if strings.Join(lines, "|") != strings.Join(expected, "|") {
+		t.Errorf("Expected %q, got %q", expected, lines)
+	}
+}
+
+func TestWrapTextIgnoresColorCodes(t *testing.T) {
+	text := ColorRoomName("Town Square") + " " + ColorDescription("is busy today")
+	lines := WrapText(text, 13)
+	
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 lines, got %d: %q", len(lines), lines)
+	}
+	if lines[0] != ColorRoomName("Town Square") {
+		t.Errorf("Color codes should not count toward line length, got %q", lines[0])
+	}
+	if lines[1] != ColorDescription("is busy today") {
+		t.Errorf("Unexpected second line %q", lines[1])
+	}
+}
+
+func TestWrapTextNeverSplitsEscapes(t *testing.T) {
+	text := strings.Repeat(ColorRed+"x", 30) + ColorReset
+	
+	for _, line := range WrapText(text, 7) {
+		if strings.Count(line, "\033") != strings.Count(line, "\033[") {
+			t.Errorf("Line contains a split escape sequence: %q", line)
+		}
+		visible := strings.ReplaceAll(strings.ReplaceAll(line, ColorRed, ""), ColorReset, "")
+		if len(visible) > 7 {
+			t.Errorf("Line %q is wider than 7 columns", line)
+		}
+	}
+}
+
+func TestWrapTextLongWord(t *testing.T) {
+	lines := WrapText("a abcdefghijkl", 5)
+	expected := []string{"a", "abcde", "fghij", "kl"}
+	
+	if strings.Join(lines, "|") != strings.Join(expected, "|") {
+		t.Errorf("Expected %q, got %q", expected, lines)
+	}
+}
+
+func TestWrapTextKeepsNewlinesAndIndent(t *testing.T) {
+	lines := WrapText("\nExits:\n  north", 40)
+	expected := []string{"", "Exits:", "  north"}
+	
+	if strings.Join(lines, "|") != strings.Join(expected, "|") {
+		t.Errorf("Expected %q, got %q", expected, lines)
+	}
+}
+
+func TestWrapTextDisabled(t *testing.T) {
+	text := strings.Repeat("word ", 50)
+	lines := WrapText(text, 0)
+	
+	if len(lines) != 1 || lines[0] != text {
+		t.Errorf("Width 0 should not wrap, got %d lines", len(lines))
+	}
+}
+
+func TestWidthCommand(t *testing.T) {
+	game := NewGame()
+	player := createMockPlayer("Narrow")
+	game.AddPlayer(player)
+	
+	player.HandleCommand(game, "width 30")
+	if player.width != 30 {
+		t.Fatalf("Expected width 30, got %d", player.width)
+	}
+	
+	clearPlayerMessages(player)
+	player.HandleCommand(game, "look")
+	for _, message := range getPlayerMessages(player) {
+		for _, line := range strings.Split(message, "\r\n") {
+			if n := len([]rune(stripColors(line))); n > 30 {
+				t.Errorf("Line wider than 30 columns (%d): %q", n, line)
+			}
+		}
+	}
+	
+	player.HandleCommand(game, "width 5")
+	if player.width != 30 {
+		t.Error("Width below the minimum should be rejected")
+	}
+	
+	player.HandleCommand(game, "width auto")
+	if player.width != 0 {
+		t.Errorf("Expected width to reset to auto, got %d", player.width)
+	}
+}
+
+func stripColors(text string) string {
+	var b strings.Builder
+	for i := 0; i < len(text); {
+		if n := escapeLength(text[i:]); n > 0 {
+			i += n
+			continue
+		}
+		b.WriteByte(text[i])
+		i++
+	}
+	return b.String()
+}